@@ -1,12 +1,23 @@
 package http
 
-import "github.com/YunzeGao/fire/framework/gin"
+import (
+	"github.com/YunzeGao/fire/framework/gin"
+	"github.com/YunzeGao/fire/framework/middleware"
+)
 
 func NewHttpEngine() (*gin.Engine, error) {
 	gin.SetMode(gin.ReleaseMode)
 	// 默认启动一个Web引擎
 	engine := gin.New()
-	engine.Use(gin.Recovery())
+	engine.Use(middleware.Recovery())
 	Routes(engine)
 	return engine, nil
 }
+
+// NewAdminEngine 管理端口使用的引擎，监听地址为 app.admin.address
+func NewAdminEngine() (*gin.Engine, error) {
+	engine := gin.New()
+	engine.Use(middleware.Recovery())
+	AdminRoutes(engine)
+	return engine, nil
+}
@@ -8,7 +8,55 @@ import (
 
 // Routes 绑定业务层路由
 func Routes(engine *gin.Engine) {
+	// 按照受信任代理解析客户端ip，配置在 app.client_ip
+	engine.Use(middleware.ClientIP())
+	// 安全响应头和跨域，配置在 app.security_headers 和 app.cors
+	engine.Use(middleware.SecurityHeaders())
+	engine.Use(middleware.Cors())
+	// 响应压缩，配置在 app.compress
+	engine.Use(middleware.Compress())
 	engine.Static("/dist/", "./dist/")
+	// 健康检查
+	engine.GET("/healthz", middleware.Health())
+	engine.GET("/readyz", middleware.Ready())
+	// 版本号响应头，配置在 app.version_header，默认关闭，完整的版本信息在管理端口的 /version
+	engine.Use(middleware.Version())
+	// 维护模式，通过 fire app down/up 切换
+	engine.Use(middleware.Maintenance())
 	engine.Use(middleware.Trace())
+	engine.Use(middleware.AccessLog())
+	// 请求指标，配置在 metrics.http
+	engine.Use(middleware.Metrics())
+	// ip访问控制，配置在 app.access_control.groups.default
+	engine.Use(middleware.AccessControl("default"))
+	// 请求体大小限制，配置在 app.body_limit
+	engine.Use(middleware.BodyLimit())
+	// 请求和响应体日志，配置在 log.body
+	engine.Use(middleware.BodyLog())
+	// 限流，配置在 app.rate_limit.groups.default
+	engine.Use(middleware.RateLimit("default"))
+	// 过载保护: 并发限制、自适应负载削减和按路由熔断，配置在 app.overload
+	engine.Use(middleware.ConcurrencyLimit())
+	engine.Use(middleware.LoadShedding())
+	engine.Use(middleware.CircuitBreaker())
+	// session和csrf防护只挂载在需要的路由组上，例如服务端渲染的页面和表单，配置在 session.yaml 和 app.csrf
+	// web := engine.Group("/web", middleware.Session(), middleware.Csrf())
+	// 幂等键，配置在 app.idempotency
+	engine.Use(middleware.Idempotency())
+	// ETag、条件请求、Cache-Control和服务端响应缓存，配置在 app.http_cache
+	engine.Use(middleware.HttpCache())
 	_ = demo.Register(engine)
 }
+
+// AdminRoutes 绑定管理端口的路由，管理端口不应该对外暴露
+func AdminRoutes(engine *gin.Engine) {
+	engine.Use(middleware.ClientIP())
+	engine.Use(middleware.AccessControl("admin"))
+	engine.GET("/healthz", middleware.Health())
+	engine.GET("/readyz", middleware.Ready())
+	engine.GET("/version", middleware.VersionInfo())
+	// 并发限制、负载削减和熔断器的状态
+	engine.GET("/overload", middleware.OverloadInfo())
+	// Prometheus格式的指标
+	engine.GET("/metrics", middleware.MetricsHandler())
+}
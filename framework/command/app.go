@@ -4,18 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
-	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/YunzeGao/fire/framework"
 	"github.com/YunzeGao/fire/framework/cobra"
 	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/middleware"
+	"github.com/YunzeGao/fire/framework/provider/kernel"
 	"github.com/YunzeGao/fire/framework/util"
 
 	"github.com/erikdubbelboer/gspt"
@@ -27,14 +31,36 @@ import (
 var appAddress = ""
 var appDaemon = false
 
+// app实例名称，不同名称的实例使用不同的pid和日志文件
+var appName = defaultAppName
+
+// prefork模式下的worker进程数，为0表示不开启prefork
+var appPrefork = 0
+
+// 维护模式的参数
+var appDownMessage = ""
+var appDownRetryAfter = 0
+var appDownAllow []string
+var appDownSecret = ""
+
 // initAppCommand 初始化app命令和其子命令
 func initAppCommand() *cobra.Command {
 	appStartCommand.Flags().BoolVarP(&appDaemon, "daemon", "d", false, "start app daemon")
 	appStartCommand.Flags().StringVarP(&appAddress, "addr", "a", "", "设置APP启动地址，默认为8080")
+	appStartCommand.Flags().StringVarP(&appName, "name", "n", defaultAppName, "设置APP实例名称，用于区分pid和日志文件")
+	appStartCommand.Flags().IntVarP(&appPrefork, "prefork", "p", 0, "prefork模式下的worker进程数，多个worker通过SO_REUSEPORT共享端口")
+	appStopCommand.Flags().StringVarP(&appName, "name", "n", defaultAppName, "需要停止的APP实例名称")
+	appRestartCommand.Flags().StringVarP(&appName, "name", "n", defaultAppName, "需要重启的APP实例名称")
+	appDownCommand.Flags().StringVarP(&appDownMessage, "message", "m", "", "维护期间返回给客户端的提示信息")
+	appDownCommand.Flags().IntVar(&appDownRetryAfter, "retry-after", 0, "Retry-After响应头的值，单位秒")
+	appDownCommand.Flags().StringSliceVar(&appDownAllow, "allow", nil, "维护期间允许访问的ip或者cidr，可以设置多个")
+	appDownCommand.Flags().StringVar(&appDownSecret, "secret", "", "维护期间用于绕过维护模式的token")
 	appCommand.AddCommand(appStartCommand)
 	appCommand.AddCommand(appStateCommand)
 	appCommand.AddCommand(appStopCommand)
 	appCommand.AddCommand(appRestartCommand)
+	appCommand.AddCommand(appDownCommand)
+	appCommand.AddCommand(appUpCommand)
 	return appCommand
 }
 
@@ -50,27 +76,220 @@ var appCommand = &cobra.Command{
 	},
 }
 
-func startAppServe(server *http.Server, container framework.IContainer) error {
-	// 这个goroutine是启动服务的goroutine
-	go func() {
-		_ = server.ListenAndServe()
-	}()
+// appCloseWait 获取优雅关闭的等待时间，单位秒
+func appCloseWait(container framework.IContainer) int {
+	closeWait := 5
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	if configService.IsExist("app.close_wait") {
+		closeWait = configService.GetInt("app.close_wait")
+	}
+	return closeWait
+}
+
+// startAppServe 将HTTP服务注册为生命周期组件，和其他组件一起启动，收到退出信号后按照相反顺序关闭所有组件
+// 配置了 app.admin.address 时同时启动管理端口，prefork模式下每个worker都会通过SO_REUSEPORT监听管理端口
+func startAppServe(server *http.Server, listener net.Listener, container framework.IContainer, reusePort bool) error {
+	lifecycleService := container.MustMake(contract.LifecycleKey).(contract.ILifecycle)
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	if adminAddress := configService.GetString("app.admin.address"); adminAddress != "" {
+		adminListener, err := util.Listen(adminAddress, reusePort)
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+		kernelService := container.MustMake(contract.KernelKey).(contract.IKernel)
+		adminServer := &http.Server{Handler: kernelService.AdminEngine(), Addr: adminAddress}
+		lifecycleService.Register(kernel.NewHttpComponent("admin", adminServer, adminListener))
+	}
+	lifecycleService.Register(kernel.NewHttpComponent("http", server, listener))
 
-	// 当前的goroutine等待信号量
-	quit := make(chan os.Signal)
 	// 监控信号：SIGINT, SIGTERM, SIGQUIT
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	// 这里会阻塞当前goroutine等待信号
-	<-quit
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+	// 这里会阻塞当前goroutine，直到收到信号或者某个组件异常退出
+	return lifecycleService.Run(ctx)
+}
 
-	// 调用Server.Shutdown graceful结束
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// runApp 记录实例信息并启动服务，prefork模式下当前进程作为master管理worker进程
+func runApp(server *http.Server, container framework.IContainer, pidFolder string) error {
+	instance := &appInstance{
+		Name:      appName,
+		Pid:       os.Getpid(),
+		Address:   appAddress,
+		StartTime: time.Now(),
+		Prefork:   appPrefork,
+	}
+	if err := writeAppInstance(pidFolder, instance); err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(appInstanceFile(pidFolder, appName))
+	}()
+	logAppStart(container, instance)
+
+	if appPrefork > 0 {
+		gspt.SetProcTitle("fire app " + appName + " master")
+		return startPreforkMaster(instance, container, pidFolder)
+	}
+	listener, err := util.Listen(appAddress, false)
+	if err != nil {
+		return err
+	}
+	gspt.SetProcTitle("fire app " + appName)
+	return startAppServe(server, listener, container, false)
+}
 
-	if err := server.Shutdown(timeoutCtx); err != nil {
-		log.Fatal("Server Shutdown:", err)
+// logAppStart 启动时将构建信息记录到日志中
+func logAppStart(container framework.IContainer, instance *appInstance) {
+	if !container.IsBind(contract.FireLogKey) {
+		return
+	}
+	logger := container.MustMake(contract.FireLogKey).(contract.ILog)
+	info := container.MustMake(contract.AppKey).(contract.App).BuildInfo()
+	logger.Info(context.Background(), "app start", map[string]interface{}{
+		"name":       instance.Name,
+		"pid":        instance.Pid,
+		"address":    instance.Address,
+		"prefork":    instance.Prefork,
+		"version":    info.Version,
+		"git_commit": info.GitCommit,
+		"build_time": info.BuildTime,
+		"go_version": info.GoVersion,
+		"dirty":      info.Dirty,
+	})
+}
+
+// prefork worker崩溃后的重启策略
+const (
+	// preforkStableAfter worker运行超过这个时间后退出不计入连续崩溃
+	preforkStableAfter = 10 * time.Second
+	// preforkMaxCrashes 连续崩溃超过这个次数时停止master
+	preforkMaxCrashes = 5
+	// preforkMaxBackoff 重启等待时间的上限，等待时间从1s开始翻倍
+	preforkMaxBackoff = 30 * time.Second
+)
+
+// preforkBackoff 第crashes次连续崩溃后重启前的等待时间
+func preforkBackoff(crashes int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < crashes && backoff < preforkMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > preforkMaxBackoff {
+		backoff = preforkMaxBackoff
+	}
+	return backoff
+}
+
+// startPreforkMaster 启动prefork的worker进程，收到退出信号时通知所有worker优雅退出
+// worker异常退出时按照指数退避重新拉起，连续崩溃超过 preforkMaxCrashes 次时停止所有worker并返回错误
+func startPreforkMaster(instance *appInstance, container framework.IContainer, pidFolder string) error {
+	execFile, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	workers := map[int]*exec.Cmd{}
+	starts := map[int]time.Time{}
+	exits := make(chan *exec.Cmd, instance.Prefork)
+	spawn := func() error {
+		cmd := exec.Command(execFile, "app", "start", "--name="+instance.Name, "--addr="+instance.Address)
+		cmd.Env = append(os.Environ(), preforkWorkerEnv+"=1")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		workers[cmd.Process.Pid] = cmd
+		starts[cmd.Process.Pid] = time.Now()
+		go func() {
+			_ = cmd.Wait()
+			exits <- cmd
+		}()
+		return nil
+	}
+	saveWorkers := func() {
+		instance.Workers = instance.Workers[:0]
+		for pid := range workers {
+			instance.Workers = append(instance.Workers, pid)
+		}
+		sort.Ints(instance.Workers)
+		_ = writeAppInstance(pidFolder, instance)
+	}
+	// stopWorkers 通知所有worker优雅退出，最多等待closeWait * 2秒
+	stopWorkers := func() error {
+		for _, cmd := range workers {
+			_ = cmd.Process.Signal(syscall.SIGTERM)
+		}
+		timeout := time.After(time.Duration(appCloseWait(container)*2) * time.Second)
+		for len(workers) > 0 {
+			select {
+			case cmd := <-exits:
+				delete(workers, cmd.Process.Pid)
+			case <-timeout:
+				for _, cmd := range workers {
+					_ = cmd.Process.Kill()
+				}
+				return errors.New("等待prefork worker退出超时")
+			}
+		}
+		return nil
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	for i := 0; i < instance.Prefork; i++ {
+		if err := spawn(); err != nil {
+			_ = stopWorkers()
+			return err
+		}
+	}
+	saveWorkers()
+	fmt.Println("prefork workers:", instance.Workers)
+
+	// crashes 连续崩溃的次数，pending 等待重启的worker数量
+	crashes, pending := 0, 0
+	var respawn <-chan time.Time
+	for {
+		select {
+		case <-quit:
+			return stopWorkers()
+		case cmd := <-exits:
+			pid := cmd.Process.Pid
+			if time.Since(starts[pid]) >= preforkStableAfter {
+				crashes = 0
+			} else {
+				crashes++
+			}
+			delete(workers, pid)
+			delete(starts, pid)
+			fmt.Println(time.Now(), "prefork worker退出, pid:", pid)
+			saveWorkers()
+			if crashes > preforkMaxCrashes {
+				_ = stopWorkers()
+				return fmt.Errorf("prefork worker连续崩溃%d次，停止服务", crashes)
+			}
+			pending++
+			if respawn == nil {
+				respawn = time.After(preforkBackoff(crashes))
+			}
+		case <-respawn:
+			respawn = nil
+			for pending > 0 {
+				if err := spawn(); err != nil {
+					crashes++
+					fmt.Println(time.Now(), "prefork worker启动失败:", err)
+					if crashes > preforkMaxCrashes {
+						_ = stopWorkers()
+						return fmt.Errorf("prefork worker连续启动失败%d次，停止服务: %w", crashes, err)
+					}
+					respawn = time.After(preforkBackoff(crashes))
+					break
+				}
+				pending--
+			}
+			saveWorkers()
+		}
 	}
-	return nil
 }
 
 // appStartCommand 启动一个Web服务
@@ -96,27 +315,44 @@ var appStartCommand = &cobra.Command{
 				appAddress = ":8080"
 			}
 		}
+		if appName == "" || strings.ContainsAny(appName, "/\\") {
+			return errors.New("app名称不合法: " + appName)
+		}
 		// 创建一个Server服务
 		server := &http.Server{
 			Handler: core,
 			Addr:    appAddress,
 		}
 
+		// prefork模式下的worker进程，通过SO_REUSEPORT和其他worker共享端口
+		if os.Getenv(preforkWorkerEnv) != "" {
+			listener, err := util.Listen(appAddress, true)
+			if err != nil {
+				return err
+			}
+			gspt.SetProcTitle("fire app " + appName + " worker")
+			return startAppServe(server, listener, container, true)
+		}
+
 		appService := container.MustMake(contract.AppKey).(contract.App)
 		pidFolder := appService.RuntimeFolder()
 		if !util.Exists(pidFolder) {
-			if err := os.Mkdir(pidFolder, os.ModePerm); err != nil {
+			if err := os.MkdirAll(pidFolder, os.ModePerm); err != nil {
 				return err
 			}
 		}
 		logFolder := appService.LogFolder()
 		if !util.Exists(logFolder) {
-			if err := os.Mkdir(logFolder, os.ModePerm); err != nil {
+			if err := os.MkdirAll(logFolder, os.ModePerm); err != nil {
 				return err
 			}
 		}
-		serverPidFile := filepath.Join(pidFolder, "app.pid")
-		serverLogFile := filepath.Join(logFolder, "app.log")
+		serverPidFile := appPidFile(pidFolder, appName)
+		serverLogFile := appLogFile(logFolder, appName)
+		// 同名实例已经在运行，不允许重复启动
+		if pid, err := readAppPid(pidFolder, appName); err == nil && pid > 0 && util.CheckProcessExist(pid) {
+			return errors.New("app实例 " + appName + " 已经启动, pid: " + strconv.Itoa(pid))
+		}
 		currentFolder := util.GetExecDirectory()
 		if appDaemon {
 			daemonCtx := &daemon.Context{
@@ -127,8 +363,12 @@ var appStartCommand = &cobra.Command{
 				WorkDir:     currentFolder,
 				// 设置所有设置文件的mask，默认为750
 				Umask: 027,
-				// 子进程的参数，按照这个参数设置，子进程的命令为 ./fire app start --daemon=true
-				Args: []string{"", "app", "start", "--daemon=true"},
+				// 子进程的参数，按照这个参数设置，子进程的命令为 ./fire app start --daemon=true --name=app ...
+				Args: []string{"", "app", "start", "--daemon=true",
+					"--name=" + appName,
+					"--addr=" + appAddress,
+					"--prefork=" + strconv.Itoa(appPrefork),
+				},
 			}
 			d, err := daemonCtx.Reborn()
 			if err != nil {
@@ -136,16 +376,15 @@ var appStartCommand = &cobra.Command{
 			}
 			if d != nil {
 				// 父进程直接打印启动成功信息，不做任何操作
-				fmt.Println("app启动成功，pid:", d.Pid)
+				fmt.Println("app启动成功，名称:", appName, "pid:", d.Pid)
 				fmt.Println("日志文件:", serverLogFile)
 				return nil
 			}
 			defer func(daemonCtx *daemon.Context) {
 				_ = daemonCtx.Release()
 			}(daemonCtx)
-			fmt.Println(time.Now(), "daemon start app")
-			gspt.SetProcTitle("fire app")
-			if err := startAppServe(server, container); err != nil {
+			fmt.Println(time.Now(), "daemon start app", appName)
+			if err := runApp(server, container, pidFolder); err != nil {
 				fmt.Println(err)
 			}
 			return nil
@@ -157,43 +396,45 @@ var appStartCommand = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		gspt.SetProcTitle("fire app")
 
 		fmt.Println("app serve url:", appAddress)
-		if err := startAppServe(server, container); err != nil {
-			fmt.Println(err)
-		}
-		return nil
+		// 启动失败或者组件异常退出时返回错误，进程以非0状态码退出，不需要再输出用法
+		c.SilenceUsage = true
+		return runApp(server, container, pidFolder)
 	},
 }
 
-// 获取启动的app的pid
+// 获取所有启动的app实例的状态
 var appStateCommand = &cobra.Command{
 	Use:   "state",
-	Short: "获取启动的app的pid",
+	Short: "获取启动的app实例状态",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		container := cmd.GetContainer()
 		appService := container.MustMake(contract.AppKey).(contract.App)
+		runtimeFolder := appService.RuntimeFolder()
 
-		// 获取pid
-		serverPidFile := filepath.Join(appService.RuntimeFolder(), "app.pid")
-
-		content, err := os.ReadFile(serverPidFile)
-		if err != nil {
-			return err
-		}
-
-		if content != nil && len(content) > 0 {
-			pid, err := strconv.Atoi(string(content))
-			if err != nil {
-				return err
+		rows := [][]string{{"NAME", "PID", "ADDRESS", "UPTIME", "WORKERS"}}
+		for _, name := range listAppNames(runtimeFolder) {
+			pid, err := readAppPid(runtimeFolder, name)
+			if err != nil || pid <= 0 || !util.CheckProcessExist(pid) {
+				continue
 			}
-			if util.CheckProcessExist(pid) {
-				fmt.Println("app服务已经启动, pid:", pid)
-				return nil
+			instance := readAppInstance(runtimeFolder, name)
+			address := instance.Address
+			if address == "" {
+				address = "-"
+			}
+			workers := "-"
+			if len(instance.Workers) > 0 {
+				workers = fmt.Sprint(instance.Workers)
 			}
+			rows = append(rows, []string{name, strconv.Itoa(pid), address, formatUptime(instance.StartTime), workers})
 		}
-		fmt.Println("没有app服务存在")
+		if len(rows) == 1 {
+			fmt.Println("没有app服务存在")
+			return nil
+		}
+		util.PrettyPrint(rows)
 		return nil
 	},
 }
@@ -207,26 +448,18 @@ var appStopCommand = &cobra.Command{
 		appService := container.MustMake(contract.AppKey).(contract.App)
 
 		// GetPid
-		serverPidFile := filepath.Join(appService.RuntimeFolder(), "app.pid")
-
-		content, err := os.ReadFile(serverPidFile)
+		pid, err := readAppPid(appService.RuntimeFolder(), appName)
 		if err != nil {
 			return err
 		}
 
-		if content != nil && len(content) != 0 {
-			pid, err := strconv.Atoi(string(content))
-			if err != nil {
-				return err
-			}
+		if pid > 0 {
 			// 发送SIGTERM命令
 			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
 				return err
 			}
-			if err := os.WriteFile(serverPidFile, []byte{}, 0644); err != nil {
-				return err
-			}
-			fmt.Println(time.Now(), "停止进程:", pid)
+			removeAppInstance(appService.RuntimeFolder(), appName)
+			fmt.Println(time.Now(), "停止进程:", appName, pid)
 		}
 		return nil
 	},
@@ -239,52 +472,44 @@ var appRestartCommand = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		container := cmd.GetContainer()
 		appService := container.MustMake(contract.AppKey).(contract.App)
+		runtimeFolder := appService.RuntimeFolder()
 
-		// GetPid
-		serverPidFile := filepath.Join(appService.RuntimeFolder(), "app.pid")
+		// 沿用上一次启动时的地址和prefork配置
+		instance := readAppInstance(runtimeFolder, appName)
+		appAddress = instance.Address
+		appPrefork = instance.Prefork
 
-		content, err := os.ReadFile(serverPidFile)
+		// GetPid
+		pid, err := readAppPid(runtimeFolder, appName)
 		if err != nil {
 			return err
 		}
 
-		if content != nil && len(content) != 0 {
-			pid, err := strconv.Atoi(string(content))
-			if err != nil {
+		if pid > 0 && util.CheckProcessExist(pid) {
+			// 杀死进程
+			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
 				return err
 			}
-			if util.CheckProcessExist(pid) {
-				// 杀死进程
-				if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
-					return err
-				}
 
-				// 获取closeWait
-				closeWait := 5
-				configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
-				if configService.IsExist("app.close_wait") {
-					closeWait = configService.GetInt("app.close_wait")
-				}
-
-				// 确认进程已经关闭,每秒检测一次， 最多检测closeWait * 2秒
-				for i := 0; i < closeWait*2; i++ {
-					if util.CheckProcessExist(pid) == false {
-						break
-					}
-					time.Sleep(1 * time.Second)
-				}
+			// 获取closeWait
+			closeWait := appCloseWait(container)
 
-				// 如果进程等待了2*closeWait之后还没结束，返回错误，不进行后续的操作
-				if util.CheckProcessExist(pid) == true {
-					fmt.Println(time.Now(), "结束进程失败:"+strconv.Itoa(pid), "请查看原因")
-					return errors.New("结束进程失败")
-				}
-				if err := os.WriteFile(serverPidFile, []byte{}, 0644); err != nil {
-					return err
+			// 确认进程已经关闭,每秒检测一次， 最多检测closeWait * 2秒
+			for i := 0; i < closeWait*2; i++ {
+				if util.CheckProcessExist(pid) == false {
+					break
 				}
+				time.Sleep(1 * time.Second)
+			}
 
-				fmt.Println(time.Now(), "结束进程成功:"+strconv.Itoa(pid))
+			// 如果进程等待了2*closeWait之后还没结束，返回错误，不进行后续的操作
+			if util.CheckProcessExist(pid) == true {
+				fmt.Println(time.Now(), "结束进程失败:"+strconv.Itoa(pid), "请查看原因")
+				return errors.New("结束进程失败")
 			}
+			removeAppInstance(runtimeFolder, appName)
+
+			fmt.Println(time.Now(), "结束进程成功:"+strconv.Itoa(pid))
 		}
 
 		appDaemon = true
@@ -292,3 +517,59 @@ var appRestartCommand = &cobra.Command{
 		return appStartCommand.RunE(cmd, args)
 	},
 }
+
+// 进入维护模式
+var appDownCommand = &cobra.Command{
+	Use:   "down",
+	Short: "进入维护模式，所有请求返回503",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		container := cmd.GetContainer()
+		appService := container.MustMake(contract.AppKey).(contract.App)
+		runtimeFolder := appService.RuntimeFolder()
+		if !util.Exists(runtimeFolder) {
+			if err := os.MkdirAll(runtimeFolder, os.ModePerm); err != nil {
+				return err
+			}
+		}
+		for _, allow := range appDownAllow {
+			if _, _, err := net.ParseCIDR(allow); err != nil && net.ParseIP(allow) == nil {
+				return errors.New("allow参数不是合法的ip或者cidr: " + allow)
+			}
+		}
+		mode := &middleware.MaintenanceMode{
+			Time:       time.Now(),
+			Message:    appDownMessage,
+			RetryAfter: appDownRetryAfter,
+			Allow:      appDownAllow,
+			Secret:     appDownSecret,
+		}
+		if err := middleware.WriteMaintenanceMode(middleware.MaintenanceFile(runtimeFolder), mode); err != nil {
+			return err
+		}
+		fmt.Println("app已经进入维护模式")
+		if appDownSecret != "" {
+			fmt.Println("携带 ?secret=" + appDownSecret + " 访问可以绕过维护模式")
+		}
+		return nil
+	},
+}
+
+// 退出维护模式
+var appUpCommand = &cobra.Command{
+	Use:   "up",
+	Short: "退出维护模式",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		container := cmd.GetContainer()
+		appService := container.MustMake(contract.AppKey).(contract.App)
+		file := middleware.MaintenanceFile(appService.RuntimeFolder())
+		if !util.Exists(file) {
+			fmt.Println("app不在维护模式")
+			return nil
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		fmt.Println("app已经退出维护模式")
+		return nil
+	},
+}
@@ -0,0 +1,108 @@
+package command
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/util"
+)
+
+// defaultAppName 默认的app实例名称，对应 app.pid 和 app.log
+const defaultAppName = "app"
+
+// preforkWorkerEnv prefork模式下子进程的环境变量标记
+const preforkWorkerEnv = "FIRE_PREFORK_WORKER"
+
+// appInstance 记录一个运行中的app实例信息，保存在 RuntimeFolder 下的 {name}.json 中
+type appInstance struct {
+	Name      string    `json:"name"`
+	Pid       int       `json:"pid"`
+	Address   string    `json:"address"`
+	StartTime time.Time `json:"start_time"`
+	Prefork   int       `json:"prefork"`
+	Workers   []int     `json:"workers"`
+}
+
+// appPidFile 获取实例的pid文件路径
+func appPidFile(runtimeFolder, name string) string {
+	return filepath.Join(runtimeFolder, name+".pid")
+}
+
+// appLogFile 获取实例的日志文件路径
+func appLogFile(logFolder, name string) string {
+	return filepath.Join(logFolder, name+".log")
+}
+
+// appInstanceFile 获取实例的信息文件路径
+func appInstanceFile(runtimeFolder, name string) string {
+	return filepath.Join(runtimeFolder, name+".json")
+}
+
+// readAppPid 读取实例pid文件中的pid，文件为空时返回0
+func readAppPid(runtimeFolder, name string) (int, error) {
+	content, err := os.ReadFile(appPidFile(runtimeFolder, name))
+	if err != nil {
+		return 0, err
+	}
+	content = []byte(strings.TrimSpace(string(content)))
+	if len(content) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(string(content))
+}
+
+// readAppInstance 读取实例信息，信息文件不存在时只返回名称
+func readAppInstance(runtimeFolder, name string) *appInstance {
+	instance := &appInstance{Name: name}
+	content, err := os.ReadFile(appInstanceFile(runtimeFolder, name))
+	if err != nil {
+		return instance
+	}
+	_ = json.Unmarshal(content, instance)
+	return instance
+}
+
+// writeAppInstance 保存实例信息
+func writeAppInstance(runtimeFolder string, instance *appInstance) error {
+	content, err := json.MarshalIndent(instance, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(appInstanceFile(runtimeFolder, instance.Name), content, 0644)
+}
+
+// removeAppInstance 清理实例的pid和信息文件
+func removeAppInstance(runtimeFolder, name string) {
+	_ = os.WriteFile(appPidFile(runtimeFolder, name), []byte{}, 0644)
+	_ = os.Remove(appInstanceFile(runtimeFolder, name))
+}
+
+// listAppNames 列出 RuntimeFolder 下所有有pid文件的实例名称
+func listAppNames(runtimeFolder string) []string {
+	var names []string
+	if !util.Exists(runtimeFolder) {
+		return names
+	}
+	matches, err := filepath.Glob(filepath.Join(runtimeFolder, "*.pid"))
+	if err != nil {
+		return names
+	}
+	for _, match := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(match), ".pid"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatUptime 将运行时长格式化为可读字符串
+func formatUptime(start time.Time) string {
+	if start.IsZero() {
+		return "-"
+	}
+	return time.Since(start).Truncate(time.Second).String()
+}
@@ -0,0 +1,395 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/cobra"
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/util"
+
+	"github.com/pkg/errors"
+)
+
+// 只检查生成结果和已有文件是否一致，不写入文件
+var deployCheck = false
+
+// 部署文件的输出目录
+var deployOutput = ""
+
+// initDeployCommand 初始化deploy命令和其子命令
+func initDeployCommand() *cobra.Command {
+	deployGenCommand.Flags().BoolVar(&deployCheck, "check", false, "检查生成的文件和已有文件是否一致，不一致时返回错误")
+	deployGenCommand.Flags().StringVarP(&deployOutput, "output", "o", "", "输出目录，默认为 deploy.output 或者 deploy/{env}")
+	deployCommand.AddCommand(deployGenCommand)
+	return deployCommand
+}
+
+var deployCommand = &cobra.Command{
+	Use:   "deploy",
+	Short: "部署相关命令",
+	RunE: func(c *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			_ = c.Help()
+		}
+		return nil
+	},
+}
+
+// deployHealth 健康检查配置
+type deployHealth struct {
+	// Liveness 存活检查地址
+	Liveness string `yaml:"liveness"`
+	// Readiness 就绪检查地址
+	Readiness string `yaml:"readiness"`
+	// InitialDelay 第一次检查前的等待时间，单位秒
+	InitialDelay int `yaml:"initial_delay"`
+	// Period 检查间隔，单位秒
+	Period int `yaml:"period"`
+}
+
+// deployResources 资源限制配置
+type deployResources struct {
+	CPURequest    string `yaml:"cpu_request"`
+	CPULimit      string `yaml:"cpu_limit"`
+	MemoryRequest string `yaml:"memory_request"`
+	MemoryLimit   string `yaml:"memory_limit"`
+}
+
+// deployConfig 对应 config/{env}/deploy.yaml
+type deployConfig struct {
+	// Name 服务名称，同时作为app实例名称
+	Name string `yaml:"name"`
+	// Binary 部署机器上的二进制文件路径
+	Binary string `yaml:"binary"`
+	// WorkDir 工作目录，需要包含 config 目录和 .env 文件
+	WorkDir string `yaml:"work_dir"`
+	// User systemd运行服务的用户
+	User string `yaml:"user"`
+	// Image 镜像名称
+	Image string `yaml:"image"`
+	// Replicas k8s副本数
+	Replicas int `yaml:"replicas"`
+	// Port 服务监听端口，默认从 app.address 中获取
+	Port int `yaml:"port"`
+	// Env 运行时的环境变量
+	Env map[string]string `yaml:"env"`
+	// Resources 资源限制
+	Resources deployResources `yaml:"resources"`
+	// Health 健康检查
+	Health deployHealth `yaml:"health"`
+	// Output 输出目录
+	Output string `yaml:"output"`
+	// Templates 自定义模版目录，存在 {kind}.tmpl 文件时替换默认模版
+	Templates string `yaml:"templates"`
+
+	// AppEnv 当前环境
+	AppEnv string `yaml:"-"`
+	// CloseWait 优雅关闭的等待时间，对应 app.close_wait
+	CloseWait int `yaml:"-"`
+	// StopTimeout 外部系统等待进程退出的时间，比CloseWait多留出一些余量
+	StopTimeout int `yaml:"-"`
+}
+
+// deployTarget 一种部署产物
+type deployTarget struct {
+	// file 相对于输出目录的文件路径
+	file string
+	// tmpl 默认模版
+	tmpl string
+}
+
+var deployTargets = map[string]deployTarget{
+	"systemd": {file: filepath.Join("systemd", "{{.Name}}.service"), tmpl: deploySystemdTmpl},
+	"docker":  {file: filepath.Join("docker", "Dockerfile"), tmpl: deployDockerTmpl},
+	"k8s":     {file: filepath.Join("k8s", "{{.Name}}.yaml"), tmpl: deployK8sTmpl},
+}
+
+// loadDeployConfig 读取部署配置，并且使用 app 配置补全默认值
+func loadDeployConfig(container framework.IContainer) (*deployConfig, error) {
+	appService := container.MustMake(contract.AppKey).(contract.App)
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	envService := container.MustMake(contract.EnvKey).(contract.Env)
+
+	conf := &deployConfig{}
+	if configService.IsExist("deploy") {
+		if err := configService.Load("deploy", conf); err != nil {
+			return nil, errors.Wrap(err, "load deploy config error")
+		}
+	}
+	conf.AppEnv = envService.AppEnv()
+	if conf.Name == "" {
+		conf.Name = "fire"
+	}
+	if conf.WorkDir == "" {
+		conf.WorkDir = "/opt/" + conf.Name
+	}
+	if conf.Binary == "" {
+		conf.Binary = conf.WorkDir + "/" + conf.Name
+	}
+	if conf.User == "" {
+		conf.User = conf.Name
+	}
+	if conf.Image == "" {
+		conf.Image = conf.Name + ":latest"
+	}
+	if conf.Replicas == 0 {
+		conf.Replicas = 1
+	}
+	if conf.Port == 0 {
+		conf.Port = 8080
+		if address := configService.GetString("app.address"); address != "" {
+			if _, port, err := net.SplitHostPort(address); err == nil {
+				if p, err := strconv.Atoi(port); err == nil {
+					conf.Port = p
+				}
+			}
+		}
+	}
+	if conf.Env == nil {
+		conf.Env = map[string]string{}
+	}
+	if _, ok := conf.Env["APP_ENV"]; !ok {
+		conf.Env["APP_ENV"] = conf.AppEnv
+	}
+	if conf.Health.Liveness == "" {
+		conf.Health.Liveness = "/healthz"
+	}
+	if conf.Health.Readiness == "" {
+		conf.Health.Readiness = "/readyz"
+	}
+	if conf.Health.Period == 0 {
+		conf.Health.Period = 10
+	}
+	if conf.Output == "" {
+		conf.Output = filepath.Join("deploy", conf.AppEnv)
+	}
+	if !filepath.IsAbs(conf.Output) {
+		conf.Output = filepath.Join(appService.BaseFolder(), conf.Output)
+	}
+	if conf.Templates == "" {
+		conf.Templates = filepath.Join("deploy", "templates")
+	}
+	if !filepath.IsAbs(conf.Templates) {
+		conf.Templates = filepath.Join(appService.BaseFolder(), conf.Templates)
+	}
+	conf.CloseWait = appCloseWait(container)
+	conf.StopTimeout = conf.CloseWait + 5
+	return conf, nil
+}
+
+// renderDeploy 渲染某种部署产物，返回文件路径和内容
+func renderDeploy(conf *deployConfig, kind string) (string, []byte, error) {
+	target, ok := deployTargets[kind]
+	if !ok {
+		return "", nil, errors.New("不支持的部署类型: " + kind)
+	}
+	funcs := template.FuncMap{"quote": strconv.Quote, "systemdQuote": systemdQuote, "systemdMemory": systemdMemory}
+
+	// 项目中存在自定义模版的时候使用自定义模版
+	tmpl := target.tmpl
+	customFile := filepath.Join(conf.Templates, kind+".tmpl")
+	if util.Exists(customFile) {
+		content, err := os.ReadFile(customFile)
+		if err != nil {
+			return "", nil, err
+		}
+		tmpl = string(content)
+	}
+	t, err := template.New(kind).Funcs(funcs).Parse(tmpl)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "parse template "+kind)
+	}
+	out := bytes.NewBuffer(nil)
+	if err := t.Execute(out, conf); err != nil {
+		return "", nil, errors.Wrap(err, "execute template "+kind)
+	}
+
+	fileTmpl := template.Must(template.New("file").Parse(target.file))
+	file := bytes.NewBuffer(nil)
+	if err := fileTmpl.Execute(file, conf); err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(conf.Output, file.String()), out.Bytes(), nil
+}
+
+// deployGenCommand 根据deploy.yaml生成部署文件
+var deployGenCommand = &cobra.Command{
+	Use:       "gen [systemd|docker|k8s]",
+	Short:     "根据deploy.yaml生成systemd、Dockerfile或者k8s部署文件",
+	ValidArgs: []string{"systemd", "docker", "k8s"},
+	Args:      cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs),
+	RunE: func(c *cobra.Command, args []string) error {
+		conf, err := loadDeployConfig(c.GetContainer())
+		if err != nil {
+			return err
+		}
+		if deployOutput != "" {
+			conf.Output = deployOutput
+		}
+
+		changed := 0
+		for _, kind := range args {
+			file, content, err := renderDeploy(conf, kind)
+			if err != nil {
+				return err
+			}
+			if deployCheck {
+				old, _ := os.ReadFile(file)
+				diff := util.DiffLines(string(old), string(content))
+				if diff == nil {
+					fmt.Println("一致:", file)
+					continue
+				}
+				changed++
+				fmt.Println("不一致:", file)
+				for _, line := range diff {
+					if !strings.HasPrefix(line, " ") {
+						fmt.Println(line)
+					}
+				}
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+				return err
+			}
+			if err := os.WriteFile(file, content, 0644); err != nil {
+				return err
+			}
+			fmt.Println("生成部署文件:", file)
+		}
+		if changed > 0 {
+			return errors.New(strconv.Itoa(changed) + " 个部署文件和生成结果不一致，请重新执行 fire deploy gen")
+		}
+		return nil
+	},
+}
+
+// systemdQuote 将值放在双引号中，转义systemd会解析的反斜杠、双引号和%说明符，值中可以包含空格
+func systemdQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "\n", `\n`).Replace(value) + `"`
+}
+
+// systemdMemory 将k8s格式的内存大小转换为systemd的格式，例如 512Mi 转换为 512M，systemd的单位都是1024进制
+func systemdMemory(value string) string {
+	return strings.NewReplacer("Ki", "K", "Mi", "M", "Gi", "G", "Ti", "T").Replace(value)
+}
+
+var deploySystemdTmpl = `[Unit]
+Description={{.Name}} service
+After=network.target
+
+[Service]
+Type=simple
+User={{.User}}
+WorkingDirectory={{.WorkDir}}
+{{- range $key, $val := .Env}}
+Environment={{systemdQuote (printf "%s=%s" $key $val)}}
+{{- end}}
+ExecStart={{.Binary}} app start --name={{.Name}} --addr=:{{.Port}}
+KillSignal=SIGTERM
+TimeoutStopSec={{.StopTimeout}}
+Restart=on-failure
+RestartSec=3
+{{- if .Resources.MemoryLimit}}
+MemoryMax={{systemdMemory .Resources.MemoryLimit}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// deployDockerTmpl 设置进程名称使用的gspt依赖cgo，使用alpine的镜像编译，运行时的镜像同样使用musl
+var deployDockerTmpl = `FROM golang:1.18-alpine AS builder
+RUN apk add --no-cache gcc musl-dev
+WORKDIR /src
+COPY . .
+RUN CGO_ENABLED=1 go build -o /out/{{.Name}} .
+
+FROM alpine:3.16
+WORKDIR {{.WorkDir}}
+COPY --from=builder /out/{{.Name}} {{.Binary}}
+COPY config ./config
+{{- range $key, $val := .Env}}
+ENV {{$key}}={{quote $val}}
+{{- end}}
+EXPOSE {{.Port}}
+STOPSIGNAL SIGTERM
+HEALTHCHECK --interval={{.Health.Period}}s --start-period={{.Health.InitialDelay}}s CMD wget -q -O /dev/null http://127.0.0.1:{{.Port}}{{.Health.Liveness}} || exit 1
+ENTRYPOINT ["{{.Binary}}", "app", "start", "--name={{.Name}}", "--addr=:{{.Port}}"]
+`
+
+var deployK8sTmpl = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  labels:
+    app: {{.Name}}
+spec:
+  replicas: {{.Replicas}}
+  selector:
+    matchLabels:
+      app: {{.Name}}
+  template:
+    metadata:
+      labels:
+        app: {{.Name}}
+    spec:
+      terminationGracePeriodSeconds: {{.StopTimeout}}
+      containers:
+        - name: {{.Name}}
+          image: {{.Image}}
+          args: ["app", "start", "--name={{.Name}}", "--addr=:{{.Port}}"]
+          ports:
+            - containerPort: {{.Port}}
+          env:
+{{- range $key, $val := .Env}}
+            - name: {{$key}}
+              value: {{quote $val}}
+{{- end}}
+{{- with .Resources}}
+          resources:
+            requests:
+              cpu: {{if .CPURequest}}{{.CPURequest}}{{else}}100m{{end}}
+              memory: {{if .MemoryRequest}}{{.MemoryRequest}}{{else}}128Mi{{end}}
+{{- if or .CPULimit .MemoryLimit}}
+            limits:
+{{- if .CPULimit}}
+              cpu: {{.CPULimit}}
+{{- end}}
+{{- if .MemoryLimit}}
+              memory: {{.MemoryLimit}}
+{{- end}}
+{{- end}}
+{{- end}}
+          livenessProbe:
+            httpGet:
+              path: {{.Health.Liveness}}
+              port: {{.Port}}
+            initialDelaySeconds: {{.Health.InitialDelay}}
+            periodSeconds: {{.Health.Period}}
+          readinessProbe:
+            httpGet:
+              path: {{.Health.Readiness}}
+              port: {{.Port}}
+            initialDelaySeconds: {{.Health.InitialDelay}}
+            periodSeconds: {{.Health.Period}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+spec:
+  selector:
+    app: {{.Name}}
+  ports:
+    - port: {{.Port}}
+      targetPort: {{.Port}}
+`
@@ -14,4 +14,8 @@ func AddKernelCommands(root *cobra.Command) {
 	root.AddCommand(initCmdCommand())
 	// middleware
 	root.AddCommand(initMiddlewareCommand())
+	// deploy
+	root.AddCommand(initDeployCommand())
+	// version
+	root.AddCommand(initVersionCommand())
 }
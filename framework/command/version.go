@@ -0,0 +1,48 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/YunzeGao/fire/framework/cobra"
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/util"
+)
+
+// 是否使用json格式输出版本信息
+var versionJson = false
+
+// initVersionCommand 初始化version命令
+func initVersionCommand() *cobra.Command {
+	versionCommand.Flags().BoolVarP(&versionJson, "json", "j", false, "使用json格式输出")
+	return versionCommand
+}
+
+// versionCommand 打印构建信息
+var versionCommand = &cobra.Command{
+	Use:   "version",
+	Short: "打印版本和构建信息",
+	Long:  "打印版本和构建信息，版本号，git commit 和构建时间可以在构建时通过 -ldflags \"-X github.com/YunzeGao/fire/framework/provider/app.Version=...\" 注入",
+	RunE: func(c *cobra.Command, args []string) error {
+		container := c.GetContainer()
+		appService := container.MustMake(contract.AppKey).(contract.App)
+		info := appService.BuildInfo()
+		if versionJson {
+			content, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(content))
+			return nil
+		}
+		util.PrettyPrint([][]string{
+			{"version", info.Version},
+			{"git_commit", info.GitCommit},
+			{"build_time", info.BuildTime},
+			{"go_version", info.GoVersion},
+			{"dirty", strconv.FormatBool(info.Dirty)},
+		})
+		return nil
+	},
+}
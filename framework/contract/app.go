@@ -3,10 +3,26 @@ package contract
 // AppKey 定义字符串凭证
 const AppKey = "fire:app"
 
+// BuildInfo 定义了构建时注入的元信息
+type BuildInfo struct {
+	// Version 版本号
+	Version string `json:"version"`
+	// GitCommit 构建时的git commit
+	GitCommit string `json:"git_commit"`
+	// BuildTime 构建时间
+	BuildTime string `json:"build_time"`
+	// GoVersion 构建使用的go版本
+	GoVersion string `json:"go_version"`
+	// Dirty 构建时工作区是否有未提交的修改
+	Dirty bool `json:"dirty"`
+}
+
 // App 定义接口
 type App interface {
 	// Version 定义当前版本
 	Version() string
+	// BuildInfo 获取构建信息
+	BuildInfo() *BuildInfo
 	//BaseFolder 定义项目基础地址
 	BaseFolder() string
 	// ConfigFolder 定义了配置文件的路径
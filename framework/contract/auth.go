@@ -0,0 +1,164 @@
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// AuthKey 定义字符串凭证
+const AuthKey = "fire:auth"
+
+var (
+	// ErrTokenMalformed token格式错误
+	ErrTokenMalformed = errors.New("token is malformed")
+	// ErrTokenSignature token签名错误，或者找不到对应的key
+	ErrTokenSignature = errors.New("token signature is invalid")
+	// ErrTokenExpired token已经过期
+	ErrTokenExpired = errors.New("token is expired")
+	// ErrTokenMissingExp token没有exp，默认不允许永久有效的token
+	ErrTokenMissingExp = errors.New("token has no expiration")
+	// ErrTokenNotValidYet token还没有生效
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	// ErrTokenIssuer token的签发者不匹配
+	ErrTokenIssuer = errors.New("token issuer is invalid")
+	// ErrTokenAudience token的受众不匹配
+	ErrTokenAudience = errors.New("token audience is invalid")
+)
+
+// Claims JWT中的声明，标准声明使用字段表示，其他声明放在Extra中，通过GetXxx方法读取
+type Claims struct {
+	// Issuer iss 签发者
+	Issuer string
+	// Subject sub 用户标识
+	Subject string
+	// Audience aud 受众
+	Audience []string
+	// ExpiresAt exp 过期时间
+	ExpiresAt time.Time
+	// NotBefore nbf 生效时间
+	NotBefore time.Time
+	// IssuedAt iat 签发时间
+	IssuedAt time.Time
+	// ID jti token的唯一标识
+	ID string
+	// Extra 自定义声明
+	Extra map[string]interface{}
+}
+
+// Get 获取自定义声明
+func (c *Claims) Get(key string) (interface{}, bool) {
+	if c.Extra == nil {
+		return nil, false
+	}
+	val, ok := c.Extra[key]
+	return val, ok
+}
+
+// GetString 获取string类型的自定义声明
+func (c *Claims) GetString(key string) string {
+	val, _ := c.Get(key)
+	return cast.ToString(val)
+}
+
+// GetInt64 获取int64类型的自定义声明
+func (c *Claims) GetInt64(key string) int64 {
+	val, _ := c.Get(key)
+	return cast.ToInt64(val)
+}
+
+// GetFloat64 获取float64类型的自定义声明
+func (c *Claims) GetFloat64(key string) float64 {
+	val, _ := c.Get(key)
+	return cast.ToFloat64(val)
+}
+
+// GetBool 获取bool类型的自定义声明
+func (c *Claims) GetBool(key string) bool {
+	val, _ := c.Get(key)
+	return cast.ToBool(val)
+}
+
+// GetStringSlice 获取[]string类型的自定义声明，例如角色列表
+func (c *Claims) GetStringSlice(key string) []string {
+	val, _ := c.Get(key)
+	return cast.ToStringSlice(val)
+}
+
+// MarshalJSON 将标准声明和自定义声明合并输出
+func (c *Claims) MarshalJSON() ([]byte, error) {
+	body := make(map[string]interface{}, len(c.Extra)+7)
+	for key, val := range c.Extra {
+		body[key] = val
+	}
+	if c.Issuer != "" {
+		body["iss"] = c.Issuer
+	}
+	if c.Subject != "" {
+		body["sub"] = c.Subject
+	}
+	if len(c.Audience) == 1 {
+		body["aud"] = c.Audience[0]
+	} else if len(c.Audience) > 1 {
+		body["aud"] = c.Audience
+	}
+	if !c.ExpiresAt.IsZero() {
+		body["exp"] = c.ExpiresAt.Unix()
+	}
+	if !c.NotBefore.IsZero() {
+		body["nbf"] = c.NotBefore.Unix()
+	}
+	if !c.IssuedAt.IsZero() {
+		body["iat"] = c.IssuedAt.Unix()
+	}
+	if c.ID != "" {
+		body["jti"] = c.ID
+	}
+	return json.Marshal(body)
+}
+
+// UnmarshalJSON 解析标准声明，其他声明放在Extra中，aud 可以是字符串或者数组
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	unix := func(key string) time.Time {
+		if val, ok := body[key]; ok {
+			delete(body, key)
+			return time.Unix(cast.ToInt64(val), 0)
+		}
+		return time.Time{}
+	}
+	*c = Claims{
+		Issuer:    cast.ToString(body["iss"]),
+		Subject:   cast.ToString(body["sub"]),
+		ID:        cast.ToString(body["jti"]),
+		ExpiresAt: unix("exp"),
+		NotBefore: unix("nbf"),
+		IssuedAt:  unix("iat"),
+	}
+	switch aud := body["aud"].(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []interface{}:
+		c.Audience = cast.ToStringSlice(aud)
+	}
+	delete(body, "iss")
+	delete(body, "sub")
+	delete(body, "jti")
+	delete(body, "aud")
+	c.Extra = body
+	return nil
+}
+
+// IAuth 定义了JWT认证服务
+type IAuth interface {
+	// Verify 校验token的签名、有效期、签发者和受众，返回其中的声明
+	Verify(ctx context.Context, token string) (*Claims, error)
+	// Issue 签发token，没有设置的iss/aud/iat/exp/jti使用配置中的默认值
+	Issue(ctx context.Context, claims *Claims) (string, error)
+}
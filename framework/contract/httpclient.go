@@ -0,0 +1,19 @@
+package contract
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// HttpClientKey 定义字符串凭证
+const HttpClientKey = "fire:httpclient"
+
+// IHttpClient 按照配置文件 httpclient.yaml 中的上游名称提供预先配置好的http.Client
+// 每次调用都会以ctx中的trace为父span创建client类型的span，注入trace请求头，并且通过ILog记录耗时和状态码
+type IHttpClient interface {
+	// Client 获取上游对应的客户端，请求地址为相对路径时基于上游的base_url，上游不存在时返回错误
+	Client(name string) (*http.Client, error)
+	// NewRequest 创建发往上游的请求，path为相对路径时基于上游的base_url
+	NewRequest(ctx context.Context, name, method, path string, body io.Reader) (*http.Request, error)
+}
@@ -9,4 +9,6 @@ const KernelKey = "fire:kernel"
 type IKernel interface {
 	// HttpEngine http.Handler结构，作为net/http框架使用, 实际上是gin.Engine
 	HttpEngine() http.Handler
+	// AdminEngine 管理端口使用的http.Handler，用于健康检查、运行状态、metrics等不对外暴露的接口
+	AdminEngine() http.Handler
 }
@@ -0,0 +1,34 @@
+package contract
+
+import "context"
+
+// LifecycleKey 定义字符串凭证
+const LifecycleKey = "fire:lifecycle"
+
+// Component 代表一个随应用一起启动和关闭的后台组件，例如HTTP服务、gRPC服务、定时任务、队列消费者
+type Component interface {
+	// Name 组件名称
+	Name() string
+	// Start 启动组件，会阻塞直到组件运行结束。返回非nil的error表示组件异常退出，会触发其他组件的关闭
+	Start(ctx context.Context) error
+	// Stop 优雅关闭组件，ctx超时之后需要尽快返回
+	Stop(ctx context.Context) error
+}
+
+// StartNotifier 组件可以选择实现的接口，启动需要时间的组件(例如需要先建立连接的队列消费者)在准备好之后关闭Started返回的channel
+// 没有实现这个接口的组件在Start被调用后就视为已经启动
+type StartNotifier interface {
+	Started() <-chan struct{}
+}
+
+// ILifecycle 定义了应用的生命周期服务，管理所有后台组件的启动和关闭
+type ILifecycle interface {
+	// Register 注册一个组件，组件按照注册顺序启动，按照相反的顺序关闭
+	Register(component Component)
+	// Components 获取所有已经注册的组件
+	Components() []Component
+	// Run 启动所有组件，阻塞直到ctx结束或者某个组件异常退出，然后按照相反的顺序关闭所有组件
+	Run(ctx context.Context) error
+	// Ready 所有组件是否已经启动并且正在运行，关闭开始后变为false
+	Ready() bool
+}
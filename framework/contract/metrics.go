@@ -0,0 +1,46 @@
+package contract
+
+import "io"
+
+// MetricsKey 定义字符串凭证
+const MetricsKey = "fire:metrics"
+
+// ICounter 只增不减的计数器
+type ICounter interface {
+	// Inc 计数加1，labelValues和注册时的labels顺序一致
+	Inc(labelValues ...string)
+	// Add 计数增加value，value不能为负数
+	Add(value float64, labelValues ...string)
+}
+
+// IGauge 可以任意设置的值
+type IGauge interface {
+	// Set 设置值
+	Set(value float64, labelValues ...string)
+	// Add 增加value，value为负数时减少
+	Add(value float64, labelValues ...string)
+}
+
+// IHistogram 按照bucket统计分布的直方图
+type IHistogram interface {
+	// Observe 记录一次观测值
+	Observe(value float64, labelValues ...string)
+}
+
+// MetricsCollector 在每次采集时调用，用于更新需要在采集时读取的指标，例如运行时信息
+type MetricsCollector func(metrics IMetrics)
+
+// IMetrics 定义了指标服务，指标名称会加上配置的命名空间前缀
+// 相同名称的指标只会注册一次，再次注册时返回已经注册的指标，类型或者labels不一致时panic
+type IMetrics interface {
+	// Counter 注册或者获取计数器
+	Counter(name, help string, labels ...string) ICounter
+	// Gauge 注册或者获取gauge
+	Gauge(name, help string, labels ...string) IGauge
+	// Histogram 注册或者获取直方图，buckets为空时使用配置的默认buckets
+	Histogram(name, help string, buckets []float64, labels ...string) IHistogram
+	// RegisterCollector 注册采集时调用的函数
+	RegisterCollector(name string, collector MetricsCollector)
+	// WritePrometheus 调用所有的collector，然后以Prometheus文本格式输出所有指标
+	WritePrometheus(w io.Writer) error
+}
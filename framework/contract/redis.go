@@ -0,0 +1,15 @@
+package contract
+
+import "context"
+
+// RedisKey 定义字符串凭证
+const RedisKey = "fire:redis"
+
+// IRedis 定义了redis服务，用于限流、session、缓存等需要在多个实例之间共享的数据
+type IRedis interface {
+	// Do 执行一条redis命令，例如 Do(ctx, "SET", "key", "val", "PX", 1000)
+	// 返回值按照RESP协议转换: 简单字符串和批量字符串为string，整数为int64，数组为[]interface{}，空值为nil
+	Do(ctx context.Context, args ...interface{}) (interface{}, error)
+	// Close 关闭所有连接
+	Close() error
+}
@@ -0,0 +1,62 @@
+package contract
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// SessionKey 定义字符串凭证
+const SessionKey = "fire:session"
+
+// ISession 一个请求对应的session，同一个请求中可以并发使用
+type ISession interface {
+	// ID session的标识，cookie存储时只用于区分session
+	ID() string
+	// IsNew 是否是这次请求新创建的session，请求中没有有效的session cookie
+	IsNew() bool
+	// Get 获取值
+	Get(key string) (interface{}, bool)
+	// GetString 获取string类型的值
+	GetString(key string) string
+	// GetInt64 获取int64类型的值，从存储中加载的数字都会转换为int64
+	GetInt64(key string) int64
+	// GetBool 获取bool类型的值
+	GetBool(key string) bool
+	// Set 设置值，值需要可以被json序列化
+	Set(key string, val interface{})
+	// Delete 删除值
+	Delete(key string)
+	// Clear 删除所有值
+	Clear()
+	// Flash 设置闪存消息，在下一次请求中可以读取一次
+	Flash(key string, val interface{})
+	// GetFlash 读取并删除闪存消息
+	GetFlash(key string) (interface{}, bool)
+	// Regenerate 更换session的标识并保留数据，登录成功后需要调用，避免会话固定攻击
+	Regenerate()
+	// Destroy 销毁session，退出登录时调用
+	Destroy()
+}
+
+// SessionStore 定义了服务端的session存储
+type SessionStore interface {
+	// Read 读取session数据，不存在或者已经过期时返回nil
+	Read(ctx context.Context, id string) ([]byte, error)
+	// Write 写入session数据，ttl后过期
+	Write(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	// Delete 删除session数据
+	Delete(ctx context.Context, id string) error
+	// GC 清理过期的session数据
+	GC(ctx context.Context) error
+}
+
+// ISessionService 定义了session服务
+type ISessionService interface {
+	// Load 从请求的cookie中加载session，不存在、过期或者加载失败时返回新的session，加载失败的错误同时返回
+	Load(ctx context.Context, req *http.Request) (ISession, error)
+	// Save 保存session并且写入cookie，需要在写入响应体之前调用
+	Save(ctx context.Context, w http.ResponseWriter, session ISession) error
+	// GC 清理过期的session
+	GC(ctx context.Context) error
+}
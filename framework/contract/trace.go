@@ -3,6 +3,8 @@ package contract
 import (
 	"context"
 	"net/http"
+	"sync"
+	"time"
 )
 
 const TraceKey = "fire:trace"
@@ -17,6 +19,29 @@ const (
 	TraceKeyTime     = "time"
 )
 
+// span的类型，和OpenTelemetry的SpanKind对应
+const (
+	SpanKindInternal = "internal"
+	SpanKindServer   = "server"
+	SpanKindClient   = "client"
+	SpanKindProducer = "producer"
+	SpanKindConsumer = "consumer"
+)
+
+// span的状态，和OpenTelemetry的StatusCode对应
+const (
+	SpanStatusUnset = "unset"
+	SpanStatusOK    = "ok"
+	SpanStatusError = "error"
+)
+
+// SpanEvent span中发生的事件，例如异常、重试
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
 // TraceContext define struct according Google Dapper
 type TraceContext struct {
 	TraceID  string // traceID global unique
@@ -24,7 +49,138 @@ type TraceContext struct {
 	SpanID   string // 当前节点SpanID
 	CspanID  string // 子节点调用的SpanID, 由调用方指定
 
+	Sampled        bool   // 是否采样，通过traceparent的flags和B3的sampled传递
+	SampleDeferred bool   // 上游没有传递采样决定，例如B3没有sampled、legacy格式，由当前服务的采样器决定
+	TraceState     string // W3C tracestate，原样传递给下游
+
 	Annotation map[string]string // 标记各种信息
+
+	Name          string                 // span名称，例如 GET /demo/:id
+	Kind          string                 // span类型，SpanKindServer等
+	StartTime     time.Time              // 开始时间
+	EndTime       time.Time              // 结束时间，span结束前为零值
+	Status        string                 // 状态，SpanStatusError表示出错
+	StatusMessage string                 // 出错时的错误信息
+	Attributes    map[string]interface{} // 属性，值为字符串、整数、浮点数或者布尔值
+	Events        []SpanEvent            // 事件
+
+	lock sync.Mutex
+}
+
+// SetAttribute 设置span的属性，span结束后不再修改
+func (tc *TraceContext) SetAttribute(key string, value interface{}) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	if !tc.EndTime.IsZero() {
+		return
+	}
+	if tc.Attributes == nil {
+		tc.Attributes = map[string]interface{}{}
+	}
+	tc.Attributes[key] = value
+}
+
+// AddEvent 记录span中发生的事件，span结束后不再记录
+func (tc *TraceContext) AddEvent(name string, attributes map[string]interface{}) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	if !tc.EndTime.IsZero() {
+		return
+	}
+	tc.Events = append(tc.Events, SpanEvent{Name: name, Time: time.Now(), Attributes: attributes})
+}
+
+// SetStatus 设置span的状态，span结束后不再修改
+func (tc *TraceContext) SetStatus(status, message string) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	if !tc.EndTime.IsZero() {
+		return
+	}
+	tc.Status = status
+	tc.StatusMessage = message
+}
+
+// RecordError 将span标记为出错，并且记录一个exception事件，err为nil时不做任何事情
+func (tc *TraceContext) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	tc.AddEvent("exception", map[string]interface{}{"exception.message": err.Error()})
+	tc.SetStatus(SpanStatusError, err.Error())
+}
+
+// Finish 记录结束时间，返回false表示span已经结束过
+func (tc *TraceContext) Finish() bool {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	if !tc.EndTime.IsZero() {
+		return false
+	}
+	tc.EndTime = time.Now()
+	return true
+}
+
+// Duration span的耗时，没有结束时为到现在的耗时
+func (tc *TraceContext) Duration() time.Duration {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	if tc.EndTime.IsZero() {
+		return time.Since(tc.StartTime)
+	}
+	return tc.EndTime.Sub(tc.StartTime)
+}
+
+// Snapshot 在锁中复制span，返回的副本不会再被修改，可以在其他goroutine中读取
+// 属性、事件以及事件的属性都会复制，Annotation只在创建span时设置，和原span共享
+func (tc *TraceContext) Snapshot() *TraceContext {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	snapshot := &TraceContext{
+		TraceID:        tc.TraceID,
+		ParentID:       tc.ParentID,
+		SpanID:         tc.SpanID,
+		CspanID:        tc.CspanID,
+		Sampled:        tc.Sampled,
+		SampleDeferred: tc.SampleDeferred,
+		TraceState:     tc.TraceState,
+		Annotation:     tc.Annotation,
+		Name:           tc.Name,
+		Kind:           tc.Kind,
+		StartTime:      tc.StartTime,
+		EndTime:        tc.EndTime,
+		Status:         tc.Status,
+		StatusMessage:  tc.StatusMessage,
+		Attributes:     copyAttributes(tc.Attributes),
+	}
+	if len(tc.Events) > 0 {
+		snapshot.Events = make([]SpanEvent, 0, len(tc.Events))
+		for _, event := range tc.Events {
+			event.Attributes = copyAttributes(event.Attributes)
+			snapshot.Events = append(snapshot.Events, event)
+		}
+	}
+	return snapshot
+}
+
+func copyAttributes(attributes map[string]interface{}) map[string]interface{} {
+	if attributes == nil {
+		return nil
+	}
+	ret := make(map[string]interface{}, len(attributes))
+	for key, value := range attributes {
+		ret[key] = value
+	}
+	return ret
+}
+
+// SpanExporter 导出已经结束并且采样的span，由trace服务在后台批量调用
+// 传入的span是结束时的快照，导出器可以直接读取，不需要加锁
+type SpanExporter interface {
+	// Export 导出一批span，返回错误时这批span会被丢弃
+	Export(ctx context.Context, spans []*TraceContext) error
+	// Shutdown 关闭导出器，释放连接和文件
+	Shutdown(ctx context.Context) error
 }
 
 type Trace interface {
@@ -34,8 +190,18 @@ type Trace interface {
 	GetTrace(c context.Context) *TraceContext
 	// NewTrace generate a new trace
 	NewTrace() *TraceContext
-	// ChildSpan generate cspan for child call
+	// ChildSpan generate a child span of trace, ParentID is the SpanID of trace
 	ChildSpan(trace *TraceContext) *TraceContext
+	// StartSpan 以ctx中的span为父span开始一个新的span，ctx中没有trace时开始新的trace，返回保存了新span的ctx
+	StartSpan(c context.Context, name string, kind string) (context.Context, *TraceContext)
+	// FinishSpan 结束span，采样的span交给导出器导出，重复调用只导出一次
+	// 配置了 trace.sampler.errors 时，没有采样但是出错的span也会导出
+	FinishSpan(trace *TraceContext)
+	// Detach 从ctx(通常是gin.Context)中分离出可以在goroutine中安全使用的context，只带有ctx中的trace
+	// gin.Context在请求结束后会被回收复用，返回的context不依赖它，也不会随着请求结束而取消
+	Detach(c context.Context) context.Context
+	// RegisterExporter 增加一个导出器，配置文件中的导出器在服务创建时注册
+	RegisterExporter(exporter SpanExporter)
 	// ToMap traceContext to map for logger
 	ToMap(trace *TraceContext) map[string]string
 	// ExtractHTTP By Http
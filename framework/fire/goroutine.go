@@ -0,0 +1,94 @@
+// Package fire 提供在业务代码中使用的辅助函数
+package fire
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+type containerKey struct{}
+
+// WithContainer 将服务容器保存到ctx中，在命令行、后台任务等没有gin.Context的地方使用 Go 时需要
+func WithContainer(ctx context.Context, container framework.IContainer) context.Context {
+	return context.WithValue(ctx, containerKey{}, container)
+}
+
+// Container 获取ctx中的服务容器，gin.Context以及由它派生的context使用处理请求的引擎的容器，没有时返回nil
+func Container(ctx context.Context) framework.IContainer {
+	if ginC, ok := ctx.(*gin.Context); ok {
+		return ginC.Container()
+	}
+	if container, ok := ctx.Value(containerKey{}).(framework.IContainer); ok {
+		return container
+	}
+	if ginC, ok := ctx.Value(gin.ContextKey).(*gin.Context); ok {
+		return ginC.Container()
+	}
+	return nil
+}
+
+// Detach 分离出可以在goroutine中安全使用的context，带有ctx中的trace和服务容器
+// 返回的context不依赖gin.Context，也不会随着请求结束而取消
+// 其中的span可能是已经结束的请求span，结束后的span不会再被修改，需要记录耗时等信息时以它为父span开始新的span
+func Detach(ctx context.Context) context.Context {
+	container := Container(ctx)
+	if container == nil {
+		return context.Background()
+	}
+	detached := context.Background()
+	if container.IsBind(contract.TraceKey) {
+		detached = container.MustMake(contract.TraceKey).(contract.Trace).Detach(ctx)
+	}
+	return WithContainer(detached, container)
+}
+
+// Go 在新的goroutine中执行fn，fn的参数是 Detach 得到的context，可以继续使用trace和容器中的服务
+// ctx中带有trace时，为fn开始一个名为goroutine的子span，fn返回时结束，请求span可能已经结束，fn中不会修改它
+// fn中的panic会被恢复，连同堆栈和trace通过日志服务记录，没有绑定日志服务时输出到标准错误
+func Go(ctx context.Context, fn func(ctx context.Context)) {
+	detached := Detach(ctx)
+	container := Container(detached)
+	var tracer contract.Trace
+	var span *contract.TraceContext
+	if container != nil && container.IsBind(contract.TraceKey) {
+		tracer = container.MustMake(contract.TraceKey).(contract.Trace)
+		if tracer.GetTrace(detached) != nil {
+			detached, span = tracer.StartSpan(detached, "goroutine", contract.SpanKindInternal)
+		}
+	}
+	go func() {
+		defer func() {
+			p := recover()
+			if span != nil {
+				if p != nil {
+					span.SetStatus(contract.SpanStatusError, fmt.Sprint(p))
+				}
+				tracer.FinishSpan(span)
+			}
+			if p == nil {
+				return
+			}
+			fields := map[string]interface{}{
+				"error": fmt.Sprint(p),
+				"stack": string(debug.Stack()),
+			}
+			if span != nil {
+				fields[contract.TraceKeyTraceID] = span.TraceID
+				fields[contract.TraceKeySpanID] = span.SpanID
+			}
+			if container == nil || !container.IsBind(contract.FireLogKey) {
+				_, _ = fmt.Fprintln(os.Stderr, "goroutine panic recovered", fields)
+				return
+			}
+			logger := container.MustMake(contract.FireLogKey).(contract.ILog)
+			logger.Error(detached, "goroutine panic recovered", fields)
+		}()
+		fn(detached)
+	}()
+}
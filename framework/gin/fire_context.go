@@ -2,6 +2,8 @@ package gin
 
 import (
 	"context"
+
+	"github.com/YunzeGao/fire/framework"
 )
 
 func (ctx *Context) BaseContext() context.Context {
@@ -24,3 +26,18 @@ func (ctx *Context) MustMake(key string) interface{} {
 func (ctx *Context) MakeNew(key string, params []interface{}) (interface{}, error) {
 	return ctx.container.MakeNew(key, params)
 }
+
+// IsBind 实现isBind的封装
+func (ctx *Context) IsBind(key string) bool {
+	return ctx.container.IsBind(key)
+}
+
+// Engine 获取处理当前请求的引擎
+func (ctx *Context) Engine() *Engine {
+	return ctx.engine
+}
+
+// Container 获取服务容器，请求结束后仍然可以使用
+func (ctx *Context) Container() framework.IContainer {
+	return ctx.container
+}
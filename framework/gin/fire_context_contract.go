@@ -19,3 +19,8 @@ func (c *Context) MustMakeConfig() contract.IConfig {
 func (c *Context) MustMakeLog() contract.ILog {
 	return c.MustMake(contract.FireLogKey).(contract.ILog)
 }
+
+// MustMakeAuth 从容器中获取认证服务
+func (c *Context) MustMakeAuth() contract.IAuth {
+	return c.MustMake(contract.AuthKey).(contract.IAuth)
+}
@@ -247,6 +247,9 @@ func (ctx *Context) DefaultHost() string {
 	return ctx.Request.URL.Host
 }
 
+// ClientIPKey 保存按照受信任代理配置解析出的客户端ip，设置后ClientIP直接返回该值
+const ClientIPKey = "_fire/gin/clientip"
+
 func (ctx *Context) DefaultClientIp() string {
 	return ctx.ClientIP()
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"path/filepath"
 )
 
 type IResponse interface {
@@ -78,18 +79,46 @@ func (ctx *Context) IXml(obj interface{}) IResponse {
 	return ctx
 }
 
+// TemplateFuncsKey 中间件通过 AddTemplateFuncs 为当前请求添加的模版函数
+const TemplateFuncsKey = "_fire/gin/templatefuncs"
+
+// AddTemplateFuncs 为当前请求的IHtml添加模版函数，例如csrf中间件添加的 csrfField
+func (ctx *Context) AddTemplateFuncs(funcs template.FuncMap) {
+	merged := template.FuncMap{}
+	if val, ok := ctx.Get(TemplateFuncsKey); ok {
+		for name, fn := range val.(template.FuncMap) {
+			merged[name] = fn
+		}
+	}
+	for name, fn := range funcs {
+		merged[name] = fn
+	}
+	ctx.Set(TemplateFuncsKey, merged)
+}
+
 func (ctx *Context) IHtml(file string, obj interface{}) IResponse {
-	// 读取模版文件，创建template实例
-	t, err := template.New("output").ParseFiles(file)
+	// 模版函数包括engine.FuncMap和中间件为当前请求添加的函数
+	funcs := template.FuncMap{}
+	if ctx.engine != nil {
+		for name, fn := range ctx.engine.FuncMap {
+			funcs[name] = fn
+		}
+	}
+	if val, ok := ctx.Get(TemplateFuncsKey); ok {
+		for name, fn := range val.(template.FuncMap) {
+			funcs[name] = fn
+		}
+	}
+	// 读取模版文件，创建template实例，模版名称需要和文件名一致才能执行
+	t, err := template.New(filepath.Base(file)).Funcs(funcs).ParseFiles(file)
 	if err != nil {
-		return ctx
+		return ctx.ISetStatus(http.StatusInternalServerError)
 	}
+	ctx.ISetHeader("Content-Type", "text/html; charset=utf-8")
 	// 执行Execute方法将obj和模版进行结合
 	if err := t.Execute(ctx.Writer, obj); err != nil {
 		return ctx
 	}
-
-	ctx.ISetHeader("Content-Type", "application/html")
 	return ctx
 }
 
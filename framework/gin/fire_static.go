@@ -0,0 +1,37 @@
+package gin
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// PrecompressedKey 压缩中间件协商出客户端支持gzip时设置，Static注册的静态文件存在.gz文件时直接返回.gz文件
+const PrecompressedKey = "_fire/gin/precompressed"
+
+// servePrecompressed 返回静态文件对应的.gz文件，不存在时返回false
+func servePrecompressed(c *Context, fs http.FileSystem, name string) bool {
+	if !c.GetBool(PrecompressedKey) || name == "" || strings.HasSuffix(name, "/") {
+		return false
+	}
+	f, err := fs.Open(name + ".gz")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		return false
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	http.ServeContent(c.Writer, c.Request, name, stat.ModTime(), f)
+	return true
+}
@@ -213,6 +213,10 @@ func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileS
 		}
 
 		file := c.Param("filepath")
+		// 客户端支持gzip并且存在预压缩的.gz文件时直接返回
+		if servePrecompressed(c, fs, file) {
+			return
+		}
 		// Check if file exists and/or if we have permission to access it
 		f, err := fs.Open(file)
 		if err != nil {
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// AccessControlRule 定义了一个路由组的ip访问规则，对应配置文件中的 app.access_control.groups.{group}
+type AccessControlRule struct {
+	// Allow 允许访问的ip或者cidr，为空时允许所有不在Deny中的地址
+	Allow []string `yaml:"allow"`
+	// Deny 拒绝访问的ip或者cidr，优先于Allow
+	Deny []string `yaml:"deny"`
+}
+
+// accessControl 解析后的访问规则
+type accessControl struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func newAccessControl(rule AccessControlRule) (*accessControl, error) {
+	allow, err := parseNetworks(rule.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseNetworks(rule.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &accessControl{allow: allow, deny: deny}, nil
+}
+
+// permit 判断ip是否允许访问，无法解析的ip只在没有配置任何规则时允许
+func (ac *accessControl) permit(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return len(ac.allow) == 0 && len(ac.deny) == 0
+	}
+	if containsIP(ac.deny, ip) {
+		return false
+	}
+	return len(ac.allow) == 0 || containsIP(ac.allow, ip)
+}
+
+func (ac *accessControl) handle(c *gin.Context) {
+	if !ac.permit(c.ClientIP()) {
+		RenderError(c, NewHttpError(http.StatusForbidden, "access denied", nil))
+		return
+	}
+	c.Next()
+}
+
+// AccessControl 按照 app.access_control.groups.{group} 的配置限制访问的ip，使用 c.ClientIP() 作为客户端地址
+// 应该注册在ClientIP中间件之后，配置文件修改后不需要重启服务，配置无效时记录日志并继续使用之前的规则
+func AccessControl(group string) gin.HandlerFunc {
+	key := "app.access_control.groups." + group
+	reloader := newConfigReloader(key, func(configService contract.IConfig) (interface{}, error) {
+		rule := AccessControlRule{}
+		if configService.IsExist(key) {
+			if err := configService.Load(key, &rule); err != nil {
+				return nil, err
+			}
+		}
+		return newAccessControl(rule)
+	})
+	return func(c *gin.Context) {
+		ac, ok := reloader.get(c).(*accessControl)
+		if !ok {
+			// 第一次加载的配置就无效时拒绝所有请求，避免在规则缺失的情况下放行
+			RenderError(c, NewHttpError(http.StatusForbidden, "access denied", nil))
+			return
+		}
+		ac.handle(c)
+	}
+}
+
+// AccessControlWithConfig 使用配置创建ip访问控制中间件，配置无效时panic
+func AccessControlWithConfig(rule AccessControlRule) gin.HandlerFunc {
+	ac, err := newAccessControl(rule)
+	if err != nil {
+		panic("access control: " + err.Error())
+	}
+	return ac.handle
+}
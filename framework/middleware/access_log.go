@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// AccessLogModeJson 每个请求输出一条结构化的日志，请求信息放在fields中
+	AccessLogModeJson = "json"
+	// AccessLogModeCombined 使用Apache combined格式作为日志信息
+	AccessLogModeCombined = "combined"
+)
+
+// AccessLogConfig 定义了访问日志中间件的配置，对应配置文件中的 log.access
+type AccessLogConfig struct {
+	// Mode 输出模式，json或者combined，默认json
+	Mode string `yaml:"mode"`
+	// SkipPaths 不记录日志的路径，以*结尾表示前缀匹配
+	SkipPaths []string `yaml:"skip_paths"`
+	// SkipStatus 不记录日志的状态码
+	SkipStatus []int `yaml:"skip_status"`
+	// SlowThreshold 慢请求阈值，例如 500ms，超过阈值的请求使用Warn级别记录
+	SlowThreshold string `yaml:"slow_threshold"`
+
+	slow time.Duration
+}
+
+// skip 判断请求是否不需要记录
+func (conf *AccessLogConfig) skip(path string, status int) bool {
+	for _, s := range conf.SkipStatus {
+		if s == status {
+			return true
+		}
+	}
+	for _, p := range conf.SkipPaths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessLog 访问日志中间件，配置从 log.access 中读取
+func AccessLog() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := AccessLogConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("log.access") {
+				_ = configService.Load("log.access", &conf)
+			}
+			handler = AccessLogWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// AccessLogWithConfig 使用配置创建访问日志中间件，每个请求通过ILog输出一条日志
+// trace_id/span_id 等信息由日志服务从trace服务中获取，所以需要放在Trace中间件之后
+func AccessLogWithConfig(conf AccessLogConfig) gin.HandlerFunc {
+	if conf.Mode == "" {
+		conf.Mode = AccessLogModeJson
+	}
+	if conf.SlowThreshold != "" {
+		conf.slow, _ = time.ParseDuration(conf.SlowThreshold)
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		status := c.Writer.Status()
+		if conf.skip(path, status) {
+			return
+		}
+		latency := time.Since(start)
+		bytesOut := c.Writer.Size()
+		if bytesOut < 0 {
+			bytesOut = 0
+		}
+
+		msg := "access"
+		fields := map[string]interface{}{}
+		if conf.Mode == AccessLogModeCombined {
+			msg = combinedLine(c, start, status, bytesOut)
+			fields["latency_ms"] = float64(latency.Microseconds()) / 1000
+		} else {
+			fields["method"] = c.Request.Method
+			fields["route"] = c.FullPath()
+			fields["path"] = path
+			fields["query"] = c.Request.URL.RawQuery
+			fields["status"] = status
+			fields["latency_ms"] = float64(latency.Microseconds()) / 1000
+			fields["bytes_in"] = c.Request.ContentLength
+			fields["bytes_out"] = bytesOut
+			fields["client_ip"] = c.ClientIP()
+			fields["user_agent"] = c.Request.UserAgent()
+			if errs := c.Errors.ByType(gin.ErrorTypePrivate).String(); errs != "" {
+				fields["errors"] = errs
+			}
+		}
+
+		logger := c.MustMakeLog()
+		if conf.slow > 0 && latency >= conf.slow {
+			fields["slow"] = true
+			logger.Warn(c, msg, fields)
+			return
+		}
+		logger.Info(c, msg, fields)
+	}
+}
+
+// combinedLine 生成Apache combined格式的日志
+func combinedLine(c *gin.Context, start time.Time, status, size int) string {
+	req := c.Request
+	referer := req.Referer()
+	if referer == "" {
+		referer = "-"
+	}
+	userAgent := req.UserAgent()
+	if userAgent == "" {
+		userAgent = "-"
+	}
+	user := "-"
+	if u, _, ok := req.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %d "%s" "%s"`,
+		c.ClientIP(), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		req.Method, req.RequestURI, req.Proto, status, size, referer, userAgent)
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// ContextClaimsKey 认证通过后将token中的声明写入gin.Context的key
+const ContextClaimsKey = "fire:claims"
+
+// bearerToken 从Authorization请求头中获取Bearer token
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Auth JWT认证中间件，校验Authorization: Bearer中的token，通过后将声明写入gin.Context，用户标识写入ContextUserKey
+// 校验失败返回401，错误通过RenderError输出
+func Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			c.ISetHeader("WWW-Authenticate", "Bearer")
+			RenderError(c, NewHttpError(http.StatusUnauthorized, "missing token", nil))
+			return
+		}
+		auth, err := c.Make(contract.AuthKey)
+		if err != nil {
+			RenderError(c, NewHttpError(http.StatusInternalServerError, "", err))
+			return
+		}
+		claims, err := auth.(contract.IAuth).Verify(c, token)
+		if err != nil {
+			message := "invalid token"
+			for _, e := range []error{contract.ErrTokenExpired, contract.ErrTokenMissingExp, contract.ErrTokenNotValidYet,
+				contract.ErrTokenIssuer, contract.ErrTokenAudience} {
+				if errors.Is(err, e) {
+					message = e.Error()
+				}
+			}
+			c.ISetHeader("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+message+`"`)
+			RenderError(c, NewHttpError(http.StatusUnauthorized, message, err))
+			return
+		}
+		c.Set(ContextClaimsKey, claims)
+		if claims.Subject != "" {
+			c.Set(ContextUserKey, claims.Subject)
+		}
+		c.Next()
+	}
+}
+
+// AuthClaims 获取认证中间件写入的声明，没有经过认证时返回nil
+func AuthClaims(c *gin.Context) *contract.Claims {
+	if val, ok := c.Get(ContextClaimsKey); ok {
+		if claims, ok := val.(*contract.Claims); ok {
+			return claims
+		}
+	}
+	return nil
+}
+
+// IssueToken 为登录成功的用户签发token，extra为自定义声明
+func IssueToken(c *gin.Context, subject string, extra map[string]interface{}) (string, error) {
+	return c.MustMakeAuth().Issue(c, &contract.Claims{Subject: subject, Extra: extra})
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// ErrBodyTooLarge 读取的请求体超过了限制
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// BodyLimitConfig 定义了请求体大小限制的配置，对应配置文件中的 app.body_limit
+type BodyLimitConfig struct {
+	// MaxSize 请求体最大字节数，小于等于0表示不限制
+	MaxSize int64 `yaml:"max_size"`
+	// SkipPaths 不限制的路径，例如文件上传，以*结尾表示前缀匹配
+	SkipPaths []string `yaml:"skip_paths"`
+}
+
+// limitedBody 超过限制后读取返回 ErrBodyTooLarge，并且记录下来由中间件返回413
+type limitedBody struct {
+	io.ReadCloser
+	remain   int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	// 多读一个字节用来判断是否超过限制
+	if int64(len(p)) > b.remain+1 {
+		p = p[:b.remain+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remain {
+		b.exceeded = true
+		return int(b.remain), ErrBodyTooLarge
+	}
+	b.remain -= int64(n)
+	return n, err
+}
+
+// BodyLimit 请求体大小限制中间件，配置从 app.body_limit 中读取
+func BodyLimit() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := BodyLimitConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.body_limit") {
+				_ = configService.Load("app.body_limit", &conf)
+			}
+			handler = BodyLimitWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// BodyLimitWithConfig 使用配置创建请求体大小限制中间件
+// Content-Length 超过限制时直接返回413；chunked请求在读取超过限制时返回 ErrBodyTooLarge，
+// handler没有写入响应时由中间件返回413
+func BodyLimitWithConfig(conf BodyLimitConfig) gin.HandlerFunc {
+	skip := AccessLogConfig{SkipPaths: conf.SkipPaths}
+	return func(c *gin.Context) {
+		if conf.MaxSize <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody ||
+			skip.skip(c.Request.URL.Path, 0) {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > conf.MaxSize {
+			// 剩余的请求体不再读取，响应后关闭连接
+			c.Header("Connection", "close")
+			RenderError(c, NewHttpError(http.StatusRequestEntityTooLarge, "request body too large", nil))
+			return
+		}
+		body := &limitedBody{ReadCloser: c.Request.Body, remain: conf.MaxSize}
+		c.Request.Body = body
+		c.Next()
+		if body.exceeded && !c.Writer.Written() {
+			c.Header("Connection", "close")
+			RenderError(c, NewHttpError(http.StatusRequestEntityTooLarge, "request body too large", ErrBodyTooLarge))
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// redactedValue 脱敏后的值
+const redactedValue = "[REDACTED]"
+
+// BodyLogConfig 定义了请求和响应体日志中间件的配置，对应配置文件中的 log.body
+type BodyLogConfig struct {
+	// MaxRequestBody 最多记录的请求体字节数，默认4096
+	MaxRequestBody int `yaml:"max_request_body"`
+	// MaxResponseBody 最多记录的响应体字节数，默认4096
+	MaxResponseBody int `yaml:"max_response_body"`
+	// RedactFields 需要脱敏的json字段和表单字段，不区分大小写，为空时使用默认列表
+	RedactFields []string `yaml:"redact_fields"`
+	// RedactHeaders 需要脱敏的请求头和响应头，为空时使用默认列表
+	RedactHeaders []string `yaml:"redact_headers"`
+	// SampleRate 随机采样的比例，0到1之间，0表示不随机采样
+	SampleRate float64 `yaml:"sample_rate"`
+	// SampleHeader 请求头中这个字段为1或者true时总是记录，为空表示不支持
+	SampleHeader string `yaml:"sample_header"`
+	// SkipPaths 不记录的路径，以*结尾表示前缀匹配
+	SkipPaths []string `yaml:"skip_paths"`
+}
+
+var defaultRedactFields = []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "_csrf"}
+
+var defaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-CSRF-Token", "X-Api-Key"}
+
+// bodyLogWriter 将写入的响应体复制一份到缓存中，超出长度限制的部分不缓存
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (w *bodyLogWriter) capture(data []byte) {
+	if remain := w.max - w.body.Len(); remain > 0 {
+		if len(data) > remain {
+			data = data[:remain]
+			w.truncated = true
+		}
+		w.body.Write(data)
+	} else if len(data) > 0 {
+		w.truncated = true
+	}
+}
+
+func (w *bodyLogWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.capture(data[:n])
+	return n, err
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.capture([]byte(s[:n]))
+	return n, err
+}
+
+// bodyRedactor 根据配置对header和body脱敏
+type bodyRedactor struct {
+	fields  map[string]bool
+	headers map[string]bool
+	// pattern 用于json被截断无法解析时，按照正则替换字符串类型的字段
+	pattern *regexp.Regexp
+}
+
+func newBodyRedactor(fields, headers []string) *bodyRedactor {
+	r := &bodyRedactor{fields: map[string]bool{}, headers: map[string]bool{}}
+	quoted := []string{}
+	for _, f := range fields {
+		r.fields[strings.ToLower(f)] = true
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	for _, h := range headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	if len(quoted) > 0 {
+		r.pattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+	}
+	return r
+}
+
+// header 输出脱敏后的header，多个值使用逗号连接
+func (r *bodyRedactor) header(header http.Header) map[string]string {
+	ret := make(map[string]string, len(header))
+	for k, v := range header {
+		if r.headers[k] {
+			ret[k] = redactedValue
+			continue
+		}
+		ret[k] = strings.Join(v, ", ")
+	}
+	return ret
+}
+
+// value 递归对json中的字段脱敏
+func (r *bodyRedactor) value(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if r.fields[strings.ToLower(k)] {
+				val[k] = redactedValue
+			} else {
+				val[k] = r.value(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = r.value(item)
+		}
+	}
+	return v
+}
+
+// body 根据content type对body脱敏，二进制内容只记录长度
+func (r *bodyRedactor) body(contentType string, content []byte, truncated bool) string {
+	if len(content) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == gin.MIMEJSON || strings.HasSuffix(mediaType, "+json"):
+		if !truncated {
+			var v interface{}
+			if err := json.Unmarshal(content, &v); err == nil {
+				if out, err := json.Marshal(r.value(v)); err == nil {
+					return string(out)
+				}
+			}
+		}
+		if r.pattern != nil {
+			return r.pattern.ReplaceAllString(string(content), `${1}"`+redactedValue+`"`)
+		}
+		return string(content)
+	case mediaType == gin.MIMEPOSTForm:
+		values, err := url.ParseQuery(string(content))
+		if err != nil {
+			return string(content)
+		}
+		redacted := false
+		for k := range values {
+			if r.fields[strings.ToLower(k)] {
+				values[k] = []string{redactedValue}
+				redacted = true
+			}
+		}
+		// 没有需要脱敏的字段时保持原样，避免重新编码改变字段顺序
+		if !redacted {
+			return string(content)
+		}
+		return values.Encode()
+	case strings.HasPrefix(mediaType, "text/"), mediaType == gin.MIMEXML, mediaType == "application/x-ndjson", mediaType == "":
+		return string(content)
+	}
+	return "[binary " + strconv.Itoa(len(content)) + " bytes]"
+}
+
+// BodyLog 请求和响应体日志中间件，配置从 log.body 中读取
+func BodyLog() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := BodyLogConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("log.body") {
+				_ = configService.Load("log.body", &conf)
+			}
+			handler = BodyLogWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// BodyLogWithConfig 使用配置创建请求和响应体日志中间件，被采样的请求通过ILog输出一条日志
+// 请求体只预读取最多 MaxRequestBody 字节，剩余部分仍然由handler流式读取
+// trace_id 由日志服务从trace服务中获取，所以需要放在Trace中间件之后
+func BodyLogWithConfig(conf BodyLogConfig) gin.HandlerFunc {
+	if conf.MaxRequestBody <= 0 {
+		conf.MaxRequestBody = 4096
+	}
+	if conf.MaxResponseBody <= 0 {
+		conf.MaxResponseBody = 4096
+	}
+	if len(conf.RedactFields) == 0 {
+		conf.RedactFields = defaultRedactFields
+	}
+	if len(conf.RedactHeaders) == 0 {
+		conf.RedactHeaders = defaultRedactHeaders
+	}
+	redactor := newBodyRedactor(conf.RedactFields, conf.RedactHeaders)
+	skip := AccessLogConfig{SkipPaths: conf.SkipPaths}
+
+	return func(c *gin.Context) {
+		if skip.skip(c.Request.URL.Path, 0) || !bodyLogSampled(c, conf) {
+			c.Next()
+			return
+		}
+
+		var reqBody []byte
+		reqTruncated := false
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			read, _ := io.ReadAll(io.LimitReader(c.Request.Body, int64(conf.MaxRequestBody)+1))
+			// 已经读取的部分和剩余部分重新组合，handler读到的仍然是完整的请求体
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(read), c.Request.Body), c.Request.Body}
+			reqBody = read
+			if len(read) > conf.MaxRequestBody {
+				reqBody = read[:conf.MaxRequestBody]
+				reqTruncated = true
+			}
+		}
+
+		origin := c.Writer
+		writer := &bodyLogWriter{ResponseWriter: origin, max: conf.MaxResponseBody}
+		c.Writer = writer
+		defer func() {
+			c.Writer = origin
+		}()
+		c.Next()
+
+		fields := map[string]interface{}{
+			"method":             c.Request.Method,
+			"route":              c.FullPath(),
+			"path":               c.Request.URL.Path,
+			"status":             writer.Status(),
+			"request_headers":    redactor.header(c.Request.Header),
+			"request_body":       redactor.body(c.Request.Header.Get("Content-Type"), reqBody, reqTruncated),
+			"response_headers":   redactor.header(writer.Header()),
+			"response_body":      redactor.body(writer.Header().Get("Content-Type"), writer.body.Bytes(), writer.truncated),
+			"request_truncated":  reqTruncated,
+			"response_truncated": writer.truncated,
+		}
+		c.MustMakeLog().Info(c, "body", fields)
+	}
+}
+
+// bodyLogSampled 判断请求是否需要记录
+func bodyLogSampled(c *gin.Context, conf BodyLogConfig) bool {
+	if conf.SampleHeader != "" {
+		if flag, err := strconv.ParseBool(c.GetHeader(conf.SampleHeader)); err == nil && flag {
+			return true
+		}
+	}
+	return conf.SampleRate > 0 && (conf.SampleRate >= 1 || rand.Float64() < conf.SampleRate)
+}
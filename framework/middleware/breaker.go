@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// BreakerClosed 熔断器关闭，请求正常通过
+	BreakerClosed = "closed"
+	// BreakerOpen 熔断器打开，请求直接返回503
+	BreakerOpen = "open"
+	// BreakerHalfOpen 熔断器半开，允许少量探测请求通过
+	BreakerHalfOpen = "half_open"
+)
+
+// breakerBuckets 统计窗口划分的桶数
+const breakerBuckets = 10
+
+// breakerMinWindow 统计窗口的最小值，更短的窗口中请求数太少，错误率没有意义
+const breakerMinWindow = time.Second
+
+// CircuitBreakerConfig 定义了熔断器中间件的配置，对应配置文件中的 app.overload.breaker
+type CircuitBreakerConfig struct {
+	// Name 名称，用于区分管理端口中展示的状态
+	Name string `yaml:"name"`
+	// Window 统计错误率的滑动窗口，默认10s，小于1s时使用默认值
+	Window string `yaml:"window"`
+	// MinRequests 窗口内请求数达到这个值才会计算错误率，为0时不开启
+	MinRequests int `yaml:"min_requests"`
+	// ErrorRate 触发熔断的错误率，取值0到1，默认0.5
+	ErrorRate float64 `yaml:"error_rate"`
+	// OpenTimeout 熔断后经过多久进入半开状态，默认30s
+	OpenTimeout string `yaml:"open_timeout"`
+	// HalfOpenRequests 半开状态下允许的探测请求数，全部成功后关闭熔断器，默认1
+	HalfOpenRequests int `yaml:"half_open_requests"`
+}
+
+// breakerBucket 一个桶内的请求数和错误数
+type breakerBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// circuitBreaker 单个路由的熔断器
+type circuitBreaker struct {
+	lock      sync.Mutex
+	state     string
+	openedAt  time.Time
+	probes    int
+	successes int
+	buckets   [breakerBuckets]breakerBucket
+	trips     int64
+	rejected  int64
+}
+
+// breakerGroup 按照路由划分的一组熔断器
+type breakerGroup struct {
+	window      time.Duration
+	minRequests int
+	errorRate   float64
+	openTimeout time.Duration
+	halfOpen    int
+
+	lock     sync.RWMutex
+	breakers map[string]*circuitBreaker
+}
+
+// get 获取路由对应的熔断器，不存在时创建
+func (g *breakerGroup) get(route string) *circuitBreaker {
+	g.lock.RLock()
+	b, ok := g.breakers[route]
+	g.lock.RUnlock()
+	if ok {
+		return b
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if b, ok = g.breakers[route]; !ok {
+		b = &circuitBreaker{state: BreakerClosed}
+		g.breakers[route] = b
+	}
+	return b
+}
+
+// bucket 获取当前时间所在的桶，过期的桶会被清空
+func (g *breakerGroup) bucket(b *circuitBreaker, now time.Time) *breakerBucket {
+	size := g.window / breakerBuckets
+	start := now.Truncate(size)
+	bucket := &b.buckets[(start.UnixNano()/int64(size))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// allow 判断请求是否可以通过，返回false时需要等待的时间
+func (g *breakerGroup) allow(b *circuitBreaker) (bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	if b.state == BreakerOpen {
+		if wait := g.openTimeout - now.Sub(b.openedAt); wait > 0 {
+			b.rejected++
+			return false, wait
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.successes = 0
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= g.halfOpen {
+			b.rejected++
+			return false, g.openTimeout
+		}
+		b.probes++
+	}
+	return true, 0
+}
+
+// record 记录请求结果，根据错误率和半开状态下的探测结果切换状态
+func (g *breakerGroup) record(b *circuitBreaker, failed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			g.trip(b, now)
+			return
+		}
+		b.successes++
+		if b.successes >= g.halfOpen {
+			b.state = BreakerClosed
+			b.buckets = [breakerBuckets]breakerBucket{}
+		}
+		return
+	case BreakerOpen:
+		return
+	}
+
+	bucket := g.bucket(b, now)
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+	requests, failures := 0, 0
+	for _, item := range b.buckets {
+		if now.Sub(item.start) < g.window {
+			requests += item.requests
+			failures += item.failures
+		}
+	}
+	if requests >= g.minRequests && float64(failures)/float64(requests) >= g.errorRate {
+		g.trip(b, now)
+	}
+}
+
+// trip 打开熔断器
+func (g *breakerGroup) trip(b *circuitBreaker, now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.trips++
+}
+
+// State 所有路由的熔断器状态
+func (g *breakerGroup) State() map[string]interface{} {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	routes := map[string]interface{}{}
+	now := time.Now()
+	for route, b := range g.breakers {
+		b.lock.Lock()
+		requests, failures := 0, 0
+		for _, item := range b.buckets {
+			if now.Sub(item.start) < g.window {
+				requests += item.requests
+				failures += item.failures
+			}
+		}
+		routes[route] = map[string]interface{}{
+			"state":    b.state,
+			"requests": requests,
+			"failures": failures,
+			"trips":    b.trips,
+			"rejected": b.rejected,
+		}
+		b.lock.Unlock()
+	}
+	return map[string]interface{}{
+		"window_ms":       g.window.Milliseconds(),
+		"min_requests":    g.minRequests,
+		"error_rate":      g.errorRate,
+		"open_timeout_ms": g.openTimeout.Milliseconds(),
+		"routes":          routes,
+	}
+}
+
+// CircuitBreaker 按路由熔断的中间件，配置从 app.overload.breaker 中读取
+func CircuitBreaker() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := CircuitBreakerConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.overload.breaker") {
+				_ = configService.Load("app.overload.breaker", &conf)
+			}
+			handler = CircuitBreakerWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// CircuitBreakerWithConfig 使用配置创建熔断器中间件，每个路由使用单独的熔断器
+// 返回5xx或者panic的请求视为失败，窗口内错误率超过阈值时熔断，熔断期间直接返回503
+func CircuitBreakerWithConfig(conf CircuitBreakerConfig) gin.HandlerFunc {
+	if conf.MinRequests <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	if conf.Name == "" {
+		conf.Name = "default"
+	}
+	group := &breakerGroup{
+		window:      10 * time.Second,
+		minRequests: conf.MinRequests,
+		errorRate:   conf.ErrorRate,
+		openTimeout: 30 * time.Second,
+		halfOpen:    conf.HalfOpenRequests,
+		breakers:    map[string]*circuitBreaker{},
+	}
+	if window, err := time.ParseDuration(conf.Window); err == nil && window >= breakerMinWindow {
+		group.window = window
+	}
+	if timeout, err := time.ParseDuration(conf.OpenTimeout); err == nil && timeout > 0 {
+		group.openTimeout = timeout
+	}
+	if group.errorRate <= 0 || group.errorRate > 1 {
+		group.errorRate = 0.5
+	}
+	if group.halfOpen <= 0 {
+		group.halfOpen = 1
+	}
+	registerOverloadState("breaker:"+conf.Name, group)
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			c.Next()
+			return
+		}
+		b := group.get(c.Request.Method + " " + route)
+		if ok, wait := group.allow(b); !ok {
+			renderOverload(c, wait, "circuit breaker is open")
+			return
+		}
+		finished := false
+		defer func() {
+			group.record(b, !finished || c.Writer.Status() >= 500)
+		}()
+		c.Next()
+		finished = true
+	}
+}
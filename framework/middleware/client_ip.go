@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// 携带客户端ip的请求头
+const (
+	// HeaderForwarded RFC 7239，例如 Forwarded: for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"
+	HeaderForwarded = "Forwarded"
+	// HeaderXForwardedFor 例如 X-Forwarded-For: 192.0.2.60, 10.0.0.1
+	HeaderXForwardedFor = "X-Forwarded-For"
+	// HeaderXRealIP 例如 X-Real-IP: 192.0.2.60
+	HeaderXRealIP = "X-Real-IP"
+)
+
+// ClientIPConfig 定义了客户端ip的解析方式，对应配置文件中的 app.client_ip
+type ClientIPConfig struct {
+	// TrustedProxies 受信任的代理ip或者cidr，为空时不信任任何代理，直接使用连接的地址
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Headers 依次读取的请求头，使用第一个存在的，支持 Forwarded、X-Forwarded-For 和 X-Real-IP
+	Headers []string `yaml:"headers"`
+}
+
+// clientIPResolver 按照受信任代理解析客户端ip
+type clientIPResolver struct {
+	proxies []*net.IPNet
+	headers []string
+}
+
+// parseNetworks 解析ip或者cidr列表，有无效的项时返回错误
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		network := parseNetwork(item)
+		if network == nil {
+			return nil, fmt.Errorf("invalid ip or cidr %q", item)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// containsIP ip是否在任意一个网段中
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func newClientIPResolver(conf ClientIPConfig) (*clientIPResolver, error) {
+	proxies, err := parseNetworks(conf.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	resolver := &clientIPResolver{proxies: proxies}
+	for _, header := range conf.Headers {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		switch header {
+		case HeaderForwarded, HeaderXForwardedFor, http.CanonicalHeaderKey(HeaderXRealIP):
+			resolver.headers = append(resolver.headers, header)
+		default:
+			return nil, fmt.Errorf("unsupported client ip header %q", header)
+		}
+	}
+	return resolver, nil
+}
+
+// resolve 连接地址是受信任代理时，从右向左遍历请求头中的地址，跳过受信任的代理，第一个不受信任的地址就是客户端ip
+// 请求头中有无法解析的地址时停止遍历，使用最后一个可信的地址
+func (r *clientIPResolver) resolve(req *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(req.RemoteAddr)
+	}
+	client := net.ParseIP(host)
+	if client == nil {
+		return ""
+	}
+	if !containsIP(r.proxies, client) {
+		return client.String()
+	}
+	for _, header := range r.headers {
+		values := req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		var chain []string
+		if header == HeaderForwarded {
+			chain = forwardedFor(values)
+		} else {
+			for _, value := range values {
+				chain = append(chain, strings.Split(value, ",")...)
+			}
+		}
+		for i := len(chain) - 1; i >= 0 && containsIP(r.proxies, client); i-- {
+			ip := parseForwardedIP(chain[i])
+			if ip == nil {
+				break
+			}
+			client = ip
+		}
+		break
+	}
+	return client.String()
+}
+
+// forwardedFor 按顺序取出 Forwarded 请求头每个元素中的for参数，没有for参数的元素使用空字符串
+func forwardedFor(values []string) []string {
+	var ret []string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			node := ""
+			for _, pair := range splitQuoted(element, ';') {
+				if i := strings.Index(pair, "="); i > 0 && strings.EqualFold(strings.TrimSpace(pair[:i]), "for") {
+					node = pair[i+1:]
+				}
+			}
+			ret = append(ret, node)
+		}
+	}
+	return ret
+}
+
+// splitQuoted 按照分隔符拆分，忽略引号中的分隔符
+func splitQuoted(s string, sep byte) []string {
+	var ret []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				ret = append(ret, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(ret, s[start:])
+}
+
+// parseForwardedIP 解析请求头中的一个地址，支持带引号、端口和 [ipv6]:port 的形式，unknown和混淆的标识返回nil
+func parseForwardedIP(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return nil
+		}
+		s = s[1:end]
+	} else if strings.Count(s, ":") == 1 {
+		s = s[:strings.Index(s, ":")]
+	}
+	return net.ParseIP(s)
+}
+
+// ClientIP 按照 app.client_ip 配置解析客户端ip，解析后 c.ClientIP() 和 c.DefaultClientIp() 都返回该值
+// 配置文件修改后不需要重启服务，应该注册在其它中间件之前
+func ClientIP() gin.HandlerFunc {
+	reloader := newConfigReloader("app.client_ip", func(configService contract.IConfig) (interface{}, error) {
+		conf := ClientIPConfig{}
+		if configService.IsExist("app.client_ip") {
+			if err := configService.Load("app.client_ip", &conf); err != nil {
+				return nil, err
+			}
+		}
+		// 默认值在加载之后设置，mapstructure解码slice时会保留超出配置长度的默认元素
+		if len(conf.Headers) == 0 {
+			conf.Headers = []string{HeaderXForwardedFor, HeaderXRealIP}
+		}
+		return newClientIPResolver(conf)
+	})
+	return func(c *gin.Context) {
+		if resolver, ok := reloader.get(c).(*clientIPResolver); ok {
+			c.Set(gin.ClientIPKey, resolver.resolve(c.Request))
+		}
+		c.Next()
+	}
+}
+
+// ClientIPWithConfig 使用配置创建客户端ip解析中间件，配置无效时panic
+func ClientIPWithConfig(conf ClientIPConfig) gin.HandlerFunc {
+	resolver, err := newClientIPResolver(conf)
+	if err != nil {
+		panic("client ip: " + err.Error())
+	}
+	return func(c *gin.Context) {
+		c.Set(gin.ClientIPKey, resolver.resolve(c.Request))
+		c.Next()
+	}
+}
@@ -0,0 +1,391 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// CompressEncoder 定义了压缩编码器，gzip.Writer、zlib.Writer 以及常见的brotli、zstd实现都满足这个接口
+type CompressEncoder interface {
+	io.WriteCloser
+	// Flush 将已经压缩的数据写入下层的writer
+	Flush() error
+	// Reset 重置编码器，写入新的writer，用于复用编码器
+	Reset(w io.Writer)
+}
+
+// CompressEncoderFunc 创建一个压缩编码器
+type CompressEncoderFunc func(w io.Writer, level int) (CompressEncoder, error)
+
+var compressLock sync.RWMutex
+
+// compressEncodings 支持的编码，按照优先级从高到低排列
+var compressEncodings = []string{"gzip", "deflate"}
+
+var compressEncoders = map[string]CompressEncoderFunc{
+	"gzip": func(w io.Writer, level int) (CompressEncoder, error) {
+		return gzip.NewWriterLevel(w, level)
+	},
+	// HTTP的deflate编码是带有zlib头的格式(RFC 9110 8.4.1.2)，不是原始的DEFLATE数据
+	"deflate": func(w io.Writer, level int) (CompressEncoder, error) {
+		return zlib.NewWriterLevel(w, level)
+	},
+}
+
+// RegisterCompressEncoder 注册额外的压缩编码，例如 br、zstd，后注册的编码优先级更高
+// 需要在创建压缩中间件之前注册
+func RegisterCompressEncoder(encoding string, fn CompressEncoderFunc) {
+	compressLock.Lock()
+	defer compressLock.Unlock()
+	encoding = strings.ToLower(encoding)
+	if _, ok := compressEncoders[encoding]; !ok {
+		compressEncodings = append([]string{encoding}, compressEncodings...)
+	}
+	compressEncoders[encoding] = fn
+}
+
+// defaultCompressExcludeTypes 默认不压缩的content type，这些内容已经压缩过或者需要实时推送
+var defaultCompressExcludeTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/x-bzip2", "application/wasm", "application/pdf",
+	"text/event-stream",
+}
+
+// CompressConfig 定义了压缩中间件的配置，对应配置文件中的 app.compress
+type CompressConfig struct {
+	// Level 压缩级别，-1为默认级别，1最快，9压缩率最高
+	Level int `yaml:"level"`
+	// MinLength 响应体小于这个长度时不压缩，默认1024
+	MinLength int `yaml:"min_length"`
+	// ExcludeContentTypes 不压缩的content type前缀，为空时使用默认的列表
+	ExcludeContentTypes []string `yaml:"exclude_content_types"`
+	// ExcludePaths 不压缩的路径，以*结尾表示前缀匹配
+	ExcludePaths []string `yaml:"exclude_paths"`
+	// Precompressed 是否为Static注册的静态文件返回预压缩的.gz文件
+	Precompressed bool `yaml:"precompressed"`
+}
+
+// compressOptions 中间件初始化后的配置
+type compressOptions struct {
+	minLength    int
+	excludeTypes []string
+	excludePaths []string
+	encodings    []string
+	pools        map[string]*sync.Pool
+}
+
+// excludeType 判断content type是否不需要压缩，image/svg+xml 例外
+func (o *compressOptions) excludeType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "image/svg+xml") {
+		return false
+	}
+	for _, t := range o.excludeTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludePath 判断路径是否不需要压缩
+func (o *compressOptions) excludePath(path string) bool {
+	for _, p := range o.excludePaths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptEncodings 解析Accept-Encoding，返回每种编码的q值
+func acceptEncodings(header string) map[string]float64 {
+	ret := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		q := 1.0
+		name := part
+		if i := strings.Index(part, ";"); i >= 0 {
+			name = strings.TrimSpace(part[:i])
+			for _, param := range strings.Split(part[i+1:], ";") {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						q = v
+					}
+				}
+			}
+		}
+		ret[strings.ToLower(name)] = q
+	}
+	return ret
+}
+
+// negotiate 选择q值最高的编码，q值相同时按照编码的优先级
+func (o *compressOptions) negotiate(accepts map[string]float64) string {
+	best, bestQ := "", 0.0
+	for _, encoding := range o.encodings {
+		q, ok := accepts[encoding]
+		if !ok {
+			q, ok = accepts["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter 在写入的数据达到MinLength之后再决定是否压缩
+type compressWriter struct {
+	gin.ResponseWriter
+
+	opts     *compressOptions
+	request  *http.Request
+	encoding string
+
+	buf     []byte
+	size    int
+	written bool
+	decided bool
+	encoder CompressEncoder
+}
+
+var _ gin.ResponseWriter = (*compressWriter)(nil)
+
+// decide 根据状态码、响应头和已经写入的数据决定是否压缩，并且写入缓存的数据
+func (w *compressWriter) decide(flushing bool) error {
+	w.decided = true
+	if w.shouldCompress(flushing) {
+		encoder := w.opts.pools[w.encoding].Get().(CompressEncoder)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+		header := w.Header()
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		// 压缩后的内容和原内容不同，强ETag需要改为弱ETag
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// shouldCompress 判断是否需要压缩，可能压缩的内容都会带上 Vary: Accept-Encoding
+func (w *compressWriter) shouldCompress(flushing bool) bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent ||
+		status == http.StatusPartialContent || status == http.StatusNotModified ||
+		w.request.Method == http.MethodHead {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" && len(w.buf) > 0 {
+		contentType = http.DetectContentType(w.buf)
+		header.Set("Content-Type", contentType)
+	}
+	if w.opts.excludeType(contentType) {
+		return false
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if w.encoding == "" {
+		return false
+	}
+	// 调用Flush说明是流式输出，即使当前数据较少也需要压缩
+	return flushing || len(w.buf) >= w.opts.minLength
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.written = true
+	w.size += len(data)
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.opts.minLength {
+			return len(data), nil
+		}
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 立刻写入响应头，之后写入的内容不会再压缩
+func (w *compressWriter) WriteHeaderNow() {
+	w.written = true
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *compressWriter) Written() bool {
+	return w.written || w.ResponseWriter.Written()
+}
+
+// Size 返回handler写入的未压缩的字节数
+func (w *compressWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.size
+}
+
+// Flush 支持流式输出和SSE，已经压缩的数据会立刻发送给客户端
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.Hijack()
+}
+
+// finish 写入剩余的数据并关闭编码器
+func (w *compressWriter) finish() {
+	if !w.decided && w.written {
+		_ = w.decide(false)
+	}
+	w.release()
+}
+
+// release 关闭编码器并放回池中
+func (w *compressWriter) release() {
+	if w.encoder == nil {
+		return
+	}
+	_ = w.encoder.Close()
+	w.encoder.Reset(io.Discard)
+	w.opts.pools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+}
+
+// Compress 压缩中间件，配置从 app.compress 中读取
+func Compress() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := CompressConfig{Level: gzip.DefaultCompression}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.compress") {
+				_ = configService.Load("app.compress", &conf)
+			}
+			handler = CompressWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// CompressWithConfig 使用配置创建压缩中间件，根据Accept-Encoding选择gzip、deflate或者注册的其他编码
+// 已经设置了Content-Encoding的响应、小于MinLength的响应和已经压缩过的content type不会压缩
+func CompressWithConfig(conf CompressConfig) gin.HandlerFunc {
+	if conf.Level < flate.HuffmanOnly || conf.Level > flate.BestCompression {
+		conf.Level = flate.DefaultCompression
+	}
+	opts := &compressOptions{
+		minLength:    conf.MinLength,
+		excludeTypes: conf.ExcludeContentTypes,
+		excludePaths: conf.ExcludePaths,
+		pools:        map[string]*sync.Pool{},
+	}
+	if opts.minLength <= 0 {
+		opts.minLength = 1024
+	}
+	if len(opts.excludeTypes) == 0 {
+		opts.excludeTypes = defaultCompressExcludeTypes
+	}
+	compressLock.RLock()
+	for _, encoding := range compressEncodings {
+		fn := compressEncoders[encoding]
+		// 提前检查编码器是否可以创建，不能创建的编码不参与协商
+		if _, err := fn(io.Discard, conf.Level); err != nil {
+			continue
+		}
+		opts.encodings = append(opts.encodings, encoding)
+		opts.pools[encoding] = &sync.Pool{New: func() interface{} {
+			encoder, _ := fn(io.Discard, conf.Level)
+			return encoder
+		}}
+	}
+	compressLock.RUnlock()
+
+	return func(c *gin.Context) {
+		if opts.excludePath(c.Request.URL.Path) || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		accepts := acceptEncodings(c.GetHeader("Accept-Encoding"))
+		if conf.Precompressed {
+			if q, ok := accepts["gzip"]; ok && q > 0 {
+				c.Set(gin.PrecompressedKey, true)
+			}
+		}
+		origin := c.Writer
+		writer := &compressWriter{
+			ResponseWriter: origin,
+			opts:           opts,
+			request:        c.Request,
+			encoding:       opts.negotiate(accepts),
+		}
+		c.Writer = writer
+		finished := false
+		defer func() {
+			c.Writer = origin
+			if finished {
+				writer.finish()
+				return
+			}
+			// handler panic时丢弃未发送的数据，由Recovery输出错误
+			writer.buf = nil
+			writer.release()
+		}()
+		c.Next()
+		finished = true
+	}
+}
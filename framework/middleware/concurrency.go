@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// ConcurrencyConfig 定义了并发限制中间件的配置，对应配置文件中的 app.overload.concurrency
+type ConcurrencyConfig struct {
+	// Name 名称，用于区分管理端口中展示的状态
+	Name string `yaml:"name"`
+	// MaxInFlight 同时处理的最大请求数，为0时不限制
+	MaxInFlight int `yaml:"max_in_flight"`
+	// MaxQueue 等待队列的长度，队列满时直接返回503
+	MaxQueue int `yaml:"max_queue"`
+	// QueueTimeout 在队列中等待的最长时间，例如 1s，默认1s
+	QueueTimeout string `yaml:"queue_timeout"`
+}
+
+// concurrencyLimiter 使用带缓冲的channel作为信号量
+type concurrencyLimiter struct {
+	sem      chan struct{}
+	maxQueue int64
+	timeout  time.Duration
+
+	queued   int64
+	total    int64
+	rejected int64
+}
+
+// acquire 获取一个处理名额，没有空闲名额时进入队列等待
+func (l *concurrencyLimiter) acquire(c *gin.Context) bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if atomic.AddInt64(&l.queued, 1) > l.maxQueue {
+		atomic.AddInt64(&l.queued, -1)
+		return false
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-c.Request.Context().Done():
+		return false
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	<-l.sem
+}
+
+// State 当前状态
+func (l *concurrencyLimiter) State() map[string]interface{} {
+	return map[string]interface{}{
+		"max_in_flight": cap(l.sem),
+		"max_queue":     l.maxQueue,
+		"in_flight":     len(l.sem),
+		"queued":        atomic.LoadInt64(&l.queued),
+		"total":         atomic.LoadInt64(&l.total),
+		"rejected":      atomic.LoadInt64(&l.rejected),
+	}
+}
+
+// ConcurrencyLimit 并发限制中间件，配置从 app.overload.concurrency 中读取
+func ConcurrencyLimit() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := ConcurrencyConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.overload.concurrency") {
+				_ = configService.Load("app.overload.concurrency", &conf)
+			}
+			handler = ConcurrencyLimitWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// ConcurrencyLimitWithConfig 使用配置创建并发限制中间件
+// 处理中的请求达到 MaxInFlight 时，新请求进入队列等待，队列已满或者等待超时返回503
+func ConcurrencyLimitWithConfig(conf ConcurrencyConfig) gin.HandlerFunc {
+	if conf.MaxInFlight <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	if conf.Name == "" {
+		conf.Name = "default"
+	}
+	limiter := &concurrencyLimiter{
+		sem:      make(chan struct{}, conf.MaxInFlight),
+		maxQueue: int64(conf.MaxQueue),
+		timeout:  time.Second,
+	}
+	if timeout, err := time.ParseDuration(conf.QueueTimeout); err == nil && timeout > 0 {
+		limiter.timeout = timeout
+	}
+	registerOverloadState("concurrency:"+conf.Name, limiter)
+
+	return func(c *gin.Context) {
+		atomic.AddInt64(&limiter.total, 1)
+		if !limiter.acquire(c) {
+			atomic.AddInt64(&limiter.rejected, 1)
+			renderOverload(c, limiter.timeout, "server is busy")
+			return
+		}
+		defer limiter.release()
+		c.Next()
+	}
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// CorsConfig 定义了跨域中间件的配置，对应配置文件中的 app.cors
+type CorsConfig struct {
+	// AllowOrigins 允许的来源，支持 * 、通配符 https://*.example.com 和正则 regex:^https://.*$
+	AllowOrigins []string `yaml:"allow_origins"`
+	// AllowMethods 允许的方法，默认 GET/POST/PUT/PATCH/DELETE/HEAD/OPTIONS
+	AllowMethods []string `yaml:"allow_methods"`
+	// AllowHeaders 允许的请求头，为空时使用预检请求中的 Access-Control-Request-Headers
+	AllowHeaders []string `yaml:"allow_headers"`
+	// ExposeHeaders 允许浏览器读取的响应头
+	ExposeHeaders []string `yaml:"expose_headers"`
+	// AllowCredentials 是否允许携带cookie，AllowOrigins 包含 * 时不生效，否则任意网站都可以读取用户登录后的响应
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// MaxAge 预检请求的缓存时间，单位秒
+	MaxAge int `yaml:"max_age"`
+}
+
+// corsOrigins 编译后的来源匹配规则
+type corsOrigins struct {
+	all      bool
+	exact    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// newCorsOrigins 编译来源匹配规则，通配符中的*匹配一级或多级子域名
+func newCorsOrigins(origins []string) *corsOrigins {
+	ret := &corsOrigins{exact: map[string]bool{}}
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "*":
+			ret.all = true
+		case strings.HasPrefix(origin, "regex:"):
+			if re, err := regexp.Compile(strings.TrimPrefix(origin, "regex:")); err == nil {
+				ret.patterns = append(ret.patterns, re)
+			}
+		case strings.Contains(origin, "*"):
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(origin)), `\*`, `[a-z0-9.-]+`)
+			ret.patterns = append(ret.patterns, regexp.MustCompile("^"+pattern+"$"))
+		case origin != "":
+			ret.exact[strings.ToLower(origin)] = true
+		}
+	}
+	return ret
+}
+
+// match 判断来源是否允许
+func (o *corsOrigins) match(origin string) bool {
+	if o.all {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if o.exact[origin] {
+		return true
+	}
+	for _, re := range o.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cors 跨域中间件，配置从 app.cors 中读取
+func Cors() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := CorsConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.cors") {
+				_ = configService.Load("app.cors", &conf)
+			}
+			handler = CorsWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// CorsWithConfig 使用配置创建跨域中间件，预检请求在中间件中直接返回204
+// 需要通过 engine.Use 注册，这样没有注册OPTIONS路由的预检请求也会经过这个中间件
+// 允许全部来源时拒绝携带cookie，关闭 AllowCredentials 并在第一个请求时记录错误日志
+func CorsWithConfig(conf CorsConfig) gin.HandlerFunc {
+	origins := newCorsOrigins(conf.AllowOrigins)
+	var rejectOnce sync.Once
+	rejectCredentials := origins.all && conf.AllowCredentials
+	if rejectCredentials {
+		conf.AllowCredentials = false
+	}
+	if len(conf.AllowMethods) == 0 {
+		conf.AllowMethods = []string{
+			http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodHead, http.MethodOptions,
+		}
+	}
+	allowMethods := strings.ToUpper(strings.Join(conf.AllowMethods, ", "))
+	allowHeaders := strings.Join(conf.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(conf.ExposeHeaders, ", ")
+	wildcard := origins.all
+
+	return func(c *gin.Context) {
+		if rejectCredentials {
+			rejectOnce.Do(func() {
+				c.MustMakeLog().Error(c, "cors: allow_credentials is ignored when allow_origins contains *", nil)
+			})
+		}
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !origins.match(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if wildcard {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if conf.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+		} else if requestHeaders := c.GetHeader("Access-Control-Request-Headers"); requestHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+		if conf.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(conf.MaxAge))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -1,19 +1,21 @@
 package middleware
 
 import (
-	"log"
 	"time"
 
 	"github.com/YunzeGao/fire/framework/gin"
 )
 
+// Cost 记录请求的耗时，通过日志服务输出
+// 需要完整的访问日志请使用 AccessLog
 func Cost() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		start := time.Now()
 		ctx.Next()
-		end := time.Now()
-		cost := end.Sub(start)
-		log.Printf("api uri: %v, cost: %.6f 秒", ctx.DefaultUri(), cost.Seconds())
-		return
+		cost := time.Since(start)
+		ctx.MustMakeLog().Debug(ctx, "api cost", map[string]interface{}{
+			"uri":  ctx.DefaultUri(),
+			"cost": cost.Seconds(),
+		})
 	}
 }
@@ -0,0 +1,337 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// CsrfModeSynchronizer token保存在session中，需要在Session中间件之后使用
+	CsrfModeSynchronizer = "synchronizer"
+	// CsrfModeDoubleSubmit token保存在cookie中，提交的token需要和cookie一致
+	CsrfModeDoubleSubmit = "double_submit"
+
+	// ContextCsrfKey csrf中间件将当前请求的token写入gin.Context的key
+	ContextCsrfKey = "fire:csrf"
+
+	// csrfSessionKey synchronizer模式下token在session中的key
+	csrfSessionKey = "_csrf_token"
+	// csrfTokenLength token的字节数
+	csrfTokenLength = 32
+)
+
+// CsrfConfig 定义了csrf中间件的配置，对应配置文件中的 app.csrf
+type CsrfConfig struct {
+	// Mode synchronizer 或者 double_submit，默认 synchronizer
+	Mode string `yaml:"mode"`
+	// FieldName 表单中token的字段名，默认 _csrf
+	FieldName string `yaml:"field_name"`
+	// HeaderName ajax请求携带token的请求头，默认 X-CSRF-Token
+	HeaderName string `yaml:"header_name"`
+	// CookieName double_submit模式下的cookie名称，默认 fire_csrf
+	CookieName string `yaml:"cookie_name"`
+	// CookieSecure cookie是否只在https中发送，same_site为none时总是为true
+	CookieSecure bool `yaml:"cookie_secure"`
+	// SameSite cookie的SameSite属性: lax、strict 或者 none，默认lax
+	SameSite string `yaml:"same_site"`
+	// Secret double_submit模式下对cookie中的token签名，避免子域名写入的cookie被接受
+	Secret string `yaml:"secret"`
+	// ExemptPaths 不校验的路径，以*结尾表示前缀匹配
+	ExemptPaths []string `yaml:"exempt_paths"`
+	// SkipBearer 携带 Authorization: Bearer 的请求不是通过cookie认证的，不需要校验
+	SkipBearer bool `yaml:"skip_bearer"`
+}
+
+// csrfSafeMethod 不会修改状态的请求方法不需要校验
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// csrfExempt 判断路径是否不需要校验，支持请求路径和路由路径
+func csrfExempt(paths []string, c *gin.Context) bool {
+	for _, p := range paths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(c.Request.URL.Path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if p == c.Request.URL.Path || p == c.FullPath() {
+			return true
+		}
+	}
+	return false
+}
+
+// newCsrfToken 生成随机token
+func newCsrfToken() []byte {
+	b := make([]byte, csrfTokenLength)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// maskCsrfToken 每次输出时使用随机的pad与token异或，避免响应压缩导致token被BREACH攻击猜出
+func maskCsrfToken(token []byte) string {
+	pad := newCsrfToken()
+	masked := make([]byte, csrfTokenLength*2)
+	copy(masked, pad)
+	for i := 0; i < csrfTokenLength; i++ {
+		masked[csrfTokenLength+i] = pad[i] ^ token[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCsrfToken 还原提交的token，同时支持没有mask的token，例如js从没有签名的cookie中读取的token
+func unmaskCsrfToken(value string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	switch len(b) {
+	case csrfTokenLength:
+		return b
+	case csrfTokenLength * 2:
+		token := make([]byte, csrfTokenLength)
+		for i := 0; i < csrfTokenLength; i++ {
+			token[i] = b[i] ^ b[csrfTokenLength+i]
+		}
+		return token
+	}
+	return nil
+}
+
+// csrfHandler 保存初始化后的配置
+type csrfHandler struct {
+	conf     CsrfConfig
+	sameSite http.SameSite
+}
+
+// signCookie 对cookie中的token签名
+func (h *csrfHandler) signCookie(token []byte) string {
+	value := base64.RawURLEncoding.EncodeToString(token)
+	if h.conf.Secret == "" {
+		return value
+	}
+	mac := hmac.New(sha256.New, []byte(h.conf.Secret))
+	mac.Write(token)
+	return value + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseCookie 解析并校验cookie中的token
+func (h *csrfHandler) parseCookie(value string) []byte {
+	if h.conf.Secret == "" {
+		token, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(token) != csrfTokenLength {
+			return nil
+		}
+		return token
+	}
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	token, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(token) != csrfTokenLength {
+		return nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(h.conf.Secret))
+	mac.Write(token)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil
+	}
+	return token
+}
+
+// current 获取当前请求已经存在的token，不存在时返回nil，不会修改session或者cookie
+func (h *csrfHandler) current(c *gin.Context) []byte {
+	if h.conf.Mode == CsrfModeSynchronizer {
+		session := GetSession(c)
+		if session == nil {
+			return nil
+		}
+		if token, err := base64.RawURLEncoding.DecodeString(session.GetString(csrfSessionKey)); err == nil &&
+			len(token) == csrfTokenLength {
+			return token
+		}
+		return nil
+	}
+	if cookie, err := c.Cookie(h.conf.CookieName); err == nil {
+		return h.parseCookie(cookie)
+	}
+	return nil
+}
+
+// token 获取当前请求对应的token，不存在时生成新的token并保存到session或者cookie
+func (h *csrfHandler) token(c *gin.Context) ([]byte, error) {
+	if token := h.current(c); token != nil {
+		return token, nil
+	}
+	token := newCsrfToken()
+	if h.conf.Mode == CsrfModeSynchronizer {
+		session := GetSession(c)
+		if session == nil {
+			return nil, errCsrfSession
+		}
+		session.Set(csrfSessionKey, base64.RawURLEncoding.EncodeToString(token))
+		return token, nil
+	}
+	// js需要读取cookie放到请求头中，所以不能设置HttpOnly
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     h.conf.CookieName,
+		Value:    h.signCookie(token),
+		Path:     "/",
+		Secure:   h.conf.CookieSecure,
+		HttpOnly: false,
+		SameSite: h.sameSite,
+	})
+	return token, nil
+}
+
+// submitted 获取请求中提交的token，请求头优先
+// double_submit模式下js可以直接回传cookie的值，配置了secret时cookie的值带有签名，校验签名后使用其中的token
+func (h *csrfHandler) submitted(c *gin.Context) []byte {
+	value := c.GetHeader(h.conf.HeaderName)
+	if value == "" {
+		value = c.PostForm(h.conf.FieldName)
+	}
+	if value == "" {
+		return nil
+	}
+	if h.conf.Mode == CsrfModeDoubleSubmit && h.conf.Secret != "" && strings.Contains(value, ".") {
+		return h.parseCookie(value)
+	}
+	return unmaskCsrfToken(value)
+}
+
+// csrfState 当前请求的token，第一次使用时才获取
+// synchronizer模式下只有模版函数或者CsrfToken需要token时才生成并保存到session，没有session的请求不会因此创建session
+type csrfState struct {
+	once  sync.Once
+	load  func() ([]byte, error)
+	token []byte
+	err   error
+}
+
+func (s *csrfState) get() ([]byte, error) {
+	s.once.Do(func() {
+		s.token, s.err = s.load()
+	})
+	return s.token, s.err
+}
+
+var errCsrfSession = NewHttpError(http.StatusInternalServerError, "csrf synchronizer mode requires session middleware", nil)
+
+// Csrf csrf中间件，配置从 app.csrf 中读取
+func Csrf() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := CsrfConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.csrf") {
+				_ = configService.Load("app.csrf", &conf)
+			}
+			handler = CsrfWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// CsrfWithConfig 使用配置创建csrf中间件
+// GET/HEAD/OPTIONS/TRACE请求不校验，其他请求需要通过请求头或者表单字段提交token，校验失败返回403
+// 模版中可以使用 {{csrfToken}} 获取token，{{csrfField}} 输出隐藏的表单字段
+// synchronizer模式下token在第一次使用时生成，double_submit模式下每个请求都会确保cookie存在，供js读取
+func CsrfWithConfig(conf CsrfConfig) gin.HandlerFunc {
+	if conf.Mode != CsrfModeDoubleSubmit {
+		conf.Mode = CsrfModeSynchronizer
+	}
+	if conf.FieldName == "" {
+		conf.FieldName = "_csrf"
+	}
+	if conf.HeaderName == "" {
+		conf.HeaderName = "X-CSRF-Token"
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = "fire_csrf"
+	}
+	h := &csrfHandler{conf: conf, sameSite: http.SameSiteLaxMode}
+	switch strings.ToLower(conf.SameSite) {
+	case "strict":
+		h.sameSite = http.SameSiteStrictMode
+	case "none":
+		// 浏览器要求SameSite=None的cookie必须设置Secure
+		h.sameSite = http.SameSiteNoneMode
+		h.conf.CookieSecure = true
+	}
+
+	return func(c *gin.Context) {
+		if csrfExempt(h.conf.ExemptPaths, c) {
+			c.Next()
+			return
+		}
+		if h.conf.SkipBearer && bearerToken(c) != "" {
+			c.Next()
+			return
+		}
+		if h.conf.Mode == CsrfModeSynchronizer && GetSession(c) == nil {
+			RenderError(c, errCsrfSession)
+			return
+		}
+		state := &csrfState{load: func() ([]byte, error) {
+			return h.token(c)
+		}}
+		if h.conf.Mode == CsrfModeDoubleSubmit {
+			_, _ = state.get()
+		}
+		c.Set(ContextCsrfKey, state)
+		c.AddTemplateFuncs(template.FuncMap{
+			"csrfToken": func() string {
+				return CsrfToken(c)
+			},
+			"csrfField": func() template.HTML {
+				return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(h.conf.FieldName) +
+					`" value="` + CsrfToken(c) + `">`)
+			},
+		})
+
+		if !csrfSafeMethod(c.Request.Method) {
+			// 只和已经存在的token比较，伪造的请求不会生成新的token
+			token := h.current(c)
+			submitted := h.submitted(c)
+			if token == nil || submitted == nil || subtle.ConstantTimeCompare(submitted, token) != 1 {
+				RenderError(c, NewHttpError(http.StatusForbidden, "invalid csrf token", nil))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// CsrfToken 获取当前请求的token，每次调用返回不同的mask后的值，用于在json中返回给前端
+// synchronizer模式下第一次调用时生成token并保存到session
+func CsrfToken(c *gin.Context) string {
+	if val, ok := c.Get(ContextCsrfKey); ok {
+		if state, ok := val.(*csrfState); ok {
+			if token, err := state.get(); err == nil {
+				return maskCsrfToken(token)
+			}
+		}
+	}
+	return ""
+}
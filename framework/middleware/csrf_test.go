@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSession 保存在内存中的session，所有请求共用
+type testSession struct {
+	id     string
+	isNew  bool
+	values map[string]interface{}
+}
+
+func newTestSession(id string) *testSession {
+	return &testSession{id: id, values: map[string]interface{}{}}
+}
+
+func (s *testSession) ID() string      { return s.id }
+func (s *testSession) IsNew() bool     { return s.isNew }
+func (s *testSession) Clear()          { s.values = map[string]interface{}{} }
+func (s *testSession) Regenerate()     {}
+func (s *testSession) Destroy()        { s.Clear() }
+func (s *testSession) Delete(k string) { delete(s.values, k) }
+func (s *testSession) Get(key string) (interface{}, bool) {
+	val, ok := s.values[key]
+	return val, ok
+}
+func (s *testSession) GetString(key string) string {
+	val, _ := s.values[key].(string)
+	return val
+}
+func (s *testSession) GetInt64(key string) int64 {
+	val, _ := s.values[key].(int64)
+	return val
+}
+func (s *testSession) GetBool(key string) bool {
+	val, _ := s.values[key].(bool)
+	return val
+}
+func (s *testSession) Set(key string, val interface{})   { s.values[key] = val }
+func (s *testSession) Flash(key string, val interface{}) { s.values[key] = val }
+func (s *testSession) GetFlash(key string) (interface{}, bool) {
+	val, ok := s.values[key]
+	delete(s.values, key)
+	return val, ok
+}
+
+// withSession 将session放到请求的上下文中，代替Session中间件
+func withSession(session *testSession) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if session != nil {
+			c.Set(ContextSessionKey, session)
+		}
+		c.Next()
+	}
+}
+
+func serve(engine *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func newCsrfEngine(session *testSession, conf CsrfConfig) *gin.Engine {
+	engine := gin.New()
+	engine.Use(withSession(session), CsrfWithConfig(conf))
+	engine.GET("/form", func(c *gin.Context) {
+		c.String(http.StatusOK, CsrfToken(c))
+	})
+	engine.POST("/form", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return engine
+}
+
+func TestCsrfMaskToken(t *testing.T) {
+	token := newCsrfToken()
+	first := maskCsrfToken(token)
+	second := maskCsrfToken(token)
+	// 每次mask的结果不同，但是都能还原出相同的token
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, token, unmaskCsrfToken(first))
+	assert.Equal(t, token, unmaskCsrfToken(second))
+
+	assert.Equal(t, token, unmaskCsrfToken(base64.RawURLEncoding.EncodeToString(token)))
+	assert.Nil(t, unmaskCsrfToken("not base64!"))
+	assert.Nil(t, unmaskCsrfToken(base64.RawURLEncoding.EncodeToString([]byte("short"))))
+}
+
+func TestCsrfSynchronizer(t *testing.T) {
+	session := newTestSession("s1")
+	engine := newCsrfEngine(session, CsrfConfig{})
+
+	// 没有token时拒绝，并且不会生成新的token
+	req := httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.Header.Set("X-CSRF-Token", maskCsrfToken(newCsrfToken()))
+	assert.Equal(t, http.StatusForbidden, serve(engine, req).Code)
+	_, ok := session.Get(csrfSessionKey)
+	assert.False(t, ok)
+
+	w := serve(engine, httptest.NewRequest(http.MethodGet, "/form", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	token := w.Body.String()
+	assert.NotEmpty(t, token)
+
+	form := url.Values{"_csrf": {token}}
+	req = httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, http.StatusOK, serve(engine, req).Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.Header.Set("X-CSRF-Token", maskCsrfToken(newCsrfToken()))
+	assert.Equal(t, http.StatusForbidden, serve(engine, req).Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	assert.Equal(t, http.StatusForbidden, serve(engine, req).Code)
+}
+
+func TestCsrfSynchronizerWithoutSession(t *testing.T) {
+	engine := newCsrfEngine(nil, CsrfConfig{})
+	w := serve(engine, httptest.NewRequest(http.MethodGet, "/form", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCsrfDoubleSubmit(t *testing.T) {
+	engine := newCsrfEngine(nil, CsrfConfig{Mode: CsrfModeDoubleSubmit, Secret: "csrf-test-secret"})
+
+	// 第一次请求设置签名的cookie
+	w := serve(engine, httptest.NewRequest(http.MethodGet, "/form", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, "fire_csrf", cookie.Name)
+	assert.False(t, cookie.HttpOnly)
+	assert.Contains(t, cookie.Value, ".")
+
+	// 没有cookie的请求即使提交了token也会被拒绝
+	req := httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.Header.Set("X-CSRF-Token", w.Body.String())
+	assert.Equal(t, http.StatusForbidden, serve(engine, req).Code)
+
+	// 提交mask后的token
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.AddCookie(cookie)
+	req.Header.Set("X-CSRF-Token", w.Body.String())
+	assert.Equal(t, http.StatusOK, serve(engine, req).Code)
+
+	// js直接回传cookie的值
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.AddCookie(cookie)
+	req.Header.Set("X-CSRF-Token", cookie.Value)
+	assert.Equal(t, http.StatusOK, serve(engine, req).Code)
+
+	// 子域名写入的没有签名的cookie不会被接受
+	token := newCsrfToken()
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.AddCookie(&http.Cookie{Name: "fire_csrf", Value: base64.RawURLEncoding.EncodeToString(token)})
+	req.Header.Set("X-CSRF-Token", maskCsrfToken(token))
+	assert.Equal(t, http.StatusForbidden, serve(engine, req).Code)
+
+	// 签名不正确的cookie
+	forged := (&csrfHandler{conf: CsrfConfig{Secret: "another-secret"}}).signCookie(token)
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.AddCookie(&http.Cookie{Name: "fire_csrf", Value: forged})
+	req.Header.Set("X-CSRF-Token", forged)
+	assert.Equal(t, http.StatusForbidden, serve(engine, req).Code)
+}
+
+func TestCsrfExemptAndBearer(t *testing.T) {
+	engine := newCsrfEngine(nil, CsrfConfig{
+		Mode:        CsrfModeDoubleSubmit,
+		ExemptPaths: []string{"/form"},
+	})
+	assert.Equal(t, http.StatusOK, serve(engine, httptest.NewRequest(http.MethodPost, "/form", nil)).Code)
+
+	engine = newCsrfEngine(nil, CsrfConfig{Mode: CsrfModeDoubleSubmit, SkipBearer: true})
+	req := httptest.NewRequest(http.MethodPost, "/form", nil)
+	assert.Equal(t, http.StatusForbidden, serve(engine, req).Code)
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	assert.Equal(t, http.StatusOK, serve(engine, req).Code)
+}
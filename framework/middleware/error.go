@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// ErrorFormatEnvelope 使用 {"code":..., "msg":...} 格式的json返回错误
+	ErrorFormatEnvelope = "envelope"
+	// ErrorFormatProblem 使用 RFC 7807 problem details 格式返回错误
+	ErrorFormatProblem = "problem"
+
+	// MIMEProblemJson RFC 7807 定义的content type
+	MIMEProblemJson = "application/problem+json"
+)
+
+// HttpError 定义了返回给客户端的错误
+type HttpError struct {
+	// Status http状态码
+	Status int
+	// Code 业务错误码，为0时使用Status
+	Code int
+	// Message 对外展示的错误信息
+	Message string
+	// Err 内部错误，只在调试模式下展示
+	Err error
+	// Stack 错误堆栈，只在调试模式下展示
+	Stack string
+}
+
+// NewHttpError 创建一个HttpError
+func NewHttpError(status int, message string, err error) *HttpError {
+	return &HttpError{Status: status, Message: message, Err: err}
+}
+
+func (e *HttpError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %v", e.Status, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// ErrorRenderer 定义了将错误输出给客户端的方法
+type ErrorRenderer func(c *gin.Context, e *HttpError)
+
+var errorRendererLock sync.RWMutex
+var errorRenderer ErrorRenderer = DefaultErrorRenderer
+
+// SetErrorRenderer 替换全局的错误渲染方法，所有框架中间件的错误响应都会使用这个方法
+func SetErrorRenderer(renderer ErrorRenderer) {
+	errorRendererLock.Lock()
+	defer errorRendererLock.Unlock()
+	errorRenderer = renderer
+}
+
+// RenderError 使用全局的错误渲染方法输出错误，并且中止后续的handler
+func RenderError(c *gin.Context, e *HttpError) {
+	errorRendererLock.RLock()
+	renderer := errorRenderer
+	errorRendererLock.RUnlock()
+	if e.Message == "" {
+		e.Message = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		_ = c.Error(e.Err)
+	}
+	renderer(c, e)
+	c.Abort()
+}
+
+// errorDebug 是否在错误响应中展示内部信息，配置 app.error.debug 优先，默认只在开发环境展示
+func errorDebug(c *gin.Context) bool {
+	if configService, err := c.Make(contract.ConfigKey); err == nil {
+		if configService.(contract.IConfig).IsExist("app.error.debug") {
+			return configService.(contract.IConfig).GetBool("app.error.debug")
+		}
+	}
+	if envService, err := c.Make(contract.EnvKey); err == nil {
+		return envService.(contract.Env).AppEnv() == contract.EnvDevelopment
+	}
+	return false
+}
+
+// errorFormat 获取json错误的格式，配置 app.error.format
+func errorFormat(c *gin.Context) string {
+	if configService, err := c.Make(contract.ConfigKey); err == nil {
+		if format := configService.(contract.IConfig).GetString("app.error.format"); format != "" {
+			return format
+		}
+	}
+	return ErrorFormatEnvelope
+}
+
+// requestTraceID 获取请求的trace_id
+func requestTraceID(c *gin.Context) string {
+	tracer, err := c.Make(contract.TraceKey)
+	if err != nil {
+		return ""
+	}
+	if tc := tracer.(contract.Trace).GetTrace(c); tc != nil {
+		return tc.TraceID
+	}
+	return ""
+}
+
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- if .TraceID}}
+<p>trace_id: {{.TraceID}}</p>
+{{- end}}
+{{- if .Detail}}
+<pre>{{.Detail}}</pre>
+{{- end}}
+{{- if .Stack}}
+<pre>{{.Stack}}</pre>
+{{- end}}
+</body>
+</html>
+`))
+
+// DefaultErrorRenderer 根据Accept返回html、RFC 7807 problem details或者json，生产环境下隐藏内部错误和堆栈
+func DefaultErrorRenderer(c *gin.Context, e *HttpError) {
+	debug := errorDebug(c)
+	traceID := requestTraceID(c)
+	code := e.Code
+	if code == 0 {
+		code = e.Status
+	}
+	detail := ""
+	if debug && e.Err != nil {
+		detail = e.Err.Error()
+	}
+	stack := ""
+	if debug {
+		stack = e.Stack
+	}
+
+	c.ISetStatus(e.Status)
+	switch c.NegotiateFormat(gin.MIMEJSON, MIMEProblemJson, gin.MIMEHTML) {
+	case gin.MIMEHTML:
+		c.ISetHeader("Content-Type", "text/html; charset=utf-8")
+		_ = errorTemplate.Execute(c.Writer, map[string]interface{}{
+			"Status":  e.Status,
+			"Title":   http.StatusText(e.Status),
+			"Message": e.Message,
+			"TraceID": traceID,
+			"Detail":  detail,
+			"Stack":   stack,
+		})
+		return
+	case MIMEProblemJson:
+		renderProblem(c, e, code, traceID, detail, stack)
+		return
+	}
+	if errorFormat(c) == ErrorFormatProblem {
+		renderProblem(c, e, code, traceID, detail, stack)
+		return
+	}
+	body := map[string]interface{}{
+		"code": code,
+		"msg":  e.Message,
+	}
+	if traceID != "" {
+		body["trace_id"] = traceID
+	}
+	if detail != "" {
+		body["error"] = detail
+	}
+	if stack != "" {
+		body["stack"] = stack
+	}
+	c.IJson(body)
+}
+
+// renderProblem 输出 RFC 7807 problem details
+func renderProblem(c *gin.Context, e *HttpError, code int, traceID, detail, stack string) {
+	body := map[string]interface{}{
+		"type":     "about:blank",
+		"title":    http.StatusText(e.Status),
+		"status":   e.Status,
+		"detail":   e.Message,
+		"instance": c.Request.URL.Path,
+	}
+	if code != e.Status {
+		body["code"] = code
+	}
+	if traceID != "" {
+		body["trace_id"] = traceID
+	}
+	if detail != "" {
+		body["error"] = detail
+	}
+	if stack != "" {
+		body["stack"] = stack
+	}
+	content, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	c.ISetHeader("Content-Type", MIMEProblemJson)
+	_, _ = c.Writer.Write(content)
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// Health 存活检查，进程能够处理请求就返回200
+func Health() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.ISetStatus(http.StatusOK).IJson(map[string]interface{}{
+			"status": "ok",
+		})
+	}
+}
+
+// Ready 就绪检查，所有生命周期组件都已经启动才返回200，否则返回503
+func Ready() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lifecycleService, err := c.Make(contract.LifecycleKey)
+		if err != nil || !lifecycleService.(contract.ILifecycle).Ready() {
+			c.ISetStatus(http.StatusServiceUnavailable).IJson(map[string]interface{}{
+				"status": "unavailable",
+			})
+			return
+		}
+		components := []string{}
+		for _, component := range lifecycleService.(contract.ILifecycle).Components() {
+			components = append(components, component.Name())
+		}
+		c.ISetStatus(http.StatusOK).IJson(map[string]interface{}{
+			"status":     "ok",
+			"components": components,
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// HttpCacheStoreMemory 使用进程内存储
+	HttpCacheStoreMemory = "memory"
+	// HttpCacheStoreRedis 使用redis存储，多实例之间共享缓存
+	HttpCacheStoreRedis = "redis"
+
+	// ContextCacheTagsKey handler通过 CacheTags 设置的缓存标签在gin.Context中的key
+	ContextCacheTagsKey = "fire:cache_tags"
+	// HttpCacheStatusHeader 标识响应是否来自服务端缓存
+	HttpCacheStatusHeader = "X-Cache"
+)
+
+// HttpCacheRule 定义了一组路由的缓存策略
+type HttpCacheRule struct {
+	// Path 路由路径，和 c.FullPath() 相同，或者以*结尾表示请求路径的前缀匹配
+	Path string `yaml:"path"`
+	// CacheControl handler没有设置Cache-Control时使用的值，例如 public, max-age=60
+	CacheControl string `yaml:"cache_control"`
+	// Cache 是否在服务端缓存响应，只缓存GET请求状态码为200的响应，携带Authorization或者Cookie的请求不使用服务端缓存
+	Cache bool `yaml:"cache"`
+	// TTL 服务端缓存的时间，默认1m
+	TTL string `yaml:"ttl"`
+	// VaryHeaders 缓存的key中包含的请求头，例如 Accept-Language
+	VaryHeaders []string `yaml:"vary_headers"`
+	// Tags 缓存的标签，用于使用 InvalidateCache 失效
+	Tags []string `yaml:"tags"`
+
+	ttl time.Duration
+}
+
+// match 判断请求是否使用这个规则
+func (rule *HttpCacheRule) match(c *gin.Context) bool {
+	if strings.HasSuffix(rule.Path, "*") {
+		return strings.HasPrefix(c.Request.URL.Path, strings.TrimSuffix(rule.Path, "*"))
+	}
+	return rule.Path == c.FullPath()
+}
+
+// HttpCacheConfig 定义了http缓存中间件的配置，对应配置文件中的 app.http_cache
+type HttpCacheConfig struct {
+	// ETag 是否为没有设置ETag的响应计算ETag
+	ETag bool `yaml:"etag"`
+	// WeakETag 是否使用弱ETag
+	WeakETag bool `yaml:"weak_etag"`
+	// MaxBody 最多缓冲的响应体字节数，超过的响应和流式响应直接输出，不计算ETag也不缓存，默认1MB
+	MaxBody int `yaml:"max_body"`
+	// MaxEntries 进程内存储最多缓存的响应数量，默认10000
+	MaxEntries int `yaml:"max_entries"`
+	// Rules 按照路由配置的缓存策略，使用第一个匹配的规则
+	Rules []HttpCacheRule `yaml:"rules"`
+	// Store 服务端缓存的存储，默认使用进程内存储
+	Store HttpCacheStore `yaml:"-"`
+}
+
+// cacheWriter 缓冲响应体用于计算ETag和服务端缓存，超过长度限制或者调用Flush时直接输出
+type cacheWriter struct {
+	gin.ResponseWriter
+	max     int
+	buf     bytes.Buffer
+	size    int
+	written bool
+	bypass  bool
+}
+
+var _ gin.ResponseWriter = (*cacheWriter)(nil)
+
+// passthrough 输出已经缓冲的数据，之后的写入直接输出
+func (w *cacheWriter) passthrough() {
+	w.bypass = true
+	if w.buf.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	w.written = true
+	w.size += len(data)
+	if !w.bypass && w.buf.Len()+len(data) > w.max {
+		w.passthrough()
+	}
+	if w.bypass {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *cacheWriter) WriteHeaderNow() {
+	w.written = true
+	if w.bypass {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *cacheWriter) Written() bool {
+	return w.written || w.ResponseWriter.Written()
+}
+
+func (w *cacheWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.size
+}
+
+// Flush 流式输出的响应不计算ETag
+func (w *cacheWriter) Flush() {
+	if !w.bypass {
+		w.passthrough()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// cacheCall 正在执行的请求，相同key的请求等待它的结果
+type cacheCall struct {
+	done chan struct{}
+	resp *CachedResponse
+}
+
+// cacheFlight 合并相同key的并发请求，避免缓存失效时大量请求同时访问后端
+type cacheFlight struct {
+	lock  sync.Mutex
+	calls map[string]*cacheCall
+}
+
+// join 返回key对应的请求，leader为true时由调用方执行并且调用 done
+func (f *cacheFlight) join(key string) (call *cacheCall, leader bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if call, ok := f.calls[key]; ok {
+		return call, false
+	}
+	call = &cacheCall{done: make(chan struct{})}
+	f.calls[key] = call
+	return call, true
+}
+
+// done 设置结果并唤醒等待的请求
+func (f *cacheFlight) done(key string, call *cacheCall, resp *CachedResponse) {
+	f.lock.Lock()
+	delete(f.calls, key)
+	f.lock.Unlock()
+	call.resp = resp
+	close(call.done)
+}
+
+var httpCacheStoreLock sync.Mutex
+var httpCacheStores = map[string]HttpCacheStore{}
+
+// httpCacheStore 根据配置 app.http_cache.store 获取存储
+func httpCacheStore(c *gin.Context) (HttpCacheStore, error) {
+	configService := c.MustMakeConfig()
+	kind := configService.GetString("app.http_cache.store")
+	if kind == "" {
+		kind = HttpCacheStoreMemory
+	}
+	httpCacheStoreLock.Lock()
+	defer httpCacheStoreLock.Unlock()
+	if store, ok := httpCacheStores[kind]; ok {
+		return store, nil
+	}
+	var store HttpCacheStore
+	switch kind {
+	case HttpCacheStoreMemory:
+		store = NewMemoryHttpCacheStore(configService.GetInt("app.http_cache.max_entries"))
+	case HttpCacheStoreRedis:
+		redis, err := c.Make(contract.RedisKey)
+		if err != nil {
+			return nil, err
+		}
+		store = NewRedisHttpCacheStore(redis.(contract.IRedis))
+	default:
+		return nil, fmt.Errorf("httpcache: unknown store %s", kind)
+	}
+	httpCacheStores[kind] = store
+	return store, nil
+}
+
+// HttpCache http缓存中间件，配置从 app.http_cache 中读取
+func HttpCache() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := HttpCacheConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.http_cache") {
+				if err := configService.Load("app.http_cache", &conf); err != nil {
+					c.MustMakeLog().Error(c, "load http cache config error", map[string]interface{}{
+						"error": err.Error(),
+					})
+				}
+			}
+			store, err := httpCacheStore(c)
+			if err != nil {
+				c.MustMakeLog().Error(c, "http cache store error", map[string]interface{}{
+					"error": err.Error(),
+				})
+				store = NewMemoryHttpCacheStore(conf.MaxEntries)
+			}
+			conf.Store = store
+			handler = HttpCacheWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// HttpCacheWithConfig 使用配置创建http缓存中间件，只处理GET和HEAD请求
+// 为响应计算ETag并处理 If-None-Match/If-Modified-Since 返回304，按照路由规则设置Cache-Control；
+// 规则开启服务端缓存时，相同路由、参数和Vary请求头的请求使用缓存的响应，并发的相同请求只执行一次handler
+// 存储出错时不使用缓存并且记录日志
+func HttpCacheWithConfig(conf HttpCacheConfig) gin.HandlerFunc {
+	if conf.MaxBody <= 0 {
+		conf.MaxBody = 1 << 20
+	}
+	for i := range conf.Rules {
+		conf.Rules[i].ttl = parseDurationDefault(conf.Rules[i].TTL, time.Minute)
+		for j, header := range conf.Rules[i].VaryHeaders {
+			conf.Rules[i].VaryHeaders[j] = http.CanonicalHeaderKey(header)
+		}
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemoryHttpCacheStore(conf.MaxEntries)
+	}
+	flight := &cacheFlight{calls: map[string]*cacheCall{}}
+
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method != http.MethodGet && method != http.MethodHead {
+			c.Next()
+			return
+		}
+		var rule *HttpCacheRule
+		for i := range conf.Rules {
+			if conf.Rules[i].match(c) {
+				rule = &conf.Rules[i]
+				break
+			}
+		}
+		// 携带Authorization、Cookie或者已经加载了session的请求的响应和用户相关，不使用共享的缓存
+		if rule == nil || !rule.Cache || method != http.MethodGet || httpCachePrivate(c) {
+			httpCacheServe(c, conf, rule, nil)
+			return
+		}
+
+		key := httpCacheKey(c, rule)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+		resp, err := conf.Store.Get(ctx, key)
+		cancel()
+		if err != nil {
+			c.MustMakeLog().Error(c, "http cache store error", map[string]interface{}{"error": err.Error()})
+			httpCacheServe(c, conf, rule, nil)
+			return
+		}
+		if resp != nil {
+			httpCacheReplay(c, resp, "HIT")
+			return
+		}
+
+		call, leader := flight.join(key)
+		if !leader {
+			select {
+			case <-call.done:
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+			if call.resp != nil {
+				httpCacheReplay(c, call.resp, "HIT")
+				return
+			}
+			// 第一个请求的响应不能缓存，自己执行handler
+			httpCacheServe(c, conf, rule, nil)
+			return
+		}
+
+		var cached *CachedResponse
+		defer func() {
+			flight.done(key, call, cached)
+		}()
+		httpCacheServe(c, conf, rule, func(resp *CachedResponse) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := conf.Store.Set(ctx, key, resp, rule.ttl); err != nil {
+				c.MustMakeLog().Error(c, "http cache store error", map[string]interface{}{"error": err.Error()})
+			}
+			cached = resp
+		})
+	}
+}
+
+// httpCacheKey 使用路由、请求路径、排序后的参数和Vary请求头计算缓存的key
+func httpCacheKey(c *gin.Context, rule *HttpCacheRule) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.FullPath() + "\n" + c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()))
+	for _, header := range rule.VaryHeaders {
+		hash.Write([]byte("\n" + header + ": " + c.GetHeader(header)))
+	}
+	return "fire:httpcache:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// httpCacheServe 执行handler并处理ETag、Cache-Control和条件请求，响应可以缓存时调用save
+func httpCacheServe(c *gin.Context, conf HttpCacheConfig, rule *HttpCacheRule, save func(*CachedResponse)) {
+	before := c.Writer.Header().Clone()
+	origin := c.Writer
+	writer := &cacheWriter{ResponseWriter: origin, max: conf.MaxBody}
+	c.Writer = writer
+	defer func() {
+		c.Writer = origin
+	}()
+	c.Next()
+	if writer.bypass {
+		return
+	}
+
+	status := writer.Status()
+	header := writer.Header()
+	if rule != nil && rule.CacheControl != "" && header.Get("Cache-Control") == "" &&
+		status >= http.StatusOK && status < http.StatusBadRequest {
+		header.Set("Cache-Control", rule.CacheControl)
+	}
+	if status == http.StatusOK && conf.ETag && header.Get("ETag") == "" && writer.written {
+		sum := sha256.Sum256(writer.buf.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		if conf.WeakETag {
+			etag = "W/" + etag
+		}
+		header.Set("ETag", etag)
+	}
+
+	if save != nil && httpCacheable(c, status, before, header) {
+		resp := &CachedResponse{
+			Status: status,
+			Header: handlerHeader(before, header),
+			Body:   append([]byte(nil), writer.buf.Bytes()...),
+			Tags:   append(append([]string{}, rule.Tags...), c.GetStringSlice(ContextCacheTagsKey)...),
+		}
+		save(resp)
+		header.Set(HttpCacheStatusHeader, "MISS")
+	}
+
+	if status == http.StatusOK && httpNotModified(c.Request, header) {
+		httpWriteNotModified(origin)
+		return
+	}
+	if writer.buf.Len() > 0 {
+		_, _ = origin.Write(writer.buf.Bytes())
+	} else if writer.written {
+		origin.WriteHeaderNow()
+	}
+}
+
+// httpCachePrivate 请求是否带有用户凭证，带有凭证的请求的响应可能和用户相关
+func httpCachePrivate(c *gin.Context) bool {
+	return c.GetHeader("Authorization") != "" || c.GetHeader("Cookie") != "" || GetSession(c) != nil
+}
+
+// httpCacheable 只缓存状态码为200、没有设置cookie并且没有禁止缓存的响应
+func httpCacheable(c *gin.Context, status int, before, header http.Header) bool {
+	if status != http.StatusOK || c.IsAborted() {
+		return false
+	}
+	if len(header.Values("Set-Cookie")) > len(before.Values("Set-Cookie")) {
+		return false
+	}
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "private")
+}
+
+// httpCacheReplay 输出缓存的响应
+func httpCacheReplay(c *gin.Context, resp *CachedResponse, status string) {
+	header := c.Writer.Header()
+	for k, v := range resp.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set(HttpCacheStatusHeader, status)
+	c.Abort()
+	if resp.Status == http.StatusOK && httpNotModified(c.Request, header) {
+		httpWriteNotModified(c.Writer)
+		return
+	}
+	c.ISetStatus(resp.Status)
+	if len(resp.Body) > 0 {
+		_, _ = c.Writer.Write(resp.Body)
+	} else {
+		c.Writer.WriteHeaderNow()
+	}
+}
+
+// httpWriteNotModified 输出304，删除和响应体相关的响应头
+func httpWriteNotModified(w gin.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+	w.WriteHeaderNow()
+}
+
+// httpNotModified 根据 If-None-Match 或者 If-Modified-Since 判断客户端的缓存是否仍然有效
+// 同时存在时只使用 If-None-Match，ETag使用弱比较
+func httpNotModified(req *http.Request, header http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	ims := req.Header.Get("If-Modified-Since")
+	lastModified := header.Get("Last-Modified")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// CacheTags 为当前请求的响应添加缓存标签
+func CacheTags(c *gin.Context, tags ...string) {
+	c.Set(ContextCacheTagsKey, append(c.GetStringSlice(ContextCacheTagsKey), tags...))
+}
+
+// InvalidateCache 删除带有这些标签的服务端缓存，使用配置 app.http_cache.store 对应的存储
+func InvalidateCache(c *gin.Context, tags ...string) error {
+	store, err := httpCacheStore(c)
+	if err != nil {
+		return err
+	}
+	return store.InvalidateTags(c, tags...)
+}
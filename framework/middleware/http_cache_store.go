@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+var errHttpCacheReply = errors.New("httpcache: unexpected store reply")
+
+// CachedResponse 定义了服务端缓存的响应
+type CachedResponse struct {
+	// Status 状态码
+	Status int `json:"status"`
+	// Header handler设置的响应头
+	Header http.Header `json:"header"`
+	// Body 响应体
+	Body []byte `json:"body"`
+	// Tags 缓存的标签，用于按照标签失效
+	Tags []string `json:"tags,omitempty"`
+}
+
+// HttpCacheStore 定义了响应缓存的存储，多实例部署时需要使用共享的存储
+type HttpCacheStore interface {
+	// Get 获取缓存的响应，不存在或者已经过期时返回nil
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	// Set 缓存响应，在ttl后过期
+	Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error
+	// InvalidateTags 删除带有这些标签的缓存
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+// memoryCacheEntry 内存中的缓存项
+type memoryCacheEntry struct {
+	key    string
+	resp   *CachedResponse
+	expire time.Time
+}
+
+// MemoryHttpCacheStore 进程内的响应缓存，超过最大数量时淘汰最久没有使用的缓存
+type MemoryHttpCacheStore struct {
+	lock       sync.Mutex
+	maxEntries int
+	lru        *list.List
+	entries    map[string]*list.Element
+	tags       map[string]map[string]struct{}
+}
+
+// NewMemoryHttpCacheStore 创建进程内的响应缓存，maxEntries小于等于0时默认为10000
+func NewMemoryHttpCacheStore(maxEntries int) *MemoryHttpCacheStore {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &MemoryHttpCacheStore{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+		tags:       map[string]map[string]struct{}{},
+	}
+}
+
+// Get 获取缓存的响应
+func (s *MemoryHttpCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expire) {
+		s.remove(elem)
+		return nil, nil
+	}
+	s.lru.MoveToFront(elem)
+	return entry.resp, nil
+}
+
+// Set 缓存响应
+func (s *MemoryHttpCacheStore) Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	for s.lru.Len() >= s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+	s.entries[key] = s.lru.PushFront(&memoryCacheEntry{key: key, resp: resp, expire: time.Now().Add(ttl)})
+	for _, tag := range resp.Tags {
+		keys, ok := s.tags[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			s.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// InvalidateTags 删除带有这些标签的缓存
+func (s *MemoryHttpCacheStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			if elem, ok := s.entries[key]; ok {
+				s.remove(elem)
+			}
+		}
+		delete(s.tags, tag)
+	}
+	return nil
+}
+
+// remove 删除缓存项和标签索引，调用方需要持有锁
+func (s *MemoryHttpCacheStore) remove(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*memoryCacheEntry)
+	delete(s.entries, entry.key)
+	for _, tag := range entry.resp.Tags {
+		if keys, ok := s.tags[tag]; ok {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+}
+
+// redisHttpCacheSetScript 写入缓存并加入标签集合，标签集合的过期时间不小于其中的缓存
+var redisHttpCacheSetScript = `
+local ttl = tonumber(ARGV[2])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+for i = 2, #KEYS do
+  redis.call('SADD', KEYS[i], KEYS[1])
+  if redis.call('PTTL', KEYS[i]) < ttl then
+    redis.call('PEXPIRE', KEYS[i], ttl)
+  end
+end
+return 1
+`
+
+// redisHttpCacheInvalidateScript 删除标签集合中的所有缓存
+var redisHttpCacheInvalidateScript = `
+local keys = redis.call('SMEMBERS', KEYS[1])
+for _, key in ipairs(keys) do
+  redis.call('DEL', key)
+end
+redis.call('DEL', KEYS[1])
+return #keys
+`
+
+// RedisHttpCacheStore 基于redis的响应缓存，缓存使用json保存，标签使用set保存
+type RedisHttpCacheStore struct {
+	redis  contract.IRedis
+	prefix string
+}
+
+// NewRedisHttpCacheStore 创建基于redis的响应缓存
+func NewRedisHttpCacheStore(redis contract.IRedis) *RedisHttpCacheStore {
+	return &RedisHttpCacheStore{redis: redis, prefix: "fire:httpcache:tag:"}
+}
+
+// Get 获取缓存的响应
+func (s *RedisHttpCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	reply, err := s.redis.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	content, ok := reply.(string)
+	if !ok {
+		return nil, errHttpCacheReply
+	}
+	resp := &CachedResponse{}
+	if err := json.Unmarshal([]byte(content), resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Set 缓存响应
+func (s *RedisHttpCacheStore) Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error {
+	content, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{"EVAL", redisHttpCacheSetScript, 1 + len(resp.Tags), key}
+	for _, tag := range resp.Tags {
+		args = append(args, s.prefix+tag)
+	}
+	args = append(args, content, ttl.Milliseconds())
+	_, err = s.redis.Do(ctx, args...)
+	return err
+}
+
+// InvalidateTags 删除带有这些标签的缓存
+func (s *RedisHttpCacheStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		if _, err := s.redis.Do(ctx, "EVAL", redisHttpCacheInvalidateScript, 1, s.prefix+tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
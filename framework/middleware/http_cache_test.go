@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newHttpCacheEngine 每次请求返回递增的计数，用于判断响应是否来自缓存
+func newHttpCacheEngine(conf HttpCacheConfig, calls *int32) *gin.Engine {
+	engine := gin.New()
+	engine.Use(HttpCacheWithConfig(conf))
+	engine.GET("/articles/:id", func(c *gin.Context) {
+		n := atomic.AddInt32(calls, 1)
+		CacheTags(c, "article:"+c.Param("id"))
+		if c.Query("login") != "" {
+			c.SetCookie("sid", "1", 0, "/", "", false, true)
+		}
+		c.String(http.StatusOK, c.Param("id")+":"+strconv.Itoa(int(n))+":"+c.GetHeader("Accept-Language"))
+	})
+	return engine
+}
+
+func TestHttpCacheETag(t *testing.T) {
+	var calls int32
+	engine := newHttpCacheEngine(HttpCacheConfig{
+		ETag:  true,
+		Rules: []HttpCacheRule{{Path: "/articles/:id", CacheControl: "public, max-age=60"}},
+	}, &calls)
+
+	w := serve(engine, httptest.NewRequest(http.MethodGet, "/articles/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	// 没有开启服务端缓存
+	assert.Empty(t, w.Header().Get(HttpCacheStatusHeader))
+
+	// 响应体变化后ETag不同，旧的ETag不再匹配
+	req := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = serve(engine, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// 响应体不变时返回304，ETag使用弱比较
+	engine = gin.New()
+	engine.Use(HttpCacheWithConfig(HttpCacheConfig{ETag: true}))
+	engine.GET("/static", func(c *gin.Context) {
+		c.String(http.StatusOK, "static")
+	})
+	etag = serve(engine, httptest.NewRequest(http.MethodGet, "/static", nil)).Header().Get("ETag")
+	req = httptest.NewRequest(http.MethodGet, "/static", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	w = serve(engine, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Empty(t, w.Header().Get("Content-Type"))
+}
+
+func TestHttpCacheHit(t *testing.T) {
+	var calls int32
+	store := NewMemoryHttpCacheStore(0)
+	engine := newHttpCacheEngine(HttpCacheConfig{
+		ETag:  true,
+		Rules: []HttpCacheRule{{Path: "/articles/:id", Cache: true, TTL: "1h", VaryHeaders: []string{"accept-language"}}},
+		Store: store,
+	}, &calls)
+
+	w := serve(engine, httptest.NewRequest(http.MethodGet, "/articles/1", nil))
+	assert.Equal(t, "MISS", w.Header().Get(HttpCacheStatusHeader))
+	assert.Equal(t, "1:1:", w.Body.String())
+	etag := w.Header().Get("ETag")
+
+	w = serve(engine, httptest.NewRequest(http.MethodGet, "/articles/1", nil))
+	assert.Equal(t, "HIT", w.Header().Get(HttpCacheStatusHeader))
+	assert.Equal(t, "1:1:", w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	req := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = serve(engine, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get(HttpCacheStatusHeader))
+
+	// Vary请求头不同时分别缓存
+	req = httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	req.Header.Set("Accept-Language", "zh")
+	assert.Equal(t, "1:2:zh", serve(engine, req).Body.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// 按照标签失效
+	assert.NoError(t, store.InvalidateTags(context.Background(), "article:1"))
+	w = serve(engine, httptest.NewRequest(http.MethodGet, "/articles/1", nil))
+	assert.Equal(t, "MISS", w.Header().Get(HttpCacheStatusHeader))
+	assert.Equal(t, "1:3:", w.Body.String())
+}
+
+func TestHttpCacheBypass(t *testing.T) {
+	var calls int32
+	engine := newHttpCacheEngine(HttpCacheConfig{
+		Rules: []HttpCacheRule{{Path: "/articles/:id", Cache: true, TTL: "1h"}},
+	}, &calls)
+
+	// 携带凭证的请求不使用也不写入共享的缓存
+	for _, header := range []string{"Cookie", "Authorization"} {
+		req := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+		req.Header.Set(header, "secret")
+		w := serve(engine, req)
+		assert.Empty(t, w.Header().Get(HttpCacheStatusHeader), header)
+	}
+	w := serve(engine, httptest.NewRequest(http.MethodGet, "/articles/1", nil))
+	assert.Equal(t, "MISS", w.Header().Get(HttpCacheStatusHeader))
+	assert.Equal(t, "1:3:", w.Body.String())
+
+	// 已经缓存的响应也不会返回给携带凭证的请求
+	req := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	req.Header.Set("Cookie", "sid=1")
+	w = serve(engine, req)
+	assert.Empty(t, w.Header().Get(HttpCacheStatusHeader))
+	assert.Equal(t, "1:4:", w.Body.String())
+
+	// 设置了cookie的响应不会被缓存
+	assert.Empty(t, serve(engine, httptest.NewRequest(http.MethodGet, "/articles/2?login=1", nil)).Header().Get(HttpCacheStatusHeader))
+	w = serve(engine, httptest.NewRequest(http.MethodGet, "/articles/2?login=1", nil))
+	assert.Empty(t, w.Header().Get(HttpCacheStatusHeader))
+	assert.Equal(t, "2:6:", w.Body.String())
+}
@@ -0,0 +1,299 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// IdempotencyStoreMemory 使用进程内存储
+	IdempotencyStoreMemory = "memory"
+	// IdempotencyStoreRedis 使用redis存储，多实例之间共享记录
+	IdempotencyStoreRedis = "redis"
+
+	// IdempotentReplayedHeader 重放保存的响应时设置的响应头
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// IdempotencyConfig 定义了幂等中间件的配置，对应配置文件中的 app.idempotency
+type IdempotencyConfig struct {
+	// HeaderName 携带幂等键的请求头，默认 Idempotency-Key
+	HeaderName string `yaml:"header_name"`
+	// Methods 需要幂等处理的请求方法，默认 POST、PATCH
+	Methods []string `yaml:"methods"`
+	// TTL 处理完成的记录保存的时间，默认24h
+	TTL string `yaml:"ttl"`
+	// LockTimeout 处理中的记录的过期时间，需要大于请求的最长处理时间，默认1m
+	LockTimeout string `yaml:"lock_timeout"`
+	// Wait 重复的请求在第一个请求处理中时是否等待，false时直接返回409
+	Wait bool `yaml:"wait"`
+	// WaitTimeout 最多等待的时间，超时后返回409，默认10s
+	WaitTimeout string `yaml:"wait_timeout"`
+	// Store 记录的存储，默认使用进程内存储
+	Store IdempotencyStore `yaml:"-"`
+}
+
+// idempotencyMaxKeyLength 幂等键的最大长度
+const idempotencyMaxKeyLength = 255
+
+// idempotencySkipHeaders 不保存的响应头，这些响应头描述的是编码后的响应体，和保存的响应体不一致
+var idempotencySkipHeaders = []string{"Content-Encoding", "Content-Length", "Vary", "ETag"}
+
+// idempotencyWriter 将写入的响应复制一份，用于保存到存储中
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.body.Write(data[:n])
+	return n, err
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.body.WriteString(s[:n])
+	return n, err
+}
+
+var idempotencyStoreLock sync.Mutex
+var idempotencyStores = map[string]IdempotencyStore{}
+
+// idempotencyStore 根据配置 app.idempotency.store 获取存储
+func idempotencyStore(c *gin.Context) (IdempotencyStore, error) {
+	kind := c.MustMakeConfig().GetString("app.idempotency.store")
+	if kind == "" {
+		kind = IdempotencyStoreMemory
+	}
+	idempotencyStoreLock.Lock()
+	defer idempotencyStoreLock.Unlock()
+	if store, ok := idempotencyStores[kind]; ok {
+		return store, nil
+	}
+	var store IdempotencyStore
+	switch kind {
+	case IdempotencyStoreMemory:
+		store = NewMemoryIdempotencyStore()
+	case IdempotencyStoreRedis:
+		redis, err := c.Make(contract.RedisKey)
+		if err != nil {
+			return nil, err
+		}
+		store = NewRedisIdempotencyStore(redis.(contract.IRedis))
+	default:
+		return nil, fmt.Errorf("idempotency: unknown store %s", kind)
+	}
+	idempotencyStores[kind] = store
+	return store, nil
+}
+
+// Idempotency 幂等中间件，配置从 app.idempotency 中读取
+func Idempotency() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := IdempotencyConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.idempotency") {
+				if err := configService.Load("app.idempotency", &conf); err != nil {
+					c.MustMakeLog().Error(c, "load idempotency config error", map[string]interface{}{
+						"error": err.Error(),
+					})
+				}
+			}
+			store, err := idempotencyStore(c)
+			if err != nil {
+				c.MustMakeLog().Error(c, "idempotency store error", map[string]interface{}{
+					"error": err.Error(),
+				})
+				store = NewMemoryIdempotencyStore()
+			}
+			conf.Store = store
+			handler = IdempotencyWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// IdempotencyWithConfig 使用配置创建幂等中间件，只处理携带幂等键的请求
+// 第一个请求正常处理，状态码小于500的响应会被保存，之后相同幂等键的请求直接重放保存的响应；
+// 第一个请求还在处理中时，重复的请求等待或者返回409；相同的幂等键对应不同的请求时返回422
+// 存储出错时返回503，避免重复执行非幂等的操作
+func IdempotencyWithConfig(conf IdempotencyConfig) gin.HandlerFunc {
+	if conf.HeaderName == "" {
+		conf.HeaderName = "Idempotency-Key"
+	}
+	if len(conf.Methods) == 0 {
+		conf.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	methods := map[string]bool{}
+	for _, method := range conf.Methods {
+		methods[strings.ToUpper(method)] = true
+	}
+	ttl := parseDurationDefault(conf.TTL, 24*time.Hour)
+	lockTTL := parseDurationDefault(conf.LockTimeout, time.Minute)
+	waitTimeout := parseDurationDefault(conf.WaitTimeout, 10*time.Second)
+	if conf.Store == nil {
+		conf.Store = NewMemoryIdempotencyStore()
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(conf.HeaderName)
+		if key == "" || !methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyMaxKeyLength {
+			RenderError(c, NewHttpError(http.StatusBadRequest, "idempotency key is too long", nil))
+			return
+		}
+		fingerprint, err := idempotencyFingerprint(c)
+		if err != nil {
+			RenderError(c, NewHttpError(http.StatusBadRequest, "read request body error", err))
+			return
+		}
+		storeKey := "fire:idempotency:" + idempotencyScope(c) + ":" + key
+
+		deadline := time.Now().Add(waitTimeout)
+		for {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+			record, acquired, err := conf.Store.Acquire(ctx, storeKey, fingerprint, lockTTL)
+			cancel()
+			if err != nil {
+				c.MustMakeLog().Error(c, "idempotency store error", map[string]interface{}{"error": err.Error()})
+				RenderError(c, NewHttpError(http.StatusServiceUnavailable, "", err))
+				return
+			}
+			if acquired {
+				idempotencyExecute(c, conf.Store, storeKey, fingerprint, ttl)
+				return
+			}
+			if record.Fingerprint != fingerprint {
+				RenderError(c, NewHttpError(http.StatusUnprocessableEntity, "idempotency key is already used for a different request", nil))
+				return
+			}
+			if record.Completed {
+				idempotencyReplay(c, record)
+				return
+			}
+			if !conf.Wait || time.Now().After(deadline) {
+				c.ISetHeader("Retry-After", "1")
+				RenderError(c, NewHttpError(http.StatusConflict, "a request with the same idempotency key is in progress", nil))
+				return
+			}
+			select {
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+}
+
+// idempotencyScope 幂等键的作用域，不同客户端的幂等键相互隔离，只使用在重试之间不会变化的凭证
+// 依次使用用户、Authorization 请求头的摘要、已经存在的session的id，都没有时使用客户端ip
+// Cookie 请求头会因为session续期、负载均衡等原因在重试之间变化，不能作为作用域
+func idempotencyScope(c *gin.Context) string {
+	if user := c.GetString(ContextUserKey); user != "" {
+		return "user:" + user
+	}
+	if auth := c.GetHeader("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "auth:" + hex.EncodeToString(sum[:16])
+	}
+	// 新创建的session每次请求的id都不同
+	if session := GetSession(c); session != nil && !session.IsNew() {
+		return "session:" + session.ID()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// idempotencyFingerprint 使用请求方法、路径和请求体计算指纹，读取后恢复请求体
+func idempotencyFingerprint(c *gin.Context) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// idempotencyExecute 处理第一个请求并保存响应，5xx或者panic时删除处理中的记录，允许客户端重试
+func idempotencyExecute(c *gin.Context, store IdempotencyStore, key, fingerprint string, ttl time.Duration) {
+	before := c.Writer.Header().Clone()
+	origin := c.Writer
+	writer := &idempotencyWriter{ResponseWriter: origin}
+	c.Writer = writer
+	completed := false
+	defer func() {
+		c.Writer = origin
+		// 请求已经结束，使用新的context保证客户端断开时也能更新存储
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if !completed {
+			if err := store.Release(ctx, key); err != nil {
+				c.MustMakeLog().Error(c, "idempotency store error", map[string]interface{}{"error": err.Error()})
+			}
+			return
+		}
+		header := handlerHeader(before, writer.Header())
+		// 保存的是外层压缩之前的响应体，压缩和协商缓存相关的响应头在重放时由外层中间件重新设置
+		for _, k := range idempotencySkipHeaders {
+			header.Del(k)
+		}
+		record := &IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			Status:      writer.Status(),
+			Header:      header,
+			Body:        writer.body.Bytes(),
+		}
+		if err := store.Save(ctx, key, record, ttl); err != nil {
+			c.MustMakeLog().Error(c, "idempotency store error", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	c.Next()
+	completed = writer.Status() < http.StatusInternalServerError
+}
+
+// idempotencyReplay 重放保存的响应
+func idempotencyReplay(c *gin.Context, record *IdempotencyRecord) {
+	for k, v := range record.Header {
+		c.Writer.Header()[k] = v
+	}
+	c.ISetHeader(IdempotentReplayedHeader, "true")
+	c.ISetStatus(record.Status)
+	if len(record.Body) > 0 {
+		_, _ = c.Writer.Write(record.Body)
+	} else {
+		c.Writer.WriteHeaderNow()
+	}
+	c.Abort()
+}
+
+// parseDurationDefault 解析配置中的时间，解析失败时使用默认值
+func parseDurationDefault(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+var errIdempotencyReply = errors.New("idempotency: unexpected store reply")
+
+// IdempotencyRecord 定义了一个幂等键对应的请求和响应
+type IdempotencyRecord struct {
+	// Fingerprint 第一次请求的指纹，相同的key必须对应相同的请求
+	Fingerprint string `json:"fingerprint"`
+	// Completed 第一次请求是否已经处理完成
+	Completed bool `json:"completed"`
+	// Status 保存的响应状态码
+	Status int `json:"status,omitempty"`
+	// Header 保存的响应头
+	Header http.Header `json:"header,omitempty"`
+	// Body 保存的响应体
+	Body []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore 定义了幂等记录的存储，多实例部署时需要使用共享的存储
+type IdempotencyStore interface {
+	// Acquire key不存在时写入一个处理中的记录并返回true，记录在lockTTL后过期，避免处理中的实例崩溃后key一直不可用
+	// key已经存在时返回已有的记录和false
+	Acquire(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*IdempotencyRecord, bool, error)
+	// Get 获取key对应的记录，不存在时返回nil
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+	// Save 保存处理完成的记录，在ttl后过期
+	Save(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Release 删除处理中的记录，请求失败时使用，客户端可以使用同一个key重试
+	Release(ctx context.Context, key string) error
+}
+
+// memoryIdempotencyEntry 内存中的记录
+type memoryIdempotencyEntry struct {
+	record *IdempotencyRecord
+	expire time.Time
+}
+
+// MemoryIdempotencyStore 进程内的幂等记录存储，只在单实例部署时有效
+type MemoryIdempotencyStore struct {
+	lock    sync.Mutex
+	entries map[string]*memoryIdempotencyEntry
+	swept   time.Time
+}
+
+// NewMemoryIdempotencyStore 创建进程内的幂等记录存储
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]*memoryIdempotencyEntry{}, swept: time.Now()}
+}
+
+// get 获取没有过期的记录，调用方需要持有锁
+func (s *MemoryIdempotencyStore) get(key string, now time.Time) *IdempotencyRecord {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(entry.expire) {
+		delete(s.entries, key)
+		return nil
+	}
+	// 返回拷贝，避免调用方修改存储中的记录
+	record := *entry.record
+	return &record
+}
+
+// Acquire key不存在时写入一个处理中的记录
+func (s *MemoryIdempotencyStore) Acquire(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*IdempotencyRecord, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if record := s.get(key, now); record != nil {
+		return record, false, nil
+	}
+	record := &IdempotencyRecord{Fingerprint: fingerprint}
+	s.entries[key] = &memoryIdempotencyEntry{record: record, expire: now.Add(lockTTL)}
+	return record, true, nil
+}
+
+// Get 获取key对应的记录
+func (s *MemoryIdempotencyStore) Get(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.get(key, time.Now()), nil
+}
+
+// Save 保存处理完成的记录
+func (s *MemoryIdempotencyStore) Save(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries[key] = &memoryIdempotencyEntry{record: record, expire: time.Now().Add(ttl)}
+	return nil
+}
+
+// Release 删除处理中的记录
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if entry, ok := s.entries[key]; ok && !entry.record.Completed {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// sweep 每分钟最多清理一次过期的记录
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for key, entry := range s.entries {
+		if now.After(entry.expire) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// redisReleaseScript 只删除处理中的记录，避免删除其他实例已经保存的结果
+var redisReleaseScript = `
+local data = redis.call('GET', KEYS[1])
+if data and cjson.decode(data)['completed'] ~= true then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// RedisIdempotencyStore 基于redis的幂等记录存储，记录使用json保存
+type RedisIdempotencyStore struct {
+	redis contract.IRedis
+}
+
+// NewRedisIdempotencyStore 创建基于redis的幂等记录存储
+func NewRedisIdempotencyStore(redis contract.IRedis) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{redis: redis}
+}
+
+// Acquire 使用 SET NX 写入处理中的记录
+func (s *RedisIdempotencyStore) Acquire(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*IdempotencyRecord, bool, error) {
+	record := &IdempotencyRecord{Fingerprint: fingerprint}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		reply, err := s.redis.Do(ctx, "SET", key, content, "PX", lockTTL.Milliseconds(), "NX")
+		if err != nil {
+			return nil, false, err
+		}
+		if reply != nil {
+			return record, true, nil
+		}
+		existing, err := s.Get(ctx, key)
+		if err != nil {
+			return nil, false, err
+		}
+		// SET和GET之间记录过期了，重新尝试写入
+		if existing != nil {
+			return existing, false, nil
+		}
+	}
+}
+
+// Get 获取key对应的记录
+func (s *RedisIdempotencyStore) Get(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	reply, err := s.redis.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	content, ok := reply.(string)
+	if !ok {
+		return nil, errIdempotencyReply
+	}
+	record := &IdempotencyRecord{}
+	if err := json.Unmarshal([]byte(content), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Save 保存处理完成的记录
+func (s *RedisIdempotencyStore) Save(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.redis.Do(ctx, "SET", key, content, "PX", ttl.Milliseconds())
+	return err
+}
+
+// Release 删除处理中的记录
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.redis.Do(ctx, "EVAL", redisReleaseScript, 1, key)
+	return err
+}
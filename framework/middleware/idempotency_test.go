@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// idempotencyRequest 生成携带幂等键的请求
+func idempotencyRequest(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	return req
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var calls int32
+	engine := gin.New()
+	engine.POST("/orders", IdempotencyWithConfig(IdempotencyConfig{}), func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		c.Header("X-Order", strconv.Itoa(int(n)))
+		c.String(http.StatusCreated, "order %d", n)
+	})
+
+	first := serve(engine, idempotencyRequest("k1", `{"amount":1}`))
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "order 1", first.Body.String())
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	replay := serve(engine, idempotencyRequest("k1", `{"amount":1}`))
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, "order 1", replay.Body.String())
+	assert.Equal(t, "1", replay.Header().Get("X-Order"))
+	assert.Equal(t, "true", replay.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// 不同客户端的幂等键相互隔离
+	req := idempotencyRequest("k1", `{"amount":1}`)
+	req.Header.Set("Authorization", "Bearer other")
+	assert.Equal(t, "order 2", serve(engine, req).Body.String())
+
+	// 没有幂等键的请求正常处理
+	req = httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"amount":1}`))
+	assert.Equal(t, "order 3", serve(engine, req).Body.String())
+}
+
+func TestIdempotencyFingerprintMismatch(t *testing.T) {
+	engine := gin.New()
+	engine.POST("/orders", IdempotencyWithConfig(IdempotencyConfig{}), func(c *gin.Context) {
+		c.String(http.StatusCreated, "ok")
+	})
+	assert.Equal(t, http.StatusCreated, serve(engine, idempotencyRequest("k1", `{"amount":1}`)).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, serve(engine, idempotencyRequest("k1", `{"amount":2}`)).Code)
+
+	req := idempotencyRequest(strings.Repeat("k", idempotencyMaxKeyLength+1), "")
+	assert.Equal(t, http.StatusBadRequest, serve(engine, req).Code)
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	engine := gin.New()
+	engine.POST("/orders", IdempotencyWithConfig(IdempotencyConfig{}), func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.String(http.StatusCreated, "ok")
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(engine, idempotencyRequest("k1", "{}"))
+	}()
+	<-entered
+
+	w := serve(engine, idempotencyRequest("k1", "{}"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+	assert.Equal(t, "true", serve(engine, idempotencyRequest("k1", "{}")).Header().Get(IdempotentReplayedHeader))
+}
+
+func TestIdempotencyWaitInProgress(t *testing.T) {
+	var calls int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	engine := gin.New()
+	engine.POST("/orders", IdempotencyWithConfig(IdempotencyConfig{Wait: true, WaitTimeout: "5s"}), func(c *gin.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(entered)
+			<-release
+		}
+		c.String(http.StatusCreated, "ok")
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(engine, idempotencyRequest("k1", "{}"))
+	}()
+	<-entered
+	waiting := make(chan *httptest.ResponseRecorder)
+	go func() {
+		waiting <- serve(engine, idempotencyRequest("k1", "{}"))
+	}()
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+	w := <-waiting
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyServerErrorReleased(t *testing.T) {
+	var calls int32
+	engine := gin.New()
+	engine.POST("/orders", IdempotencyWithConfig(IdempotencyConfig{}), func(c *gin.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			c.String(http.StatusInternalServerError, "failed")
+			return
+		}
+		c.String(http.StatusCreated, "ok")
+	})
+	// 5xx的响应不会保存，客户端可以使用相同的幂等键重试
+	assert.Equal(t, http.StatusInternalServerError, serve(engine, idempotencyRequest("k1", "{}")).Code)
+	w := serve(engine, idempotencyRequest("k1", "{}"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+}
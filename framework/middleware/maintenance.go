@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// MaintenanceFileName 维护模式标记文件，位于 RuntimeFolder 中
+	MaintenanceFileName = "maintenance.json"
+	// MaintenanceCookie 使用secret绕过维护模式后设置的cookie
+	MaintenanceCookie = "fire_maintenance"
+	// MaintenanceSecretHeader 携带secret绕过维护模式的请求头
+	MaintenanceSecretHeader = "X-Maintenance-Secret"
+)
+
+// MaintenanceMode 维护模式的配置，由 fire app down 写入标记文件
+type MaintenanceMode struct {
+	// Time 进入维护模式的时间
+	Time time.Time `json:"time"`
+	// Message 返回给客户端的提示信息
+	Message string `json:"message"`
+	// RetryAfter 建议客户端重试的间隔，单位秒
+	RetryAfter int `json:"retry_after"`
+	// Allow 允许访问的ip或者cidr
+	Allow []string `json:"allow"`
+	// Secret 用于绕过维护模式的token
+	Secret string `json:"secret"`
+
+	networks []*net.IPNet
+}
+
+// MaintenanceFile 获取维护模式标记文件路径
+func MaintenanceFile(runtimeFolder string) string {
+	return filepath.Join(runtimeFolder, MaintenanceFileName)
+}
+
+// ReadMaintenanceMode 读取维护模式标记文件，文件不存在说明不在维护模式
+func ReadMaintenanceMode(file string) (*MaintenanceMode, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	mode := &MaintenanceMode{}
+	if err := json.Unmarshal(content, mode); err != nil {
+		return nil, err
+	}
+	for _, allow := range mode.Allow {
+		if network := parseNetwork(allow); network != nil {
+			mode.networks = append(mode.networks, network)
+		}
+	}
+	return mode, nil
+}
+
+// WriteMaintenanceMode 写入维护模式标记文件，先写入同一目录下的临时文件再重命名，中间件不会读到写了一半的文件
+func WriteMaintenanceMode(file string, mode *MaintenanceMode) error {
+	content, err := json.MarshalIndent(mode, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// parseNetwork 将ip或者cidr解析为网段，单个ip视为/32或/128
+func parseNetwork(s string) *net.IPNet {
+	s = strings.TrimSpace(s)
+	if _, network, err := net.ParseCIDR(s); err == nil {
+		return network
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// allowIP ip是否在允许访问的网段中
+func (mode *MaintenanceMode) allowIP(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+	for _, network := range mode.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretHash 写入cookie的是secret的摘要，避免secret本身泄露
+func (mode *MaintenanceMode) secretHash() string {
+	sum := sha256.Sum256([]byte("fire-maintenance:" + mode.Secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// bypass 判断请求是否可以绕过维护模式，通过query或者header携带secret时会设置cookie
+func (mode *MaintenanceMode) bypass(c *gin.Context) bool {
+	if mode.allowIP(c.ClientIP()) {
+		return true
+	}
+	if mode.Secret == "" {
+		return false
+	}
+	if cookie, err := c.Cookie(MaintenanceCookie); err == nil &&
+		subtle.ConstantTimeCompare([]byte(cookie), []byte(mode.secretHash())) == 1 {
+		return true
+	}
+	secret := c.GetHeader(MaintenanceSecretHeader)
+	if secret == "" {
+		secret = c.Query("secret")
+	}
+	if secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(mode.Secret)) == 1 {
+		c.ISetCookie(MaintenanceCookie, mode.secretHash(), 0, "/", "", false, true)
+		return true
+	}
+	return false
+}
+
+// maintenanceWatcher 缓存标记文件，每隔interval最多检查一次文件变更
+type maintenanceWatcher struct {
+	file     string
+	interval time.Duration
+
+	lock    sync.Mutex
+	checked time.Time
+	modTime time.Time
+	mode    *MaintenanceMode
+}
+
+func (w *maintenanceWatcher) current() *MaintenanceMode {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := time.Now()
+	if now.Sub(w.checked) < w.interval {
+		return w.mode
+	}
+	w.checked = now
+	info, err := os.Stat(w.file)
+	if err != nil {
+		w.mode = nil
+		w.modTime = time.Time{}
+		return nil
+	}
+	// 解析失败时保留之前的状态，下次检查时重新读取
+	if !info.ModTime().Equal(w.modTime) {
+		if mode, err := ReadMaintenanceMode(w.file); err == nil {
+			w.modTime = info.ModTime()
+			w.mode = mode
+		}
+	}
+	return w.mode
+}
+
+// Maintenance 维护模式中间件，RuntimeFolder 下存在标记文件时返回503，标记文件的变更不需要重启服务
+func Maintenance() gin.HandlerFunc {
+	var once sync.Once
+	var watcher *maintenanceWatcher
+	return func(c *gin.Context) {
+		once.Do(func() {
+			watcher = &maintenanceWatcher{
+				file:     MaintenanceFile(c.MustMakeAPP().RuntimeFolder()),
+				interval: time.Second,
+			}
+		})
+		mode := watcher.current()
+		if mode == nil || mode.bypass(c) {
+			c.Next()
+			return
+		}
+
+		if mode.RetryAfter > 0 {
+			c.ISetHeader("Retry-After", strconv.Itoa(mode.RetryAfter))
+		}
+		RenderError(c, NewHttpError(http.StatusServiceUnavailable, mode.Message, nil))
+	}
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/spf13/cast"
+)
+
+// MetricsContentType Prometheus文本格式的content type
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// sizeBuckets 请求和响应大小的直方图buckets，单位字节
+var sizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+// MetricsConfig 定义了请求指标中间件的配置，对应配置文件中的 metrics.http
+type MetricsConfig struct {
+	// SkipPaths 不记录的路径，以*结尾表示前缀匹配
+	SkipPaths []string `yaml:"skip_paths"`
+	// Metrics 指标服务
+	Metrics contract.IMetrics `yaml:"-"`
+}
+
+// makeMetrics 获取指标服务，没有绑定时返回nil
+func makeMetrics(c *gin.Context) contract.IMetrics {
+	if !c.IsBind(contract.MetricsKey) {
+		return nil
+	}
+	instance, err := c.Make(contract.MetricsKey)
+	if err != nil {
+		c.MustMakeLog().Error(c, "metrics service error", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	return instance.(contract.IMetrics)
+}
+
+// Metrics 请求指标中间件，配置从 metrics.http 中读取，没有绑定指标服务时不做任何事情
+func Metrics() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := MetricsConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("metrics.http") {
+				_ = configService.Load("metrics.http", &conf)
+			}
+			conf.Metrics = makeMetrics(c)
+			handler = MetricsWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// MetricsWithConfig 使用配置创建请求指标中间件，按照路由、方法和状态码记录请求数、耗时和大小
+// 没有匹配到路由的请求使用 unmatched 作为路由，避免路径过多导致指标数量不受控制
+// 同时导出并发限制、负载削减和熔断器的运行状态
+func MetricsWithConfig(conf MetricsConfig) gin.HandlerFunc {
+	if conf.Metrics == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	m := conf.Metrics
+	requests := m.Counter("http_requests_total", "Number of HTTP requests.", "method", "route", "status")
+	duration := m.Histogram("http_request_duration_seconds", "HTTP request latency in seconds.", nil, "method", "route", "status")
+	requestSize := m.Histogram("http_request_size_bytes", "HTTP request body size in bytes.", sizeBuckets, "method", "route")
+	responseSize := m.Histogram("http_response_size_bytes", "HTTP response body size in bytes.", sizeBuckets, "method", "route")
+	inFlight := m.Gauge("http_requests_in_flight", "Number of HTTP requests being served.")
+	m.RegisterCollector("overload", collectOverloadStates)
+	skip := AccessLogConfig{SkipPaths: conf.SkipPaths}
+
+	return func(c *gin.Context) {
+		if skip.skip(c.Request.URL.Path, 0) {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := metricsMethod(c.Request.Method)
+		status := strconv.Itoa(c.Writer.Status())
+		requests.Inc(method, route, status)
+		duration.Observe(time.Since(start).Seconds(), method, route, status)
+		if c.Request.ContentLength >= 0 {
+			requestSize.Observe(float64(c.Request.ContentLength), method, route)
+		}
+		if size := c.Writer.Size(); size >= 0 {
+			responseSize.Observe(float64(size), method, route)
+		}
+	}
+}
+
+// metricsMethods 作为标签值的请求方法，请求方法由客户端决定，其他的方法统一记为other，避免无限增加时间序列
+var metricsMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+func metricsMethod(method string) string {
+	if metricsMethods[method] {
+		return method
+	}
+	return "other"
+}
+
+// breakerStateValue 熔断器状态对应的数值
+var breakerStateValue = map[string]float64{
+	BreakerClosed:   0,
+	BreakerOpen:     1,
+	BreakerHalfOpen: 2,
+}
+
+// collectOverloadStates 将过载保护中间件的运行状态导出为gauge，例如 overload_in_flight{type="concurrency",name="default"}
+// 熔断器按照路由导出为 overload_breaker_{字段}{name="default",route="GET /demo"}
+func collectOverloadStates(m contract.IMetrics) {
+	for key, state := range OverloadStates() {
+		kind, name := key, ""
+		if i := strings.Index(key, ":"); i >= 0 {
+			kind, name = key[:i], key[i+1:]
+		}
+		for field, value := range state {
+			if routes, ok := value.(map[string]interface{}); ok && field == "routes" {
+				for route, item := range routes {
+					fields, ok := item.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					for routeField, routeValue := range fields {
+						if s, ok := routeValue.(string); ok {
+							if v, ok := breakerStateValue[s]; ok {
+								m.Gauge("overload_"+kind+"_"+routeField, "Overload protection route state, 0 closed, 1 open, 2 half open.",
+									"name", "route").Set(v, name, route)
+							}
+							continue
+						}
+						if v, err := cast.ToFloat64E(routeValue); err == nil {
+							m.Gauge("overload_"+kind+"_"+routeField, "Overload protection route state.", "name", "route").Set(v, name, route)
+						}
+					}
+				}
+				continue
+			}
+			if v, err := cast.ToFloat64E(value); err == nil {
+				m.Gauge("overload_"+field, "Overload protection state.", "type", "name").Set(v, kind, name)
+			}
+		}
+	}
+}
+
+// MetricsHandler 以Prometheus文本格式输出所有指标的handler，注册在管理端口上
+func MetricsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m := makeMetrics(c)
+		if m == nil {
+			RenderError(c, NewHttpError(http.StatusNotFound, "metrics service is not bound", nil))
+			return
+		}
+		c.ISetHeader("Content-Type", MetricsContentType)
+		c.ISetStatus(http.StatusOK)
+		if err := m.WritePrometheus(c.Writer); err != nil {
+			c.MustMakeLog().Error(c, "write metrics error", map[string]interface{}{"error": err.Error()})
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// OverloadState 过载保护中间件的运行状态，通过管理端口查看，也会导出到metrics中
+type OverloadState interface {
+	// State 当前状态的快照
+	State() map[string]interface{}
+}
+
+var overloadLock sync.RWMutex
+var overloadStates = map[string]OverloadState{}
+
+// registerOverloadState 注册过载保护中间件的运行状态，name相同时后注册的覆盖先注册的
+func registerOverloadState(name string, state OverloadState) {
+	overloadLock.Lock()
+	defer overloadLock.Unlock()
+	overloadStates[name] = state
+}
+
+// OverloadStates 获取所有过载保护中间件的运行状态，key为 {类型}:{名称}
+func OverloadStates() map[string]map[string]interface{} {
+	overloadLock.RLock()
+	defer overloadLock.RUnlock()
+	ret := make(map[string]map[string]interface{}, len(overloadStates))
+	for name, state := range overloadStates {
+		ret[name] = state.State()
+	}
+	return ret
+}
+
+// OverloadInfo 展示并发限制、负载削减和熔断器状态的handler，注册在管理端口上
+func OverloadInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		states := OverloadStates()
+		names := make([]string, 0, len(states))
+		for name := range states {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.ISetStatus(http.StatusOK).IJson(map[string]interface{}{
+			"names":  names,
+			"states": states,
+		})
+	}
+}
+
+// renderOverload 过载时返回503，并且带上Retry-After
+func renderOverload(c *gin.Context, retryAfter time.Duration, message string) {
+	c.ISetHeader("Retry-After", strconv.FormatInt(ceilSeconds(retryAfter), 10))
+	RenderError(c, NewHttpError(http.StatusServiceUnavailable, message, nil))
+}
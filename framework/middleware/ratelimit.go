@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ContextUserKey 认证中间件将当前用户的标识写入gin.Context的key，限流等中间件通过它获取用户
+	ContextUserKey = "fire:user"
+
+	// RateLimitStoreMemory 使用进程内存储
+	RateLimitStoreMemory = "memory"
+	// RateLimitStoreRedis 使用redis存储，多实例之间共享限额
+	RateLimitStoreRedis = "redis"
+)
+
+var errRateLimitReply = errors.New("ratelimit: unexpected store reply")
+
+// RateLimitKeyFunc 获取限流的key，返回空字符串表示这次请求不限流
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitKeyByIP 按照客户端ip限流
+func RateLimitKeyByIP() RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// RateLimitKeyByHeader 按照请求头限流，例如 X-Api-Key，没有携带请求头时按照ip限流
+func RateLimitKeyByHeader(header string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		if value := c.GetHeader(header); value != "" {
+			return "header:" + value
+		}
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// RateLimitKeyByUser 按照认证后的用户限流，未认证的请求按照ip限流
+func RateLimitKeyByUser() RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		if user := c.GetString(ContextUserKey); user != "" {
+			return "user:" + user
+		}
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// RateLimitConfig 定义了一组路由的限流配置，对应配置文件中的 app.rate_limit.groups.{name}
+type RateLimitConfig struct {
+	// Name 分组名称，不同分组的计数互相独立
+	Name string `yaml:"name"`
+	// Algorithm 限流算法，token_bucket 或者 sliding_window，默认 token_bucket
+	Algorithm string `yaml:"algorithm"`
+	// Limit 窗口内允许的请求数
+	Limit int `yaml:"limit"`
+	// Window 窗口长度，例如 1m
+	Window string `yaml:"window"`
+	// Key 限流的维度: ip、user 或者 header:{name}，默认 ip
+	Key string `yaml:"key"`
+	// PerRoute 是否每个路由单独计数
+	PerRoute bool `yaml:"per_route"`
+
+	// KeyFunc 自定义限流的维度，设置后忽略Key
+	KeyFunc RateLimitKeyFunc `yaml:"-"`
+	// Store 计数的存储，默认使用进程内存储
+	Store RateLimitStore `yaml:"-"`
+	// Metrics 指标服务，设置后导出每个分组的限流结果
+	Metrics contract.IMetrics `yaml:"-"`
+}
+
+// rateLimitKeyFunc 将配置中的key转换为获取key的方法
+func rateLimitKeyFunc(key string) RateLimitKeyFunc {
+	switch {
+	case key == "user":
+		return RateLimitKeyByUser()
+	case strings.HasPrefix(key, "header:"):
+		return RateLimitKeyByHeader(strings.TrimPrefix(key, "header:"))
+	default:
+		return RateLimitKeyByIP()
+	}
+}
+
+var rateLimitStoreLock sync.Mutex
+var rateLimitStores = map[string]RateLimitStore{}
+
+// rateLimitStore 根据配置 app.rate_limit.store 获取存储，同一种存储在所有分组之间共享
+func rateLimitStore(c *gin.Context) (RateLimitStore, error) {
+	kind := c.MustMakeConfig().GetString("app.rate_limit.store")
+	if kind == "" {
+		kind = RateLimitStoreMemory
+	}
+	rateLimitStoreLock.Lock()
+	defer rateLimitStoreLock.Unlock()
+	if store, ok := rateLimitStores[kind]; ok {
+		return store, nil
+	}
+	var store RateLimitStore
+	switch kind {
+	case RateLimitStoreMemory:
+		store = NewMemoryRateLimitStore()
+	case RateLimitStoreRedis:
+		redis, err := c.Make(contract.RedisKey)
+		if err != nil {
+			return nil, err
+		}
+		store = NewRedisRateLimitStore(redis.(contract.IRedis))
+	default:
+		return nil, fmt.Errorf("ratelimit: unknown store %s", kind)
+	}
+	rateLimitStores[kind] = store
+	return store, nil
+}
+
+// RateLimit 限流中间件，配置从 app.rate_limit.groups.{group} 中读取
+func RateLimit(group string) gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := RateLimitConfig{}
+			configService := c.MustMakeConfig()
+			key := "app.rate_limit.groups." + group
+			if configService.IsExist(key) {
+				if err := configService.Load(key, &conf); err != nil {
+					c.MustMakeLog().Error(c, "load rate limit config error", map[string]interface{}{
+						"group": group,
+						"error": err.Error(),
+					})
+				}
+			}
+			conf.Name = group
+			store, err := rateLimitStore(c)
+			if err != nil {
+				c.MustMakeLog().Error(c, "rate limit store error", map[string]interface{}{
+					"group": group,
+					"error": err.Error(),
+				})
+				store = NewMemoryRateLimitStore()
+			}
+			conf.Store = store
+			conf.Metrics = makeMetrics(c)
+			handler = RateLimitWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// RateLimitWithConfig 使用配置创建限流中间件，Limit为0时不限流
+// 响应中会带上 X-RateLimit-Limit/X-RateLimit-Remaining/X-RateLimit-Reset，被拒绝时返回429和Retry-After
+// 存储出错时放行请求并且记录日志，避免存储故障导致服务不可用
+func RateLimitWithConfig(conf RateLimitConfig) gin.HandlerFunc {
+	if conf.Limit <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	rule := RateLimitRule{Algorithm: conf.Algorithm, Limit: conf.Limit, Window: time.Minute}
+	if rule.Algorithm != RateLimitSlidingWindow {
+		rule.Algorithm = RateLimitTokenBucket
+	}
+	if window, err := time.ParseDuration(conf.Window); err == nil && window > 0 {
+		rule.Window = window
+	}
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = rateLimitKeyFunc(conf.Key)
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemoryRateLimitStore()
+	}
+	prefix := "fire:ratelimit:" + conf.Name + ":"
+	record := func(result string) {}
+	if conf.Metrics != nil {
+		counter := conf.Metrics.Counter("rate_limit_requests_total", "Number of rate limited requests by result.", "group", "result")
+		record = func(result string) {
+			counter.Inc(conf.Name, result)
+		}
+	}
+
+	return func(c *gin.Context) {
+		key := conf.KeyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if conf.PerRoute {
+			key = c.Request.Method + ":" + c.FullPath() + ":" + key
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+		result, err := conf.Store.Take(ctx, prefix+key, rule)
+		cancel()
+		if err != nil {
+			c.MustMakeLog().Error(c, "rate limit store error", map[string]interface{}{
+				"group": conf.Name,
+				"error": err.Error(),
+			})
+			record("error")
+			c.Next()
+			return
+		}
+
+		c.ISetHeader("X-RateLimit-Limit", strconv.Itoa(rule.Limit))
+		c.ISetHeader("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.ISetHeader("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+		if !result.Allowed {
+			record("rejected")
+			c.ISetHeader("Retry-After", strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+			RenderError(c, NewHttpError(http.StatusTooManyRequests, "", nil))
+			return
+		}
+		record("allowed")
+		c.Next()
+	}
+}
+
+// ceilSeconds 将时间向上取整为秒，最小为1秒
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Max(1, math.Ceil(d.Seconds())))
+}
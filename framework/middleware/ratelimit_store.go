@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	// RateLimitTokenBucket 令牌桶算法，允许一定的突发流量
+	RateLimitTokenBucket = "token_bucket"
+	// RateLimitSlidingWindow 滑动窗口算法，按照上一个窗口的请求数加权计算
+	RateLimitSlidingWindow = "sliding_window"
+)
+
+// RateLimitRule 定义了一条限流规则
+type RateLimitRule struct {
+	// Algorithm 限流算法，token_bucket 或者 sliding_window
+	Algorithm string
+	// Limit 令牌桶的容量，或者滑动窗口内允许的请求数
+	Limit int
+	// Window 令牌桶完全填满的时间，或者滑动窗口的长度
+	Window time.Duration
+}
+
+// RateLimitResult 定义了一次限流判断的结果
+type RateLimitResult struct {
+	// Allowed 是否允许这次请求
+	Allowed bool
+	// Remaining 剩余的配额
+	Remaining int
+	// RetryAfter 被拒绝时，建议客户端等待的时间
+	RetryAfter time.Duration
+	// Reset 配额完全恢复需要的时间
+	Reset time.Duration
+}
+
+// RateLimitStore 定义了限流计数的存储，多实例部署时需要使用共享的存储
+type RateLimitStore interface {
+	// Take 在key上消耗一次配额
+	Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error)
+}
+
+// memoryBucket 内存中的令牌桶或者滑动窗口状态
+type memoryBucket struct {
+	tokens  float64
+	last    time.Time
+	window  int64
+	current int
+	prev    int
+	expire  time.Time
+}
+
+// MemoryRateLimitStore 进程内的限流存储，只在单实例部署时有效
+type MemoryRateLimitStore struct {
+	lock    sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+}
+
+// NewMemoryRateLimitStore 创建进程内的限流存储
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}, swept: time.Now()}
+}
+
+// Take 在key上消耗一次配额
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(rule.Limit), last: now}
+		s.buckets[key] = bucket
+	}
+	bucket.expire = now.Add(2 * rule.Window)
+	if rule.Algorithm == RateLimitSlidingWindow {
+		return s.slidingWindow(bucket, now, rule), nil
+	}
+	return s.tokenBucket(bucket, now, rule), nil
+}
+
+// tokenBucket 令牌桶算法，令牌按照 Limit/Window 的速率补充
+func (s *MemoryRateLimitStore) tokenBucket(bucket *memoryBucket, now time.Time, rule RateLimitRule) RateLimitResult {
+	rate := float64(rule.Limit) / float64(rule.Window)
+	bucket.tokens = math.Min(float64(rule.Limit), bucket.tokens+float64(now.Sub(bucket.last))*rate)
+	bucket.last = now
+	result := RateLimitResult{}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration(math.Ceil((float64(rule.Limit) - bucket.tokens) / rate))
+	return result
+}
+
+// slidingWindow 滑动窗口计数算法
+func (s *MemoryRateLimitStore) slidingWindow(bucket *memoryBucket, now time.Time, rule RateLimitRule) RateLimitResult {
+	windowSize := int64(rule.Window)
+	window := now.UnixNano() / windowSize
+	if window != bucket.window {
+		if window == bucket.window+1 {
+			bucket.prev = bucket.current
+		} else {
+			bucket.prev = 0
+		}
+		bucket.current = 0
+		bucket.window = window
+	}
+	elapsed := now.UnixNano() - window*windowSize
+	return slidingWindowResult(bucket.prev, &bucket.current, elapsed, windowSize, rule.Limit)
+}
+
+// slidingWindowResult 根据上一个窗口和当前窗口的计数判断是否允许，允许时增加当前窗口的计数
+func slidingWindowResult(prev int, current *int, elapsed, windowSize int64, limit int) RateLimitResult {
+	weight := float64(windowSize-elapsed) / float64(windowSize)
+	weighted := float64(prev)*weight + float64(*current)
+	result := RateLimitResult{Reset: time.Duration(windowSize - elapsed)}
+	if weighted+1 > float64(limit) {
+		if *current+1 > limit || prev == 0 {
+			result.RetryAfter = time.Duration(windowSize - elapsed)
+		} else {
+			// 等待上一个窗口的权重下降到允许再请求一次
+			need := float64(windowSize) * (1 - float64(limit-*current-1)/float64(prev))
+			result.RetryAfter = time.Duration(math.Max(need-float64(elapsed), 0))
+		}
+		return result
+	}
+	*current++
+	result.Allowed = true
+	result.Remaining = int(float64(limit) - weighted - 1)
+	return result
+}
+
+// sweep 每分钟最多清理一次过期的状态
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for key, bucket := range s.buckets {
+		if now.After(bucket.expire) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// redisTokenBucketScript 令牌桶的lua脚本，使用redis的时间保证多个实例之间的一致
+var redisTokenBucketScript = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local rate = limit / window
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or limit
+local ts = tonumber(data[2]) or now
+tokens = math.min(limit, tokens + (now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {allowed, math.floor(tokens), retry, math.ceil((limit - tokens) / rate)}
+`
+
+// redisSlidingWindowScript 滑动窗口的lua脚本
+var redisSlidingWindowScript = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local cur = math.floor(now / window)
+local elapsed = now - cur * window
+local curKey = KEYS[1] .. ':' .. cur
+local prev = tonumber(redis.call('GET', KEYS[1] .. ':' .. (cur - 1)) or '0')
+local count = tonumber(redis.call('GET', curKey) or '0')
+local weighted = prev * (window - elapsed) / window + count
+if weighted + 1 > limit then
+  local retry = window - elapsed
+  if count + 1 <= limit and prev > 0 then
+    retry = math.max(math.ceil(window * (1 - (limit - count - 1) / prev) - elapsed), 0)
+  end
+  return {0, 0, retry, window - elapsed}
+end
+redis.call('INCR', curKey)
+redis.call('PEXPIRE', curKey, window * 2)
+return {1, math.floor(limit - weighted - 1), 0, window - elapsed}
+`
+
+// RedisRateLimitStore 基于redis的限流存储，多个实例共享同一份计数
+type RedisRateLimitStore struct {
+	redis contract.IRedis
+}
+
+// NewRedisRateLimitStore 创建基于redis的限流存储
+func NewRedisRateLimitStore(redis contract.IRedis) *RedisRateLimitStore {
+	return &RedisRateLimitStore{redis: redis}
+}
+
+// Take 在key上消耗一次配额，时间精度为毫秒
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	script := redisTokenBucketScript
+	if rule.Algorithm == RateLimitSlidingWindow {
+		script = redisSlidingWindowScript
+	}
+	reply, err := s.redis.Do(ctx, "EVAL", script, 1, key, rule.Limit, rule.Window.Milliseconds())
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return RateLimitResult{}, errRateLimitReply
+	}
+	return RateLimitResult{
+		Allowed:    cast.ToInt(values[0]) == 1,
+		Remaining:  cast.ToInt(values[1]),
+		RetryAfter: time.Duration(cast.ToInt64(values[2])) * time.Millisecond,
+		Reset:      time.Duration(cast.ToInt64(values[3])) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Algorithm: RateLimitTokenBucket, Limit: 3, Window: 3 * time.Second}
+	now := time.Unix(1700000000, 0)
+	bucket := &memoryBucket{tokens: float64(rule.Limit), last: now}
+
+	// 允许突发消耗完整个桶
+	for i := 2; i >= 0; i-- {
+		result := store.tokenBucket(bucket, now, rule)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result := store.tokenBucket(bucket, now, rule)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// 每秒补充一个令牌
+	result = store.tokenBucket(bucket, now.Add(500*time.Millisecond), rule)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	result = store.tokenBucket(bucket, now.Add(time.Second), rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// 令牌不会超过桶的容量
+	result = store.tokenBucket(bucket, now.Add(time.Hour), rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Algorithm: RateLimitSlidingWindow, Limit: 4, Window: 10 * time.Second}
+	start := time.Unix(1700000000, 0)
+	bucket := &memoryBucket{}
+
+	for i := 3; i >= 0; i-- {
+		result := store.slidingWindow(bucket, start, rule)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result := store.slidingWindow(bucket, start.Add(2*time.Second), rule)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 8*time.Second, result.RetryAfter)
+
+	// 下一个窗口过去一半时，上一个窗口的4个请求按照一半计算
+	next := start.Add(15 * time.Second)
+	result = store.slidingWindow(bucket, next, rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+	result = store.slidingWindow(bucket, next, rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	result = store.slidingWindow(bucket, next, rule)
+	assert.False(t, result.Allowed)
+	// 上一个窗口的权重下降到1/4之后才允许再请求一次
+	assert.Equal(t, 2500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 5*time.Second, result.Reset)
+	assert.True(t, store.slidingWindow(bucket, next.Add(2500*time.Millisecond), rule).Allowed)
+
+	// 间隔超过一个窗口后计数清零
+	for i := 0; i < 4; i++ {
+		assert.True(t, store.slidingWindow(bucket, start.Add(time.Minute), rule).Allowed)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	engine := gin.New()
+	engine.GET("/api", RateLimitWithConfig(RateLimitConfig{Name: "api", Limit: 2, Window: "1h", Key: "header:X-Api-Key"}),
+		func(c *gin.Context) {
+			c.String(http.StatusOK, "ok")
+		})
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.Header.Set("X-Api-Key", key)
+		return serve(engine, req)
+	}
+
+	w := request("a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, request("a").Code)
+	w = request("a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1800", w.Header().Get("Retry-After"))
+
+	// 不同的key分别计数
+	assert.Equal(t, http.StatusOK, request("b").Code)
+
+	// Limit为0时不限流
+	engine = gin.New()
+	engine.GET("/api", RateLimitWithConfig(RateLimitConfig{}), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	for i := 0; i < 3; i++ {
+		w = serve(engine, httptest.NewRequest(http.MethodGet, "/api", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	}
+}
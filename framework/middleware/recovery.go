@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// PanicError 在其他goroutine中捕获的panic，保存了panic发生时所在goroutine的堆栈
+// 在当前goroutine中重新抛出时使用，Recovery 记录的是其中的堆栈而不是重新抛出的位置
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprint(e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Recovery 捕获后续handler中的panic，通过日志服务记录堆栈和trace信息，并且使用错误渲染方法返回500
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			err, ok := p.(error)
+			if !ok {
+				err = fmt.Errorf("%v", p)
+			}
+			fields := map[string]interface{}{
+				"method": c.Request.Method,
+				"path":   c.Request.URL.Path,
+				"route":  c.FullPath(),
+				"error":  err.Error(),
+			}
+
+			// 客户端断开连接的情况下无法再返回任何内容，只记录日志
+			if isBrokenPipe(err) {
+				logRecovery(c, contract.WarnLevel, "broken pipe", fields)
+				_ = c.Error(err)
+				c.Abort()
+				return
+			}
+
+			stack := string(debug.Stack())
+			var panicErr *PanicError
+			if errors.As(err, &panicErr) {
+				stack = string(panicErr.Stack)
+			}
+			fields["stack"] = stack
+			logRecovery(c, contract.ErrorLevel, "panic recovered", fields)
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			RenderError(c, &HttpError{
+				Status: http.StatusInternalServerError,
+				Err:    err,
+				Stack:  stack,
+			})
+		}()
+		c.Next()
+	}
+}
+
+// isBrokenPipe 判断是否是客户端断开连接导致的错误
+func isBrokenPipe(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	if !errors.As(opErr, &syscallErr) {
+		return false
+	}
+	msg := strings.ToLower(syscallErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
+
+// logRecovery 使用日志服务记录，没有绑定日志服务时输出到标准错误
+func logRecovery(c *gin.Context, level contract.LogLevel, msg string, fields map[string]interface{}) {
+	logService, err := c.Make(contract.FireLogKey)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, msg, fields)
+		return
+	}
+	logger := logService.(contract.ILog)
+	if level == contract.WarnLevel {
+		logger.Warn(c, msg, fields)
+		return
+	}
+	logger.Error(c, msg, fields)
+}
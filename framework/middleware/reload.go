@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// configReloadInterval 检查配置是否变化的间隔
+const configReloadInterval = time.Second
+
+// configReloader 缓存根据配置构建的中间件状态，配置服务监听到配置文件变化后，最多在一个检查间隔内重新构建
+// build返回错误时记录日志并继续使用上一次构建的结果
+type configReloader struct {
+	key   string
+	build func(configService contract.IConfig) (interface{}, error)
+
+	lock    sync.Mutex
+	checked int64
+	raw     interface{}
+	value   atomic.Value
+}
+
+func newConfigReloader(key string, build func(configService contract.IConfig) (interface{}, error)) *configReloader {
+	return &configReloader{key: key, build: build}
+}
+
+// get 获取当前的状态，超过检查间隔时比较配置的原始值，变化后重新构建，从来没有构建成功时返回nil
+func (r *configReloader) get(c *gin.Context) interface{} {
+	now := time.Now().UnixNano()
+	if checked := atomic.LoadInt64(&r.checked); checked != 0 && now-checked < int64(configReloadInterval) {
+		return r.value.Load()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if checked := atomic.LoadInt64(&r.checked); checked != 0 && now-checked < int64(configReloadInterval) {
+		return r.value.Load()
+	}
+	configService := c.MustMakeConfig()
+	raw := configService.Get(r.key)
+	first := atomic.LoadInt64(&r.checked) == 0
+	atomic.StoreInt64(&r.checked, now)
+	if !first && reflect.DeepEqual(raw, r.raw) {
+		return r.value.Load()
+	}
+	// 构建失败时同样记录原始值，配置再次变化前不重复构建
+	r.raw = raw
+	built, err := r.build(configService)
+	if err != nil {
+		c.MustMakeLog().Error(c, "reload config error", map[string]interface{}{"key": r.key, "error": err.Error()})
+		return r.value.Load()
+	}
+	r.value.Store(built)
+	return built
+}
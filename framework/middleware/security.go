@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// SecurityHeadersConfig 定义了安全响应头中间件的配置，对应配置文件中的 app.security_headers
+// 每一项都是完整的响应头的值，配置为空字符串表示不输出这个响应头
+type SecurityHeadersConfig struct {
+	// HSTS Strict-Transport-Security，只在https请求中输出
+	HSTS string `yaml:"hsts"`
+	// ContentSecurityPolicy Content-Security-Policy
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+	// FrameOptions X-Frame-Options
+	FrameOptions string `yaml:"frame_options"`
+	// ReferrerPolicy Referrer-Policy
+	ReferrerPolicy string `yaml:"referrer_policy"`
+	// PermissionsPolicy Permissions-Policy
+	PermissionsPolicy string `yaml:"permissions_policy"`
+	// ContentTypeOptions X-Content-Type-Options
+	ContentTypeOptions string `yaml:"content_type_options"`
+}
+
+// DefaultSecurityHeadersConfig 默认的安全响应头，配置文件中没有设置的项使用这里的值
+func DefaultSecurityHeadersConfig() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		HSTS:               "max-age=31536000; includeSubDomains",
+		FrameOptions:       "SAMEORIGIN",
+		ReferrerPolicy:     "strict-origin-when-cross-origin",
+		ContentTypeOptions: "nosniff",
+	}
+}
+
+// SecurityHeaders 安全响应头中间件，配置从 app.security_headers 中读取
+func SecurityHeaders() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := DefaultSecurityHeadersConfig()
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.security_headers") {
+				_ = configService.Load("app.security_headers", &conf)
+			}
+			handler = SecurityHeadersWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// SecurityHeadersWithConfig 使用配置创建安全响应头中间件，响应头在handler执行前设置，handler可以覆盖
+func SecurityHeadersWithConfig(conf SecurityHeadersConfig) gin.HandlerFunc {
+	headers := map[string]string{
+		"Content-Security-Policy": conf.ContentSecurityPolicy,
+		"X-Frame-Options":         conf.FrameOptions,
+		"Referrer-Policy":         conf.ReferrerPolicy,
+		"Permissions-Policy":      conf.PermissionsPolicy,
+		"X-Content-Type-Options":  conf.ContentTypeOptions,
+	}
+	for key, value := range headers {
+		if value == "" {
+			delete(headers, key)
+		}
+	}
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		for key, value := range headers {
+			header.Set(key, value)
+		}
+		if conf.HSTS != "" && isHttps(c) {
+			header.Set("Strict-Transport-Security", conf.HSTS)
+		}
+		c.Next()
+	}
+}
+
+// isHttps 判断请求是否通过https访问，包括经过代理转发的请求
+func isHttps(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// ContextSessionKey session中间件将当前请求的session写入gin.Context的key
+const ContextSessionKey = "fire:session"
+
+// sessionWriter 在写入响应头之前保存session，保证Set-Cookie可以写入响应头
+type sessionWriter struct {
+	gin.ResponseWriter
+	once sync.Once
+	save func()
+}
+
+func (w *sessionWriter) beforeWrite() {
+	w.once.Do(w.save)
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) WriteString(s string) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.beforeWrite()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Flush() {
+	w.beforeWrite()
+	w.ResponseWriter.Flush()
+}
+
+// Session session中间件，加载请求的session并写入gin.Context，在写入响应之前保存
+// 保存失败时记录日志，不影响请求的处理
+func Session() gin.HandlerFunc {
+	var once sync.Once
+	var service contract.ISessionService
+	return func(c *gin.Context) {
+		// session服务只获取一次，不可用时只记录一次日志，之后的请求不使用session
+		once.Do(func() {
+			instance, err := c.Make(contract.SessionKey)
+			if err != nil {
+				c.MustMakeLog().Error(c, "session service error", map[string]interface{}{"error": err.Error()})
+				return
+			}
+			service = instance.(contract.ISessionService)
+		})
+		if service == nil {
+			c.Next()
+			return
+		}
+		session, err := service.Load(c, c.Request)
+		if err != nil {
+			c.MustMakeLog().Error(c, "session load error", map[string]interface{}{"error": err.Error()})
+		}
+		c.Set(ContextSessionKey, session)
+
+		origin := c.Writer
+		writer := &sessionWriter{ResponseWriter: origin}
+		writer.save = func() {
+			if err := service.Save(c, origin, session); err != nil {
+				c.MustMakeLog().Error(c, "session save error", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		c.Writer = writer
+		defer func() {
+			c.Writer = origin
+		}()
+		c.Next()
+		writer.beforeWrite()
+	}
+}
+
+// GetSession 获取当前请求的session，没有使用session中间件时返回nil
+func GetSession(c *gin.Context) contract.ISession {
+	if val, ok := c.Get(ContextSessionKey); ok {
+		if session, ok := val.(contract.ISession); ok {
+			return session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// LoadSheddingConfig 定义了自适应负载削减中间件的配置，对应配置文件中的 app.overload.shedding
+type LoadSheddingConfig struct {
+	// Name 名称，用于区分管理端口中展示的状态
+	Name string `yaml:"name"`
+	// TargetLatency 目标延迟，例如 200ms，为空时不开启
+	TargetLatency string `yaml:"target_latency"`
+	// Window 统计延迟的窗口，每个窗口结束时调整一次并发上限，默认1s
+	Window string `yaml:"window"`
+	// MinLimit 并发上限的最小值，默认10
+	MinLimit int `yaml:"min_limit"`
+	// MaxLimit 并发上限的最大值，也是初始值，默认1000
+	MaxLimit int `yaml:"max_limit"`
+}
+
+// loadShedder 根据观测到的延迟调整并发上限，延迟超过目标时按比例降低上限，低于目标时逐步恢复
+type loadShedder struct {
+	target   time.Duration
+	window   time.Duration
+	minLimit float64
+	maxLimit float64
+
+	lock        sync.Mutex
+	limit       float64
+	inFlight    int
+	windowStart time.Time
+	sum         time.Duration
+	count       int
+	latency     time.Duration
+	total       int64
+	shed        int64
+}
+
+// acquire 处理中的请求数没有达到当前上限时返回true
+func (s *loadShedder) acquire() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.total++
+	if s.inFlight >= int(s.limit) {
+		s.shed++
+		return false
+	}
+	s.inFlight++
+	return true
+}
+
+// release 记录请求的延迟，窗口结束时调整上限
+func (s *loadShedder) release(latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.inFlight--
+	s.sum += latency
+	s.count++
+	now := time.Now()
+	if now.Sub(s.windowStart) < s.window {
+		return
+	}
+	s.latency = s.sum / time.Duration(s.count)
+	if s.latency > s.target {
+		s.limit = math.Max(s.minLimit, s.limit*0.9)
+	} else {
+		s.limit = math.Min(s.maxLimit, s.limit+math.Max(1, s.limit*0.1))
+	}
+	s.windowStart = now
+	s.sum = 0
+	s.count = 0
+}
+
+// State 当前状态
+func (s *loadShedder) State() map[string]interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return map[string]interface{}{
+		"limit":             int(s.limit),
+		"min_limit":         int(s.minLimit),
+		"max_limit":         int(s.maxLimit),
+		"in_flight":         s.inFlight,
+		"target_latency_ms": s.target.Milliseconds(),
+		"latency_ms":        float64(s.latency.Microseconds()) / 1000,
+		"total":             s.total,
+		"shed":              s.shed,
+	}
+}
+
+// LoadShedding 自适应负载削减中间件，配置从 app.overload.shedding 中读取
+func LoadShedding() gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := LoadSheddingConfig{}
+			configService := c.MustMakeConfig()
+			if configService.IsExist("app.overload.shedding") {
+				_ = configService.Load("app.overload.shedding", &conf)
+			}
+			handler = LoadSheddingWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// LoadSheddingWithConfig 使用配置创建自适应负载削减中间件，超过当前并发上限的请求直接返回503
+func LoadSheddingWithConfig(conf LoadSheddingConfig) gin.HandlerFunc {
+	target, err := time.ParseDuration(conf.TargetLatency)
+	if err != nil || target <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	if conf.Name == "" {
+		conf.Name = "default"
+	}
+	if conf.MinLimit <= 0 {
+		conf.MinLimit = 10
+	}
+	if conf.MaxLimit < conf.MinLimit {
+		conf.MaxLimit = int(math.Max(1000, float64(conf.MinLimit)))
+	}
+	shedder := &loadShedder{
+		target:      target,
+		window:      time.Second,
+		minLimit:    float64(conf.MinLimit),
+		maxLimit:    float64(conf.MaxLimit),
+		limit:       float64(conf.MaxLimit),
+		windowStart: time.Now(),
+	}
+	if window, err := time.ParseDuration(conf.Window); err == nil && window > 0 {
+		shedder.window = window
+	}
+	registerOverloadState("shedding:"+conf.Name, shedder)
+
+	return func(c *gin.Context) {
+		if !shedder.acquire() {
+			renderOverload(c, shedder.window, "server is overloaded")
+			return
+		}
+		start := time.Now()
+		defer func() {
+			shedder.release(time.Since(start))
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// SignatureStoreMemory 使用进程内存储记录已经使用过的签名
+	SignatureStoreMemory = "memory"
+	// SignatureStoreRedis 使用redis存储，多实例之间共享
+	SignatureStoreRedis = "redis"
+
+	// ContextSignatureKey 签名校验通过后写入gin.Context的key，值为签名分组的名称
+	ContextSignatureKey = "fire:signature"
+)
+
+// signatureHashes 支持的签名算法
+var signatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// SignatureConfig 定义了一组请求签名校验的配置，对应配置文件中的 app.signature.groups.{name}
+type SignatureConfig struct {
+	// Name 分组名称，不同分组的签名记录互相独立
+	Name string `yaml:"name"`
+	// Secrets 有效的密钥，轮换密钥时同时配置新旧密钥，任意一个校验通过即可
+	Secrets []string `yaml:"secrets"`
+	// Algorithm HMAC使用的摘要算法: sha256、sha1 或者 sha512，默认 sha256
+	Algorithm string `yaml:"algorithm"`
+	// SignatureHeader 携带签名的请求头，默认 X-Signature，值为十六进制，可以带 sha256= 前缀，多个签名使用逗号分隔
+	SignatureHeader string `yaml:"signature_header"`
+	// TimestampHeader 携带签名时间的请求头，默认 X-Signature-Timestamp，值为unix秒
+	TimestampHeader string `yaml:"timestamp_header"`
+	// Window 签名时间和服务器时间允许的偏差，默认 5m，同一个签名在窗口内只能使用一次
+	Window string `yaml:"window"`
+
+	// Store 已经使用过的签名的存储，默认使用进程内存储
+	Store SignatureReplayStore `yaml:"-"`
+}
+
+// SignatureString 生成参与签名的字符串: 请求方法、路径和query、时间戳、请求体的sha256，使用换行连接
+func SignatureString(method, uri, timestamp string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.ToUpper(method) + "\n" + uri + "\n" + timestamp + "\n" + hex.EncodeToString(sum[:])
+}
+
+// ComputeSignature 使用密钥计算HMAC签名，返回十六进制字符串
+func ComputeSignature(algorithm, secret, message string) (string, error) {
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	newHash, ok := signatureHashes[algorithm]
+	if !ok {
+		return "", fmt.Errorf("signature: unsupported algorithm %s", algorithm)
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SignRequest 为发出的请求签名，设置签名和时间戳请求头，请求体会被读取后恢复
+// 请求头名称为空时使用默认的 X-Signature 和 X-Signature-Timestamp
+func SignRequest(req *http.Request, conf SignatureConfig, secret string) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		content, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+		body = content
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	conf = signatureDefaults(conf)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature, err := ComputeSignature(conf.Algorithm, secret, SignatureString(req.Method, req.URL.RequestURI(), timestamp, body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(conf.TimestampHeader, timestamp)
+	req.Header.Set(conf.SignatureHeader, conf.Algorithm+"="+signature)
+	return nil
+}
+
+// signatureDefaults 设置默认的算法和请求头
+func signatureDefaults(conf SignatureConfig) SignatureConfig {
+	if conf.Algorithm == "" {
+		conf.Algorithm = "sha256"
+	}
+	if conf.SignatureHeader == "" {
+		conf.SignatureHeader = "X-Signature"
+	}
+	if conf.TimestampHeader == "" {
+		conf.TimestampHeader = "X-Signature-Timestamp"
+	}
+	return conf
+}
+
+var signatureStoreLock sync.Mutex
+var signatureStores = map[string]SignatureReplayStore{}
+
+// signatureStore 根据配置 app.signature.store 获取存储，同一种存储在所有分组之间共享
+func signatureStore(c *gin.Context) (SignatureReplayStore, error) {
+	kind := c.MustMakeConfig().GetString("app.signature.store")
+	if kind == "" {
+		kind = SignatureStoreMemory
+	}
+	signatureStoreLock.Lock()
+	defer signatureStoreLock.Unlock()
+	if store, ok := signatureStores[kind]; ok {
+		return store, nil
+	}
+	var store SignatureReplayStore
+	switch kind {
+	case SignatureStoreMemory:
+		store = NewMemorySignatureReplayStore()
+	case SignatureStoreRedis:
+		redis, err := c.Make(contract.RedisKey)
+		if err != nil {
+			return nil, err
+		}
+		store = NewRedisSignatureReplayStore(redis.(contract.IRedis))
+	default:
+		return nil, fmt.Errorf("signature: unknown store %s", kind)
+	}
+	signatureStores[kind] = store
+	return store, nil
+}
+
+// Signature 请求签名校验中间件，用于接收合作方的webhook，配置从 app.signature.groups.{group} 中读取
+func Signature(group string) gin.HandlerFunc {
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			conf := SignatureConfig{}
+			configService := c.MustMakeConfig()
+			key := "app.signature.groups." + group
+			if configService.IsExist(key) {
+				if err := configService.Load(key, &conf); err != nil {
+					c.MustMakeLog().Error(c, "load signature config error", map[string]interface{}{
+						"group": group,
+						"error": err.Error(),
+					})
+				}
+			}
+			conf.Name = group
+			store, err := signatureStore(c)
+			if err != nil {
+				c.MustMakeLog().Error(c, "signature store error", map[string]interface{}{
+					"group": group,
+					"error": err.Error(),
+				})
+				store = NewMemorySignatureReplayStore()
+			}
+			conf.Store = store
+			handler = SignatureWithConfig(conf)
+		})
+		handler(c)
+	}
+}
+
+// hmacMinSecretLength HMAC密钥的最小长度
+const hmacMinSecretLength = 16
+
+// hmacSecrets 检查配置的HMAC密钥，忽略空字符串
+// 没有被替换的env(XXX)说明环境变量没有设置，它和过短的密钥一样容易被猜到，存在时返回错误，不能用于校验签名
+func hmacSecrets(secrets []string) ([][]byte, error) {
+	ret := make([][]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		if strings.HasPrefix(secret, "env(") {
+			return nil, fmt.Errorf("secret %s is not set", secret)
+		}
+		if len(secret) < hmacMinSecretLength {
+			return nil, fmt.Errorf("secret must be at least %d bytes", hmacMinSecretLength)
+		}
+		ret = append(ret, []byte(secret))
+	}
+	return ret, nil
+}
+
+// SignatureWithConfig 使用配置创建请求签名校验中间件，签名为 HMAC(secret, SignatureString(...))
+// 缺少签名、时间戳超出窗口、签名不正确或者签名已经使用过时返回401，没有配置密钥时拒绝所有请求
+// 密钥是没有设置的环境变量或者过短时返回500，存储出错时返回503，避免在无法检查重放的情况下处理请求
+func SignatureWithConfig(conf SignatureConfig) gin.HandlerFunc {
+	conf = signatureDefaults(conf)
+	newHash, ok := signatureHashes[conf.Algorithm]
+	if !ok {
+		return func(c *gin.Context) {
+			RenderError(c, NewHttpError(http.StatusInternalServerError, "", fmt.Errorf("signature: unsupported algorithm %s", conf.Algorithm)))
+		}
+	}
+	window := parseDurationDefault(conf.Window, 5*time.Minute)
+	if conf.Store == nil {
+		conf.Store = NewMemorySignatureReplayStore()
+	}
+	secrets, err := hmacSecrets(conf.Secrets)
+	if err != nil {
+		err = fmt.Errorf("signature %s: %w", conf.Name, err)
+		return func(c *gin.Context) {
+			RenderError(c, NewHttpError(http.StatusInternalServerError, "", err))
+		}
+	}
+	prefix := "fire:signature:" + conf.Name + ":"
+
+	return func(c *gin.Context) {
+		header := c.GetHeader(conf.SignatureHeader)
+		timestamp := c.GetHeader(conf.TimestampHeader)
+		if header == "" || timestamp == "" {
+			RenderError(c, NewHttpError(http.StatusUnauthorized, "missing signature", nil))
+			return
+		}
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			RenderError(c, NewHttpError(http.StatusUnauthorized, "invalid signature timestamp", nil))
+			return
+		}
+		if math.Abs(time.Since(time.Unix(unix, 0)).Seconds()) > window.Seconds() {
+			RenderError(c, NewHttpError(http.StatusUnauthorized, "signature expired", nil))
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			body, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				RenderError(c, NewHttpError(http.StatusBadRequest, "read request body error", err))
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		message := []byte(SignatureString(c.Request.Method, c.Request.URL.RequestURI(), timestamp, body))
+		matched := ""
+		for _, item := range strings.Split(header, ",") {
+			item = strings.TrimSpace(item)
+			item = strings.TrimPrefix(item, conf.Algorithm+"=")
+			signature, err := hex.DecodeString(item)
+			if err != nil {
+				continue
+			}
+			for _, secret := range secrets {
+				mac := hmac.New(newHash, secret)
+				mac.Write(message)
+				if hmac.Equal(mac.Sum(nil), signature) {
+					matched = hex.EncodeToString(signature)
+					break
+				}
+			}
+			if matched != "" {
+				break
+			}
+		}
+		if matched == "" {
+			RenderError(c, NewHttpError(http.StatusUnauthorized, "invalid signature", nil))
+			return
+		}
+
+		// 时间戳在当前时间前后window内都有效，记录需要保留两个窗口
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+		fresh, err := conf.Store.Mark(ctx, prefix+matched, 2*window)
+		cancel()
+		if err != nil {
+			c.MustMakeLog().Error(c, "signature store error", map[string]interface{}{
+				"group": conf.Name,
+				"error": err.Error(),
+			})
+			RenderError(c, NewHttpError(http.StatusServiceUnavailable, "", err))
+			return
+		}
+		if !fresh {
+			RenderError(c, NewHttpError(http.StatusUnauthorized, "signature already used", nil))
+			return
+		}
+		c.Set(ContextSignatureKey, conf.Name)
+		c.Next()
+	}
+}
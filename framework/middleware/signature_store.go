@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// SignatureReplayStore 记录已经使用过的签名，签名在时间窗口内只能使用一次，多实例部署时需要使用共享的存储
+type SignatureReplayStore interface {
+	// Mark 记录签名，ttl后过期，签名已经存在时返回false
+	Mark(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// MemorySignatureReplayStore 进程内的签名记录，只在单实例部署时有效
+type MemorySignatureReplayStore struct {
+	lock    sync.Mutex
+	entries map[string]time.Time
+	swept   time.Time
+}
+
+// NewMemorySignatureReplayStore 创建进程内的签名记录
+func NewMemorySignatureReplayStore() *MemorySignatureReplayStore {
+	return &MemorySignatureReplayStore{entries: map[string]time.Time{}, swept: time.Now()}
+}
+
+// Mark 记录签名，每分钟最多清理一次过期的记录
+func (s *MemorySignatureReplayStore) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if now.Sub(s.swept) > time.Minute {
+		for k, expire := range s.entries {
+			if now.After(expire) {
+				delete(s.entries, k)
+			}
+		}
+		s.swept = now
+	}
+	if expire, ok := s.entries[key]; ok && now.Before(expire) {
+		return false, nil
+	}
+	s.entries[key] = now.Add(ttl)
+	return true, nil
+}
+
+// RedisSignatureReplayStore 基于redis的签名记录，使用 SET NX PX
+type RedisSignatureReplayStore struct {
+	redis contract.IRedis
+}
+
+// NewRedisSignatureReplayStore 创建基于redis的签名记录
+func NewRedisSignatureReplayStore(redis contract.IRedis) *RedisSignatureReplayStore {
+	return &RedisSignatureReplayStore{redis: redis}
+}
+
+// Mark 记录签名，签名已经存在时SET NX返回nil
+func (s *RedisSignatureReplayStore) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	reply, err := s.redis.Do(ctx, "SET", key, "1", "PX", ttl.Milliseconds(), "NX")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
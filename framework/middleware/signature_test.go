@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSignatureSecret = "signature-test-secret"
+
+func newSignatureEngine(conf SignatureConfig) *gin.Engine {
+	engine := gin.New()
+	engine.POST("/webhook", SignatureWithConfig(conf), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, c.GetString(ContextSignatureKey)+":"+string(body))
+	})
+	return engine
+}
+
+// signedRequest 生成指定时间签名的请求
+func signedRequest(t *testing.T, secret string, at time.Time, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook?id=1", strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	signature, err := ComputeSignature("sha256", secret, SignatureString(req.Method, "/webhook?id=1", timestamp, []byte(body)))
+	assert.NoError(t, err)
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature", "sha256="+signature)
+	return req
+}
+
+func TestSignatureReplay(t *testing.T) {
+	engine := newSignatureEngine(SignatureConfig{Name: "partner", Secrets: []string{testSignatureSecret}})
+	req := signedRequest(t, testSignatureSecret, time.Now(), `{"event":"paid"}`)
+	header := req.Header.Clone()
+
+	w := serve(engine, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// 校验签名之后请求体可以再次读取
+	assert.Equal(t, `partner:{"event":"paid"}`, w.Body.String())
+
+	// 同一个签名只能使用一次
+	req = httptest.NewRequest(http.MethodPost, "/webhook?id=1", strings.NewReader(`{"event":"paid"}`))
+	req.Header = header
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, req).Code)
+}
+
+func TestSignatureTimestampWindow(t *testing.T) {
+	engine := newSignatureEngine(SignatureConfig{Secrets: []string{testSignatureSecret}, Window: "1m"})
+	assert.Equal(t, http.StatusOK, serve(engine, signedRequest(t, testSignatureSecret, time.Now().Add(-30*time.Second), "a")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, signedRequest(t, testSignatureSecret, time.Now().Add(-2*time.Minute), "b")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, signedRequest(t, testSignatureSecret, time.Now().Add(2*time.Minute), "c")).Code)
+
+	req := signedRequest(t, testSignatureSecret, time.Now(), "d")
+	req.Header.Set("X-Signature-Timestamp", "now")
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, req).Code)
+}
+
+func TestSignatureInvalid(t *testing.T) {
+	engine := newSignatureEngine(SignatureConfig{Secrets: []string{"rotated-signature-secret", testSignatureSecret}})
+	// 轮换密钥时旧密钥仍然有效
+	assert.Equal(t, http.StatusOK, serve(engine, signedRequest(t, testSignatureSecret, time.Now(), "a")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, signedRequest(t, "unknown-signature-secret", time.Now(), "b")).Code)
+
+	// 请求体被修改
+	req := signedRequest(t, testSignatureSecret, time.Now(), "c")
+	req.Body = io.NopCloser(strings.NewReader("tampered"))
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, req).Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, req).Code)
+}
+
+func TestSignatureInvalidSecret(t *testing.T) {
+	for _, secrets := range [][]string{{"env(WEBHOOK_SECRET)"}, {"short"}} {
+		engine := newSignatureEngine(SignatureConfig{Secrets: secrets})
+		w := serve(engine, signedRequest(t, secrets[0], time.Now(), "a"))
+		assert.Equal(t, http.StatusInternalServerError, w.Code, secrets[0])
+	}
+	// 没有配置密钥时拒绝所有请求
+	engine := newSignatureEngine(SignatureConfig{})
+	assert.Equal(t, http.StatusUnauthorized, serve(engine, signedRequest(t, "", time.Now(), "a")).Code)
+}
+
+func TestMemorySignatureReplayStore(t *testing.T) {
+	store := NewMemorySignatureReplayStore()
+	fresh, err := store.Mark(context.Background(), "a", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = store.Mark(context.Background(), "a", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+
+	time.Sleep(80 * time.Millisecond)
+	fresh, err = store.Mark(context.Background(), "a", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// SignedURLExpiresParam 签名url中过期时间的query参数，值为unix秒
+	SignedURLExpiresParam = "expires"
+	// SignedURLSignatureParam 签名url中签名的query参数
+	SignedURLSignatureParam = "signature"
+)
+
+var (
+	// ErrSignedURLInvalid 签名url缺少参数或者签名不正确
+	ErrSignedURLInvalid = errors.New("invalid signature")
+	// ErrSignedURLExpired 签名url已经过期
+	ErrSignedURLExpired = errors.New("signed url expired")
+)
+
+// SignedURLConfig 定义了签名url的配置，对应配置文件中的 app.signed_url
+type SignedURLConfig struct {
+	// Secrets 有效的密钥，第一个用于生成签名，全部用于校验，轮换密钥时把新密钥放在最前面
+	Secrets []string `yaml:"secrets"`
+	// TTL 默认的有效期，默认 1h
+	TTL string `yaml:"ttl"`
+}
+
+// URLSigner 生成和校验带过期时间的签名url，签名覆盖路径和除签名以外的所有query参数
+type URLSigner struct {
+	secrets [][]byte
+	ttl     time.Duration
+}
+
+// NewURLSigner 使用配置创建签名url工具，密钥是没有设置的环境变量或者过短时返回错误
+func NewURLSigner(conf SignedURLConfig) (*URLSigner, error) {
+	secrets, err := hmacSecrets(conf.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("signed url: %w", err)
+	}
+	return &URLSigner{secrets: secrets, ttl: parseDurationDefault(conf.TTL, time.Hour)}, nil
+}
+
+// signedURLSignature 计算路径和query的签名，query按照参数名排序
+func signedURLSignature(secret []byte, path string, query url.Values) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path + "?" + query.Encode()))
+	return mac.Sum(nil)
+}
+
+// Sign 为路径生成签名url，ttl为0时使用默认的有效期，返回路径和query，例如 /download/1?expires=...&signature=...
+func (s *URLSigner) Sign(path string, query url.Values, ttl time.Duration) (string, error) {
+	if len(s.secrets) == 0 {
+		return "", errors.New("signed url: no secret configured")
+	}
+	if ttl <= 0 {
+		ttl = s.ttl
+	}
+	values := url.Values{}
+	for key, value := range query {
+		values[key] = append([]string(nil), value...)
+	}
+	values.Del(SignedURLSignatureParam)
+	values.Set(SignedURLExpiresParam, strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	escaped := (&url.URL{Path: path}).EscapedPath()
+	signature := signedURLSignature(s.secrets[0], escaped, values)
+	values.Set(SignedURLSignatureParam, base64.RawURLEncoding.EncodeToString(signature))
+	return escaped + "?" + values.Encode(), nil
+}
+
+// SignRoute 为引擎上注册的路由生成签名url，params填充路由中的 :name 和 *name 参数
+func (s *URLSigner) SignRoute(engine *gin.Engine, method, route string, params map[string]string, query url.Values, ttl time.Duration) (string, error) {
+	registered := false
+	for _, info := range engine.Routes() {
+		if info.Method == method && info.Path == route {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return "", fmt.Errorf("signed url: route %s %s is not registered", method, route)
+	}
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		value, ok := params[segment[1:]]
+		if !ok {
+			return "", fmt.Errorf("signed url: missing param %s of route %s", segment[1:], route)
+		}
+		if segment[0] == ':' && (value == "" || strings.Contains(value, "/")) {
+			return "", fmt.Errorf("signed url: invalid param %s of route %s", segment[1:], route)
+		}
+		// 通配参数的值包含开头的/
+		if segment[0] == '*' {
+			value = strings.TrimPrefix(value, "/")
+		}
+		segments[i] = value
+	}
+	return s.Sign(strings.Join(segments, "/"), query, ttl)
+}
+
+// Verify 校验url的签名和过期时间
+func (s *URLSigner) Verify(u *url.URL) error {
+	query := u.Query()
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get(SignedURLSignatureParam))
+	if err != nil || len(signature) == 0 {
+		return ErrSignedURLInvalid
+	}
+	expires, err := strconv.ParseInt(query.Get(SignedURLExpiresParam), 10, 64)
+	if err != nil {
+		return ErrSignedURLInvalid
+	}
+	query.Del(SignedURLSignatureParam)
+	valid := false
+	for _, secret := range s.secrets {
+		if hmac.Equal(signedURLSignature(secret, u.EscapedPath(), query), signature) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrSignedURLInvalid
+	}
+	if time.Now().Unix() > expires {
+		return ErrSignedURLExpired
+	}
+	return nil
+}
+
+// signedURLReloader 签名url的配置，生成和校验共享，修改配置文件后不需要重启服务
+var signedURLReloader = newConfigReloader("app.signed_url", func(configService contract.IConfig) (interface{}, error) {
+	conf := SignedURLConfig{}
+	if configService.IsExist("app.signed_url") {
+		if err := configService.Load("app.signed_url", &conf); err != nil {
+			return nil, err
+		}
+	}
+	return NewURLSigner(conf)
+})
+
+// SignURL 使用 app.signed_url 的配置为当前引擎上注册的路由生成签名url
+// 例如 SignURL(c, http.MethodGet, "/download/:id", map[string]string{"id": "1"}, nil, 0)
+func SignURL(c *gin.Context, method, route string, params map[string]string, query url.Values, ttl time.Duration) (string, error) {
+	signer, ok := signedURLReloader.get(c).(*URLSigner)
+	if !ok {
+		return "", errors.New("signed url: load config error")
+	}
+	return signer.SignRoute(c.Engine(), method, route, params, query, ttl)
+}
+
+// SignedURL 签名url校验中间件，使用 app.signed_url 的配置，签名不正确或者过期时返回403，配置无效时返回500
+func SignedURL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		signer, ok := signedURLReloader.get(c).(*URLSigner)
+		if !ok {
+			RenderError(c, NewHttpError(http.StatusInternalServerError, "", errors.New("signed url: invalid config")))
+			return
+		}
+		signedURLVerify(c, signer)
+	}
+}
+
+// SignedURLWithConfig 使用配置创建签名url校验中间件，配置无效时所有请求返回500
+func SignedURLWithConfig(conf SignedURLConfig) gin.HandlerFunc {
+	signer, err := NewURLSigner(conf)
+	if err != nil {
+		return func(c *gin.Context) {
+			RenderError(c, NewHttpError(http.StatusInternalServerError, "", err))
+		}
+	}
+	return func(c *gin.Context) {
+		signedURLVerify(c, signer)
+	}
+}
+
+func signedURLVerify(c *gin.Context, signer *URLSigner) {
+	if err := signer.Verify(c.Request.URL); err != nil {
+		RenderError(c, NewHttpError(http.StatusForbidden, err.Error(), nil))
+		return
+	}
+	c.Next()
+}
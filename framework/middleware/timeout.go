@@ -2,41 +2,114 @@ package middleware
 
 import (
 	"context"
-	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/YunzeGao/fire/framework/gin"
 )
 
+// TimeoutConfig 定义了超时中间件的配置
+type TimeoutConfig struct {
+	// Timeout 默认的超时时间，小于等于0表示不限制
+	Timeout time.Duration
+	// Routes 按照路由(例如 /user/:id)单独设置超时时间，优先级高于Timeout
+	Routes map[string]time.Duration
+	// StatusCode 超时时返回的状态码，默认为503
+	StatusCode int
+	// Response 自定义超时的响应，为空时返回json格式的提示信息
+	// 超时后handler可能还在执行，响应需要设置 Content-Length，客户端才能在handler返回之前收到完整的响应
+	Response func(w gin.ResponseWriter, req *http.Request)
+}
+
+// timeoutFor 获取当前请求的超时时间
+func (conf *TimeoutConfig) timeoutFor(c *gin.Context) time.Duration {
+	if d, ok := conf.Routes[c.FullPath()]; ok {
+		return d
+	}
+	return conf.Timeout
+}
+
+// writeTimeout 写出超时响应
+func (conf *TimeoutConfig) writeTimeout(w gin.ResponseWriter, req *http.Request) {
+	if conf.Response != nil {
+		conf.Response(w, req)
+		return
+	}
+	status := conf.StatusCode
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	body := `{"msg":"timeout"}`
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, _ = w.WriteString(body)
+}
+
+// Timeout 为请求设置超时时间，超时后返回503
 func Timeout(duration time.Duration) gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		finish := make(chan struct{}, 1)
-		panicChan := make(chan interface{}, 1)
+	return TimeoutWithConfig(TimeoutConfig{Timeout: duration})
+}
 
-		durationCtx, cancel := context.WithTimeout(ctx.BaseContext(), duration)
+// TimeoutWithConfig 使用配置创建超时中间件
+// 后续的handler在单独的goroutine中执行，响应先写入缓存，只有在超时之前完成才会提交。
+// 超时之后直接向客户端返回超时响应，并且通过 Request.Context() 通知handler已经超时，
+// 中间件会等待handler返回之后再结束，保证 gin.Context 不会在handler仍在使用时被回收。
+// handler中的panic会连同handler goroutine的堆栈包装为 PanicError 在当前goroutine中重新抛出，交给recovery中间件处理。
+func TimeoutWithConfig(conf TimeoutConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		duration := conf.timeoutFor(c)
+		if duration <= 0 {
+			c.Next()
+			return
+		}
+
+		origin := c.Writer
+		req := c.Request
+		timeoutCtx, cancel := context.WithTimeout(req.Context(), duration)
 		defer cancel()
 
+		buffer := newBufferWriter(origin)
+		c.Writer = buffer
+		c.Request = req.WithContext(timeoutCtx)
+
+		finish := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
 		go func() {
+			defer close(finish)
 			defer func() {
 				if p := recover(); p != nil {
+					// http.ErrAbortHandler 需要原样交给net/http处理
+					if p != http.ErrAbortHandler {
+						p = &PanicError{Value: p, Stack: debug.Stack()}
+					}
 					panicChan <- p
 				}
 			}()
-			ctx.Next()
-			finish <- struct{}{}
+			c.Next()
 		}()
+
 		select {
-		case p := <-panicChan:
-			_ = ctx.ISetStatus(500).IJson(map[string]interface{}{
-				"msg": "timeout",
-			})
-			log.Println(p)
 		case <-finish:
-			log.Println("finish = ", finish)
-		case <-durationCtx.Done():
-			_ = ctx.ISetStatus(500).IJson(map[string]interface{}{
-				"msg": "timeout",
-			})
+		case <-timeoutCtx.Done():
+			if timeoutCtx.Err() == context.DeadlineExceeded {
+				// 丢弃handler的输出，只提交超时响应
+				buffer.Discard()
+				conf.writeTimeout(origin, req)
+				origin.Flush()
+			}
+			<-finish
+		}
+
+		c.Writer = origin
+		c.Request = req
+		select {
+		case p := <-panicChan:
+			panic(p)
+		default:
 		}
+		buffer.Commit()
 	}
 }
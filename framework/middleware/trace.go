@@ -1,19 +1,66 @@
 package middleware
 
 import (
+	"fmt"
+	"net/http"
+	"sync"
+
 	"github.com/YunzeGao/fire/framework/contract"
 	"github.com/YunzeGao/fire/framework/gin"
 )
 
-// Trace recovery机制，将协程中的函数异常进行捕获
+// Trace 从请求头中提取上游传递的trace并写入gin.Context，支持的格式在 trace.propagators 中配置
+// 每个请求对应一个server类型的span，请求结束时记录路由、状态码等属性，5xx和handler记录的错误标记为出错
+// trace id通过 trace.response_header 配置的响应头返回，默认 X-Trace-Id，配置为空字符串时不返回
 func Trace() gin.HandlerFunc {
+	var once sync.Once
+	responseHeader := "X-Trace-Id"
 	// 使用函数回调
 	return func(c *gin.Context) {
-		// 记录开始时间
+		once.Do(func() {
+			configService := c.MustMakeConfig()
+			if configService.IsExist("trace.response_header") {
+				responseHeader = configService.GetString("trace.response_header")
+			}
+		})
 		tracer := c.MustMake(contract.TraceKey).(contract.Trace)
 		traceCtx := tracer.ExtractHTTP(c.Request)
+		traceCtx.Kind = contract.SpanKindServer
+		// 路由在中间件执行前已经匹配，没有匹配到路由时只使用请求方法，避免名称过多
+		traceCtx.Name = c.Request.Method
+		if route := c.FullPath(); route != "" {
+			traceCtx.Name = c.Request.Method + " " + route
+			traceCtx.SetAttribute("http.route", route)
+		}
 		tracer.WithTrace(c, traceCtx)
+		if responseHeader != "" {
+			c.ISetHeader(responseHeader, traceCtx.TraceID)
+		}
+		defer func() {
+			// panic交给外层的Recovery处理，这里只标记span出错
+			if p := recover(); p != nil {
+				traceCtx.SetStatus(contract.SpanStatusError, fmt.Sprint(p))
+				tracer.FinishSpan(traceCtx)
+				panic(p)
+			}
+			tracer.FinishSpan(traceCtx)
+		}()
 		// 使用next执行具体的业务逻辑
 		c.Next()
+
+		status := c.Writer.Status()
+		traceCtx.SetAttribute("http.method", c.Request.Method)
+		traceCtx.SetAttribute("http.target", c.Request.URL.Path)
+		traceCtx.SetAttribute("http.status_code", status)
+		traceCtx.SetAttribute("net.peer.ip", c.ClientIP())
+		if userAgent := c.Request.UserAgent(); userAgent != "" {
+			traceCtx.SetAttribute("http.user_agent", userAgent)
+		}
+		if err := c.Errors.Last(); err != nil {
+			traceCtx.RecordError(err.Err)
+		}
+		if status >= http.StatusInternalServerError && traceCtx.Status != contract.SpanStatusError {
+			traceCtx.SetStatus(contract.SpanStatusError, http.StatusText(status))
+		}
 	}
 }
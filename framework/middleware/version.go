@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+const (
+	// VersionHeader 在响应头中输出版本号
+	VersionHeader = "X-App-Version"
+	// CommitHeader 在响应头中输出git commit
+	CommitHeader = "X-App-Commit"
+)
+
+// Version 在每个响应中设置 X-App-Version 和 X-App-Commit 头，配置 app.version_header 为true时开启，默认关闭
+// 版本号和commit会暴露给所有客户端，只在内部服务或者需要排查问题时开启
+func Version() gin.HandlerFunc {
+	var once sync.Once
+	var enabled bool
+	return func(c *gin.Context) {
+		once.Do(func() {
+			enabled = c.MustMakeConfig().GetBool("app.version_header")
+		})
+		if !enabled {
+			c.Next()
+			return
+		}
+		info := c.MustMakeAPP().BuildInfo()
+		c.ISetHeader(VersionHeader, info.Version)
+		if info.GitCommit != "" {
+			commit := info.GitCommit
+			if len(commit) > 12 {
+				commit = commit[:12]
+			}
+			c.ISetHeader(CommitHeader, commit)
+		}
+		c.Next()
+	}
+}
+
+// VersionInfo 以json格式返回完整的构建信息，可以挂载为 /version 接口，默认只挂载在管理端口上
+func VersionInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.ISetStatus(http.StatusOK).IJson(c.MustMakeAPP().BuildInfo())
+	}
+}
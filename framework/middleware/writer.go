@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/gin"
+)
+
+// bufferWriter 将handler的响应缓存在内存中，由中间件决定何时以及是否提交到原始的writer
+type bufferWriter struct {
+	origin gin.ResponseWriter
+
+	lock    sync.Mutex
+	header  http.Header
+	body    bytes.Buffer
+	status  int
+	size    int
+	discard bool
+}
+
+var _ gin.ResponseWriter = (*bufferWriter)(nil)
+
+// newBufferWriter 创建一个缓存writer，初始header为原始writer当前header的拷贝
+func newBufferWriter(origin gin.ResponseWriter) *bufferWriter {
+	return &bufferWriter{
+		origin: origin,
+		header: origin.Header().Clone(),
+		status: http.StatusOK,
+		size:   -1,
+	}
+}
+
+// Header 返回缓存的header
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader 记录状态码
+func (w *bufferWriter) WriteHeader(code int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if code > 0 && w.size == -1 {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow 标记header已经写入
+func (w *bufferWriter) WriteHeaderNow() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.size == -1 {
+		w.size = 0
+	}
+}
+
+// Write 写入缓存，被丢弃之后的写入会被直接忽略，避免gin的render因为写入失败而panic
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.discard {
+		return len(data), nil
+	}
+	if w.size == -1 {
+		w.size = 0
+	}
+	n, err := w.body.Write(data)
+	w.size += n
+	return n, err
+}
+
+// WriteString 写入字符串
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Status 当前的状态码
+func (w *bufferWriter) Status() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.status
+}
+
+// Size 已经写入的body大小
+func (w *bufferWriter) Size() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.size
+}
+
+// Written header是否已经写入
+func (w *bufferWriter) Written() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.size != -1
+}
+
+// Flush 缓存模式下flush不做任何事情，数据在提交时统一写出
+func (w *bufferWriter) Flush() {}
+
+// Hijack 缓存模式下不支持hijack
+func (w *bufferWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack is not supported by buffered response writer")
+}
+
+// CloseNotify 使用原始writer的CloseNotify
+func (w *bufferWriter) CloseNotify() <-chan bool {
+	return w.origin.CloseNotify()
+}
+
+// Pusher 缓存模式下不支持server push
+func (w *bufferWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// Bytes 获取缓存的body
+func (w *bufferWriter) Bytes() []byte {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.body.Bytes()
+}
+
+// Discard 丢弃缓存，之后的写入都会失败
+func (w *bufferWriter) Discard() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.discard = true
+	w.body.Reset()
+}
+
+// Commit 将缓存的header，状态码和body写入原始writer
+func (w *bufferWriter) Commit() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.discard {
+		return
+	}
+	w.discard = true
+	dst := w.origin.Header()
+	for k := range dst {
+		if _, ok := w.header[k]; !ok {
+			dst.Del(k)
+		}
+	}
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	w.origin.WriteHeader(w.status)
+	if w.size == -1 {
+		return
+	}
+	if w.body.Len() > 0 {
+		_, _ = w.origin.Write(w.body.Bytes())
+	} else {
+		w.origin.WriteHeaderNow()
+	}
+}
+
+// handlerHeader 获取handler设置的响应头，用于保存和重放响应
+// 外层中间件设置的响应头和cookie在重放时会重新生成，所以不保存
+func handlerHeader(before, after http.Header) http.Header {
+	header := http.Header{}
+	for k, v := range after {
+		if k == "Set-Cookie" {
+			continue
+		}
+		if old, ok := before[k]; ok && strings.Join(old, "\n") == strings.Join(v, "\n") {
+			continue
+		}
+		header[k] = v
+	}
+	return header
+}
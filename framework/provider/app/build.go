@@ -0,0 +1,68 @@
+package app
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// 以下变量在构建时通过ldflags注入，没有注入的字段会尝试从 debug.ReadBuildInfo 中获取，例如:
+//
+//	go build -ldflags "-X github.com/YunzeGao/fire/framework/provider/app.Version=1.0.0 \
+//	  -X github.com/YunzeGao/fire/framework/provider/app.GitCommit=$(git rev-parse HEAD) \
+//	  -X github.com/YunzeGao/fire/framework/provider/app.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	// Version 版本号
+	Version = ""
+	// GitCommit git commit
+	GitCommit = ""
+	// BuildTime 构建时间
+	BuildTime = ""
+	// Dirty 工作区是否有未提交的修改，取值为 true/false
+	Dirty = ""
+)
+
+// defaultVersion 没有任何构建信息时使用的版本号
+const defaultVersion = "0.1"
+
+// loadBuildInfo 合并ldflags注入的信息和go构建时记录的信息
+func loadBuildInfo() *contract.BuildInfo {
+	info := &contract.BuildInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	info.Dirty, _ = strconv.ParseBool(Dirty)
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.GitCommit == "" {
+					info.GitCommit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				if Dirty == "" {
+					info.Dirty = setting.Value == "true"
+				}
+			}
+		}
+		if bi.GoVersion != "" {
+			info.GoVersion = bi.GoVersion
+		}
+	}
+	if info.Version == "" {
+		info.Version = defaultVersion
+	}
+	return info
+}
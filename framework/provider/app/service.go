@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
 	"github.com/YunzeGao/fire/framework/util"
 )
 
@@ -12,6 +13,7 @@ type FireApp struct {
 	container  framework.IContainer // 服务容器
 	baseFolder string               // 基础路径
 	configMap  map[string]string    // 加载配置文件
+	buildInfo  *contract.BuildInfo  // 构建信息
 }
 
 // NewFireApp 初始化FireApp
@@ -23,11 +25,16 @@ func NewFireApp(params ...interface{}) (interface{}, error) {
 	// 有两个参数，一个是容器，一个是baseFolder
 	container := params[0].(framework.IContainer)
 	baseFolder := params[1].(string)
-	return &FireApp{baseFolder: baseFolder, container: container}, nil
+	return &FireApp{baseFolder: baseFolder, container: container, buildInfo: loadBuildInfo()}, nil
 }
 
 func (app *FireApp) Version() string {
-	return "0.1"
+	return app.buildInfo.Version
+}
+
+// BuildInfo 获取构建信息
+func (app *FireApp) BuildInfo() *contract.BuildInfo {
+	return app.buildInfo
 }
 
 func (app *FireApp) BaseFolder() string {
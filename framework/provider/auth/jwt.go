@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+// jwtHeader JWT的header
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// sign 使用key对签名内容签名
+func sign(key *authKey, signing string) ([]byte, error) {
+	digest := sha256.Sum256([]byte(signing))
+	switch key.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(signing))
+		return mac.Sum(nil), nil
+	case AlgRS256:
+		private, ok := key.private.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("RS256 requires rsa private key")
+		}
+		return rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+	case AlgES256:
+		private, ok := key.private.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("ES256 requires ecdsa private key")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, private, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS中ES256的签名是定长的 r||s，每部分32字节
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+	return nil, errors.Errorf("unsupported algorithm %s", key.alg)
+}
+
+// verify 校验签名
+func verify(key *authKey, signing string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signing))
+	switch key.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(signing))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case AlgRS256:
+		public, ok := key.public.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	case AlgES256:
+		public, ok := key.public.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(public, digest[:], r, s)
+	}
+	return false
+}
+
+// encodeToken 生成签名后的token
+func encodeToken(key *authKey, claims *contract.Claims) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: key.alg, Typ: "JWT", Kid: key.kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signing := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+	signature, err := sign(key, signing)
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + encoding.EncodeToString(signature), nil
+}
+
+// decodeToken 解析token，通过lookup根据header查找key并校验签名，不校验声明
+func decodeToken(token string, lookup func(header *jwtHeader) []*authKey) (*contract.Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, contract.ErrTokenMalformed
+	}
+	headerBytes, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, contract.ErrTokenMalformed
+	}
+	header := &jwtHeader{}
+	if err := json.Unmarshal(headerBytes, header); err != nil {
+		return nil, contract.ErrTokenMalformed
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, contract.ErrTokenMalformed
+	}
+	signing := parts[0] + "." + parts[1]
+	verified := false
+	for _, key := range lookup(header) {
+		// header中的alg必须和key的算法一致，避免算法混淆攻击
+		if key.alg == header.Alg && verify(key, signing, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, contract.ErrTokenSignature
+	}
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, contract.ErrTokenMalformed
+	}
+	claims := &contract.Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, contract.ErrTokenMalformed
+	}
+	return claims, nil
+}
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// AlgHS256 HMAC SHA-256
+	AlgHS256 = "HS256"
+	// AlgRS256 RSA PKCS#1 v1.5 SHA-256
+	AlgRS256 = "RS256"
+	// AlgES256 ECDSA P-256 SHA-256
+	AlgES256 = "ES256"
+)
+
+// FireAuthKeyConfig 一个签名key的配置
+type FireAuthKeyConfig struct {
+	// Kid key的标识，写入token的header中，用于轮换key
+	Kid string `yaml:"kid"`
+	// Algorithm 签名算法: HS256、RS256、ES256
+	Algorithm string `yaml:"algorithm"`
+	// Secret HS256使用的密钥
+	Secret string `yaml:"secret"`
+	// PublicKey RS256/ES256 校验使用的公钥，PEM内容或者相对于项目根目录的文件路径
+	PublicKey string `yaml:"public_key"`
+	// PrivateKey RS256/ES256 签发使用的私钥，PEM内容或者相对于项目根目录的文件路径，只用于校验时可以不设置
+	PrivateKey string `yaml:"private_key"`
+}
+
+// authKey 解析后的key
+type authKey struct {
+	kid     string
+	alg     string
+	secret  []byte
+	public  crypto.PublicKey
+	private crypto.Signer
+}
+
+// canSign key是否可以用来签发token
+func (k *authKey) canSign() bool {
+	if k.alg == AlgHS256 {
+		return len(k.secret) > 0
+	}
+	return k.private != nil
+}
+
+// readPem 读取PEM内容，不是PEM内容时作为文件路径读取
+func readPem(baseFolder, value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	if !filepath.IsAbs(value) {
+		value = filepath.Join(baseFolder, value)
+	}
+	return os.ReadFile(value)
+}
+
+// parsePublicKey 解析PEM格式的公钥，支持PKIX和PKCS#1格式，也支持证书
+func parsePublicKey(content []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("invalid pem public key")
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// parsePrivateKey 解析PEM格式的私钥，支持PKCS#8、PKCS#1和SEC 1格式
+func parsePrivateKey(content []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("invalid pem private key")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key")
+	}
+	return signer, nil
+}
+
+// checkKeyType 检查key的类型和算法是否匹配
+func checkKeyType(alg string, public crypto.PublicKey) error {
+	switch alg {
+	case AlgRS256:
+		if _, ok := public.(*rsa.PublicKey); !ok {
+			return errors.New("RS256 requires rsa key")
+		}
+	case AlgES256:
+		key, ok := public.(*ecdsa.PublicKey)
+		if !ok || key.Curve != elliptic.P256() {
+			return errors.New("ES256 requires ecdsa P-256 key")
+		}
+	default:
+		return errors.Errorf("unsupported algorithm %s", alg)
+	}
+	return nil
+}
+
+// newAuthKey 根据配置创建key
+func newAuthKey(baseFolder string, conf FireAuthKeyConfig) (*authKey, error) {
+	key := &authKey{kid: conf.Kid, alg: strings.ToUpper(conf.Algorithm)}
+	if key.alg == "" {
+		key.alg = AlgHS256
+	}
+	if key.alg == AlgHS256 {
+		// 没有被替换的env(XXX)说明环境变量没有设置，不能作为密钥使用
+		if conf.Secret == "" || strings.HasPrefix(conf.Secret, "env(") {
+			return nil, errors.Errorf("key %s: HS256 requires secret", conf.Kid)
+		}
+		key.secret = []byte(conf.Secret)
+		return key, nil
+	}
+	if conf.PrivateKey != "" {
+		content, err := readPem(baseFolder, conf.PrivateKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %s", conf.Kid)
+		}
+		if key.private, err = parsePrivateKey(content); err != nil {
+			return nil, errors.Wrapf(err, "key %s", conf.Kid)
+		}
+		key.public = key.private.Public()
+	}
+	if conf.PublicKey != "" {
+		content, err := readPem(baseFolder, conf.PublicKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %s", conf.Kid)
+		}
+		if key.public, err = parsePublicKey(content); err != nil {
+			return nil, errors.Wrapf(err, "key %s", conf.Kid)
+		}
+	}
+	if key.public == nil {
+		return nil, errors.Errorf("key %s: %s requires public_key or private_key", conf.Kid, key.alg)
+	}
+	if err := checkKeyType(key.alg, key.public); err != nil {
+		return nil, errors.Wrapf(err, "key %s", conf.Kid)
+	}
+	return key, nil
+}
+
+// jwk JWKS中的一个key，只支持校验使用的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// decodeBigInt 解析base64url编码的大整数
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// parseJwks 解析JWKS文件，不支持的key会被忽略
+func parseJwks(content []byte) (map[string]*authKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*authKey{}
+	for _, item := range set.Keys {
+		if item.Use != "" && item.Use != "sig" {
+			continue
+		}
+		key := &authKey{kid: item.Kid, alg: item.Alg}
+		switch item.Kty {
+		case "RSA":
+			n, err := decodeBigInt(item.N)
+			if err != nil {
+				return nil, errors.Wrapf(err, "jwk %s", item.Kid)
+			}
+			e, err := decodeBigInt(item.E)
+			if err != nil {
+				return nil, errors.Wrapf(err, "jwk %s", item.Kid)
+			}
+			key.public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+			if key.alg == "" {
+				key.alg = AlgRS256
+			}
+		case "EC":
+			if item.Crv != "P-256" {
+				continue
+			}
+			x, err := decodeBigInt(item.X)
+			if err != nil {
+				return nil, errors.Wrapf(err, "jwk %s", item.Kid)
+			}
+			y, err := decodeBigInt(item.Y)
+			if err != nil {
+				return nil, errors.Wrapf(err, "jwk %s", item.Kid)
+			}
+			key.public = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+			if key.alg == "" {
+				key.alg = AlgES256
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(item.K, "="))
+			if err != nil {
+				return nil, errors.Wrapf(err, "jwk %s", item.Kid)
+			}
+			key.secret = secret
+			if key.alg == "" {
+				key.alg = AlgHS256
+			}
+		default:
+			continue
+		}
+		if key.alg != AlgHS256 {
+			if err := checkKeyType(key.alg, key.public); err != nil {
+				continue
+			}
+		} else if len(key.secret) == 0 {
+			continue
+		}
+		keys[key.kid] = key
+	}
+	return keys, nil
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// FireAuthProvider 提供JWT认证服务，配置从 auth.yaml 中读取
+type FireAuthProvider struct {
+}
+
+// Register 注册实例化方法
+func (provider *FireAuthProvider) Register(container framework.IContainer) framework.NewInstance {
+	return NewFireAuth
+}
+
+// Boot 启动时不需要做准备工作
+func (provider *FireAuthProvider) Boot(container framework.IContainer) error {
+	return nil
+}
+
+// IsDefer 第一次使用时才加载key
+func (provider *FireAuthProvider) IsDefer() bool {
+	return true
+}
+
+// Params 实例化参数
+func (provider *FireAuthProvider) Params(container framework.IContainer) []interface{} {
+	return []interface{}{container}
+}
+
+// Name 字符串凭证
+func (provider *FireAuthProvider) Name() string {
+	return contract.AuthKey
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+)
+
+// FireAuthConfig 对应配置文件 auth.yaml
+type FireAuthConfig struct {
+	// Issuer 签发者，设置后校验token的iss
+	Issuer string `yaml:"issuer"`
+	// Audience 受众，设置后token的aud需要包含其中之一
+	Audience []string `yaml:"audience"`
+	// TTL 签发的token的有效期，默认2h
+	TTL string `yaml:"ttl"`
+	// Leeway 校验exp/nbf时允许的时钟误差，默认30s
+	Leeway string `yaml:"leeway"`
+	// RequireExp 是否拒绝没有exp的token，默认true，只有明确配置为false时才允许永久有效的token
+	RequireExp *bool `yaml:"require_exp"`
+	// Kid 签发token使用的key，为空时使用第一个可以签发的key
+	Kid string `yaml:"kid"`
+	// Keys 签名key，轮换key时新key用于签发，旧key保留用于校验
+	Keys []FireAuthKeyConfig `yaml:"keys"`
+	// Jwks 本地JWKS文件，相对于项目根目录，其中的key只用于校验，文件变更后自动重新加载
+	Jwks string `yaml:"jwks"`
+}
+
+// FireAuth JWT认证服务
+type FireAuth struct {
+	config   FireAuthConfig
+	ttl      time.Duration
+	leeway   time.Duration
+	keys     map[string]*authKey
+	ordered  []*authKey
+	signer   *authKey
+	jwksFile string
+
+	lock        sync.Mutex
+	jwksChecked time.Time
+	jwksModTime time.Time
+	jwksKeys    map[string]*authKey
+}
+
+var _ contract.IAuth = (*FireAuth)(nil)
+
+// NewFireAuth 初始化认证服务，加载配置中的key
+func NewFireAuth(params ...interface{}) (interface{}, error) {
+	container := params[0].(framework.IContainer)
+	config := FireAuthConfig{}
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	if configService.IsExist("auth") {
+		if err := configService.Load("auth", &config); err != nil {
+			return nil, errors.Wrap(err, "load auth config error")
+		}
+	}
+	baseFolder := container.MustMake(contract.AppKey).(contract.App).BaseFolder()
+	return NewFireAuthWithConfig(baseFolder, config)
+}
+
+// NewFireAuthWithConfig 使用配置创建认证服务，baseFolder用于解析key文件的相对路径
+func NewFireAuthWithConfig(baseFolder string, config FireAuthConfig) (*FireAuth, error) {
+	auth := &FireAuth{
+		config: config,
+		ttl:    2 * time.Hour,
+		leeway: 30 * time.Second,
+		keys:   map[string]*authKey{},
+	}
+	if d, err := time.ParseDuration(config.TTL); err == nil && d > 0 {
+		auth.ttl = d
+	}
+	if d, err := time.ParseDuration(config.Leeway); err == nil && d >= 0 {
+		auth.leeway = d
+	}
+	for _, keyConfig := range config.Keys {
+		key, err := newAuthKey(baseFolder, keyConfig)
+		if err != nil {
+			return nil, err
+		}
+		auth.keys[key.kid] = key
+		auth.ordered = append(auth.ordered, key)
+		if auth.signer == nil && key.canSign() && (config.Kid == "" || config.Kid == key.kid) {
+			auth.signer = key
+		}
+	}
+	if config.Jwks != "" {
+		auth.jwksFile = config.Jwks
+		if !filepath.IsAbs(auth.jwksFile) {
+			auth.jwksFile = filepath.Join(baseFolder, auth.jwksFile)
+		}
+		if _, err := auth.loadJwks(); err != nil {
+			return nil, err
+		}
+	}
+	return auth, nil
+}
+
+// loadJwks 获取JWKS中的key，每隔5秒最多检查一次文件变更
+func (auth *FireAuth) loadJwks() (map[string]*authKey, error) {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	now := time.Now()
+	if now.Sub(auth.jwksChecked) < 5*time.Second {
+		return auth.jwksKeys, nil
+	}
+	auth.jwksChecked = now
+	info, err := os.Stat(auth.jwksFile)
+	if err != nil {
+		return auth.jwksKeys, errors.Wrap(err, "load jwks error")
+	}
+	if info.ModTime().Equal(auth.jwksModTime) {
+		return auth.jwksKeys, nil
+	}
+	content, err := os.ReadFile(auth.jwksFile)
+	if err != nil {
+		return auth.jwksKeys, errors.Wrap(err, "load jwks error")
+	}
+	keys, err := parseJwks(content)
+	if err != nil {
+		// 文件格式错误时继续使用上一次加载的key
+		return auth.jwksKeys, errors.Wrap(err, "parse jwks error")
+	}
+	auth.jwksModTime = info.ModTime()
+	auth.jwksKeys = keys
+	return keys, nil
+}
+
+// lookup 根据kid查找校验使用的key，token没有kid时尝试所有key
+func (auth *FireAuth) lookup(header *jwtHeader) []*authKey {
+	var jwks map[string]*authKey
+	if auth.jwksFile != "" {
+		jwks, _ = auth.loadJwks()
+	}
+	if header.Kid != "" {
+		if key, ok := auth.keys[header.Kid]; ok {
+			return []*authKey{key}
+		}
+		if key, ok := jwks[header.Kid]; ok {
+			return []*authKey{key}
+		}
+		return nil
+	}
+	keys := append([]*authKey{}, auth.ordered...)
+	for _, key := range jwks {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Verify 校验token的签名、有效期、签发者和受众，默认要求token带有exp
+func (auth *FireAuth) Verify(ctx context.Context, token string) (*contract.Claims, error) {
+	claims, err := decodeToken(token, auth.lookup)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if claims.ExpiresAt.IsZero() && (auth.config.RequireExp == nil || *auth.config.RequireExp) {
+		return nil, contract.ErrTokenMissingExp
+	}
+	if !claims.ExpiresAt.IsZero() && now.After(claims.ExpiresAt.Add(auth.leeway)) {
+		return nil, contract.ErrTokenExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(auth.leeway).Before(claims.NotBefore) {
+		return nil, contract.ErrTokenNotValidYet
+	}
+	if auth.config.Issuer != "" && claims.Issuer != auth.config.Issuer {
+		return nil, contract.ErrTokenIssuer
+	}
+	if len(auth.config.Audience) > 0 && !matchAudience(auth.config.Audience, claims.Audience) {
+		return nil, contract.ErrTokenAudience
+	}
+	return claims, nil
+}
+
+// matchAudience token的受众是否包含允许的受众之一
+func matchAudience(allowed, audience []string) bool {
+	for _, a := range allowed {
+		for _, b := range audience {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Issue 使用当前的签发key签发token
+func (auth *FireAuth) Issue(ctx context.Context, claims *contract.Claims) (string, error) {
+	if auth.signer == nil {
+		return "", errors.New("auth: no key can be used to issue token")
+	}
+	issued := *claims
+	now := time.Now()
+	if issued.Issuer == "" {
+		issued.Issuer = auth.config.Issuer
+	}
+	if len(issued.Audience) == 0 {
+		issued.Audience = auth.config.Audience
+	}
+	if issued.IssuedAt.IsZero() {
+		issued.IssuedAt = now
+	}
+	if issued.ExpiresAt.IsZero() {
+		issued.ExpiresAt = now.Add(auth.ttl)
+	}
+	if issued.ID == "" {
+		issued.ID = xid.New().String()
+	}
+	return encodeToken(auth.signer, &issued)
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "fire-test-jwt-secret-0123456789"
+
+// rawToken 使用指定的header和payload生成token，signature对签名内容签名
+func rawToken(t *testing.T, header, payload map[string]interface{}, signature func(signing string) []byte) string {
+	headerBytes, err := json.Marshal(header)
+	assert.NoError(t, err)
+	payloadBytes, err := json.Marshal(payload)
+	assert.NoError(t, err)
+	signing := encoding.EncodeToString(headerBytes) + "." + encoding.EncodeToString(payloadBytes)
+	return signing + "." + encoding.EncodeToString(signature(signing))
+}
+
+func hs256(secret []byte) func(signing string) []byte {
+	return func(signing string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signing))
+		return mac.Sum(nil)
+	}
+}
+
+func newHS256Auth(t *testing.T, requireExp *bool) *FireAuth {
+	auth, err := NewFireAuthWithConfig("", FireAuthConfig{
+		Issuer:     "fire",
+		Leeway:     "0s",
+		RequireExp: requireExp,
+		Keys:       []FireAuthKeyConfig{{Kid: "k1", Algorithm: AlgHS256, Secret: testSecret}},
+	})
+	assert.NoError(t, err)
+	return auth
+}
+
+func TestVerifyIssuedToken(t *testing.T) {
+	auth := newHS256Auth(t, nil)
+	token, err := auth.Issue(context.Background(), &contract.Claims{Subject: "42"})
+	assert.NoError(t, err)
+	claims, err := auth.Verify(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, "fire", claims.Issuer)
+}
+
+func TestVerifyExpiredToken(t *testing.T) {
+	auth := newHS256Auth(t, nil)
+	token := rawToken(t,
+		map[string]interface{}{"alg": AlgHS256, "kid": "k1"},
+		map[string]interface{}{"iss": "fire", "sub": "42", "exp": time.Now().Add(-time.Minute).Unix()},
+		hs256([]byte(testSecret)))
+	_, err := auth.Verify(context.Background(), token)
+	assert.Equal(t, contract.ErrTokenExpired, err)
+}
+
+func TestVerifyMissingExp(t *testing.T) {
+	token := rawToken(t,
+		map[string]interface{}{"alg": AlgHS256, "kid": "k1"},
+		map[string]interface{}{"iss": "fire", "sub": "42"},
+		hs256([]byte(testSecret)))
+
+	_, err := newHS256Auth(t, nil).Verify(context.Background(), token)
+	assert.Equal(t, contract.ErrTokenMissingExp, err)
+
+	requireExp := false
+	claims, err := newHS256Auth(t, &requireExp).Verify(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", claims.Subject)
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	auth := newHS256Auth(t, nil)
+	payload := map[string]interface{}{"iss": "fire", "sub": "42", "exp": time.Now().Add(time.Hour).Unix()}
+
+	token := rawToken(t, map[string]interface{}{"alg": AlgHS256, "kid": "k1"}, payload, hs256([]byte("another-secret-0123456789abcdef")))
+	_, err := auth.Verify(context.Background(), token)
+	assert.Equal(t, contract.ErrTokenSignature, err)
+
+	// 不存在的kid不会退回到其他key
+	token = rawToken(t, map[string]interface{}{"alg": AlgHS256, "kid": "unknown"}, payload, hs256([]byte(testSecret)))
+	_, err = auth.Verify(context.Background(), token)
+	assert.Equal(t, contract.ErrTokenSignature, err)
+}
+
+func TestVerifyAlgorithmConfusion(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	publicDer, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	assert.NoError(t, err)
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})
+	privatePem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+
+	auth, err := NewFireAuthWithConfig("", FireAuthConfig{
+		Keys: []FireAuthKeyConfig{{Kid: "rsa", Algorithm: AlgRS256, PublicKey: string(publicPem), PrivateKey: string(privatePem)}},
+	})
+	assert.NoError(t, err)
+	token, err := auth.Issue(context.Background(), &contract.Claims{Subject: "42"})
+	assert.NoError(t, err)
+	_, err = auth.Verify(context.Background(), token)
+	assert.NoError(t, err)
+
+	payload := map[string]interface{}{"sub": "admin", "exp": time.Now().Add(time.Hour).Unix()}
+	// 使用公开的公钥作为HMAC密钥伪造HS256签名
+	forged := rawToken(t, map[string]interface{}{"alg": AlgHS256, "kid": "rsa"}, payload, hs256(publicPem))
+	_, err = auth.Verify(context.Background(), forged)
+	assert.Equal(t, contract.ErrTokenSignature, err)
+
+	// 不带签名的none算法
+	none := rawToken(t, map[string]interface{}{"alg": "none"}, payload, func(string) []byte { return nil })
+	_, err = auth.Verify(context.Background(), none)
+	assert.Equal(t, contract.ErrTokenSignature, err)
+}
+
+func TestVerifyMalformedToken(t *testing.T) {
+	auth := newHS256Auth(t, nil)
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!!.e30.e30"} {
+		_, err := auth.Verify(context.Background(), token)
+		assert.Equal(t, contract.ErrTokenMalformed, err, token)
+	}
+}
+
+func TestPlaceholderSecretRejected(t *testing.T) {
+	_, err := NewFireAuthWithConfig("", FireAuthConfig{
+		Keys: []FireAuthKeyConfig{{Kid: "k1", Algorithm: AlgHS256, Secret: "env(JWT_SECRET)"}},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// BreakerClosed 熔断器关闭，请求正常发送
+	BreakerClosed = "closed"
+	// BreakerOpen 熔断器打开，请求直接返回 ErrCircuitOpen
+	BreakerOpen = "open"
+	// BreakerHalfOpen 熔断器半开，允许少量探测请求发送
+	BreakerHalfOpen = "half_open"
+)
+
+// breakerBuckets 统计窗口划分的桶数
+const breakerBuckets = 10
+
+// breakerMinWindow 统计窗口的最小值，更短的窗口中请求数太少，错误率没有意义
+const breakerMinWindow = time.Second
+
+// breakerBucket 一个桶内的请求数和错误数
+type breakerBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// circuitBreaker 单个上游的熔断器，每次尝试都会单独统计，网络错误和5xx视为失败
+type circuitBreaker struct {
+	window      time.Duration
+	minRequests int
+	errorRate   float64
+	openTimeout time.Duration
+	halfOpen    int
+
+	lock      sync.Mutex
+	state     string
+	openedAt  time.Time
+	probes    int
+	successes int
+	buckets   [breakerBuckets]breakerBucket
+	trips     int64
+	rejected  int64
+}
+
+// newCircuitBreaker 使用配置创建熔断器，min_requests为0时不开启，返回nil
+func newCircuitBreaker(conf BreakerConfig) *circuitBreaker {
+	if conf.MinRequests <= 0 {
+		return nil
+	}
+	b := &circuitBreaker{
+		window:      10 * time.Second,
+		minRequests: conf.MinRequests,
+		errorRate:   conf.ErrorRate,
+		openTimeout: parseDuration(conf.OpenTimeout, 30*time.Second),
+		halfOpen:    conf.HalfOpenRequests,
+		state:       BreakerClosed,
+	}
+	if window, err := time.ParseDuration(conf.Window); err == nil && window >= breakerMinWindow {
+		b.window = window
+	}
+	if b.errorRate <= 0 || b.errorRate > 1 {
+		b.errorRate = 0.5
+	}
+	if b.halfOpen <= 0 {
+		b.halfOpen = 1
+	}
+	return b
+}
+
+// bucket 获取当前时间所在的桶，过期的桶会被清空
+func (b *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	size := b.window / breakerBuckets
+	start := now.Truncate(size)
+	bucket := &b.buckets[(start.UnixNano()/int64(size))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// allow 判断请求是否可以发送
+func (b *circuitBreaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	if b.state == BreakerOpen {
+		if now.Sub(b.openedAt) < b.openTimeout {
+			b.rejected++
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.successes = 0
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.halfOpen {
+			b.rejected++
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// record 记录请求结果，根据错误率和半开状态下的探测结果切换状态
+func (b *circuitBreaker) record(failed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.trip(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.halfOpen {
+			b.state = BreakerClosed
+			b.buckets = [breakerBuckets]breakerBucket{}
+		}
+		return
+	case BreakerOpen:
+		return
+	}
+
+	bucket := b.bucket(now)
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+	requests, failures := b.count(now)
+	if requests >= b.minRequests && float64(failures)/float64(requests) >= b.errorRate {
+		b.trip(now)
+	}
+}
+
+// count 窗口内的请求数和错误数
+func (b *circuitBreaker) count(now time.Time) (int, int) {
+	requests, failures := 0, 0
+	for _, item := range b.buckets {
+		if now.Sub(item.start) < b.window {
+			requests += item.requests
+			failures += item.failures
+		}
+	}
+	return requests, failures
+}
+
+// trip 打开熔断器
+func (b *circuitBreaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.trips++
+}
+
+// State 熔断器状态的快照
+func (b *circuitBreaker) State() map[string]interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	requests, failures := b.count(time.Now())
+	return map[string]interface{}{
+		"state":    b.state,
+		"requests": requests,
+		"failures": failures,
+		"trips":    b.trips,
+		"rejected": b.rejected,
+	}
+}
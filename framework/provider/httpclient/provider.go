@@ -0,0 +1,35 @@
+package httpclient
+
+import (
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// FireHttpClientProvider 提供调用上游服务的http客户端，配置从 httpclient.yaml 中读取
+type FireHttpClientProvider struct {
+}
+
+// Register 注册实例化方法
+func (provider *FireHttpClientProvider) Register(container framework.IContainer) framework.NewInstance {
+	return NewFireHttpClient
+}
+
+// Boot 启动时不需要做准备工作
+func (provider *FireHttpClientProvider) Boot(container framework.IContainer) error {
+	return nil
+}
+
+// IsDefer 第一次使用时才创建客户端
+func (provider *FireHttpClientProvider) IsDefer() bool {
+	return true
+}
+
+// Params 实例化参数
+func (provider *FireHttpClientProvider) Params(container framework.IContainer) []interface{} {
+	return []interface{}{container}
+}
+
+// Name 字符串凭证
+func (provider *FireHttpClientProvider) Name() string {
+	return contract.HttpClientKey
+}
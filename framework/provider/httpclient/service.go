@@ -0,0 +1,223 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+// RetryConfig 对应配置文件中的 upstreams.{name}.retry
+type RetryConfig struct {
+	// Max 最大重试次数，为0时不重试，只有幂等的请求才会重试
+	Max int `yaml:"max"`
+	// Backoff 第一次重试前的等待时间，之后每次翻倍，默认100ms
+	Backoff string `yaml:"backoff"`
+	// MaxBackoff 等待时间的上限，默认2s
+	MaxBackoff string `yaml:"max_backoff"`
+	// Statuses 需要重试的响应状态码，默认 429、502、503、504
+	Statuses []int `yaml:"statuses"`
+}
+
+// BreakerConfig 对应配置文件中的 upstreams.{name}.breaker
+type BreakerConfig struct {
+	// Window 统计错误率的滑动窗口，默认10s，小于1s时使用默认值
+	Window string `yaml:"window"`
+	// MinRequests 窗口内请求数达到这个值才会计算错误率，为0时不开启
+	MinRequests int `yaml:"min_requests"`
+	// ErrorRate 触发熔断的错误率，取值0到1，默认0.5
+	ErrorRate float64 `yaml:"error_rate"`
+	// OpenTimeout 熔断后经过多久进入半开状态，默认30s
+	OpenTimeout string `yaml:"open_timeout"`
+	// HalfOpenRequests 半开状态下允许的探测请求数，全部成功后关闭熔断器，默认1
+	HalfOpenRequests int `yaml:"half_open_requests"`
+}
+
+// UpstreamConfig 对应配置文件中的 upstreams.{name}
+type UpstreamConfig struct {
+	// BaseURL 上游地址，例如 http://user-service:8080/api，请求地址为相对路径时拼接在后面
+	BaseURL string `yaml:"base_url"`
+	// Timeout 一次调用的超时时间，包括重试和等待，默认10s
+	Timeout string `yaml:"timeout"`
+	// DialTimeout 建立连接的超时时间，默认3s
+	DialTimeout string `yaml:"dial_timeout"`
+	// ResponseHeaderTimeout 等待响应头的超时时间，为空时不限制
+	ResponseHeaderTimeout string `yaml:"response_header_timeout"`
+	// IdleConnTimeout 空闲连接的保持时间，默认90s
+	IdleConnTimeout string `yaml:"idle_conn_timeout"`
+	// MaxConnsPerHost 每个host的最大连接数，为0时不限制
+	MaxConnsPerHost int `yaml:"max_conns_per_host"`
+	// MaxIdleConnsPerHost 每个host的最大空闲连接数，默认10
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// Headers 每个请求默认带上的请求头，请求中已经设置的不会覆盖
+	Headers map[string]string `yaml:"headers"`
+	// Retry 重试
+	Retry RetryConfig `yaml:"retry"`
+	// Breaker 熔断器
+	Breaker BreakerConfig `yaml:"breaker"`
+}
+
+// FireHttpClientConfig 对应配置文件 httpclient.yaml
+type FireHttpClientConfig struct {
+	// Upstreams 上游服务，key为上游名称
+	Upstreams map[string]UpstreamConfig `yaml:"upstreams"`
+}
+
+// FireHttpClient 按照上游名称提供http客户端，客户端在实例化时全部创建好，可以并发使用
+type FireHttpClient struct {
+	clients    map[string]*http.Client
+	transports map[string]*transport
+}
+
+var _ contract.IHttpClient = (*FireHttpClient)(nil)
+
+// NewFireHttpClient 初始化http客户端服务，存在trace服务时创建span，存在日志服务时记录调用日志
+func NewFireHttpClient(params ...interface{}) (interface{}, error) {
+	container := params[0].(framework.IContainer)
+	config := FireHttpClientConfig{}
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	if configService.IsExist("httpclient") {
+		if err := configService.Load("httpclient", &config); err != nil {
+			return nil, errors.Wrap(err, "load httpclient config error")
+		}
+	}
+	var tracer contract.Trace
+	if container.IsBind(contract.TraceKey) {
+		tracer = container.MustMake(contract.TraceKey).(contract.Trace)
+	}
+	var logger contract.ILog
+	if container.IsBind(contract.FireLogKey) {
+		logger = container.MustMake(contract.FireLogKey).(contract.ILog)
+	}
+	return NewFireHttpClientWithConfig(config, tracer, logger)
+}
+
+// NewFireHttpClientWithConfig 使用配置创建http客户端服务，tracer和logger可以为nil
+func NewFireHttpClientWithConfig(config FireHttpClientConfig, tracer contract.Trace, logger contract.ILog) (*FireHttpClient, error) {
+	s := &FireHttpClient{
+		clients:    map[string]*http.Client{},
+		transports: map[string]*transport{},
+	}
+	for name, upstream := range config.Upstreams {
+		name = strings.ToLower(name)
+		t, err := newTransport(name, upstream, tracer, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.transports[name] = t
+		s.clients[name] = &http.Client{
+			Transport: t,
+			Timeout:   parseDuration(upstream.Timeout, 10*time.Second),
+		}
+	}
+	return s, nil
+}
+
+// newTransport 创建上游的连接池、重试策略和熔断器
+func newTransport(name string, upstream UpstreamConfig, tracer contract.Trace, logger contract.ILog) (*transport, error) {
+	t := &transport{
+		name:    name,
+		headers: upstream.Headers,
+		tracer:  tracer,
+		logger:  logger,
+		breaker: newCircuitBreaker(upstream.Breaker),
+		retry: retryPolicy{
+			max:        upstream.Retry.Max,
+			backoff:    parseDuration(upstream.Retry.Backoff, 100*time.Millisecond),
+			maxBackoff: parseDuration(upstream.Retry.MaxBackoff, 2*time.Second),
+			statuses:   map[int]bool{},
+		},
+	}
+	if upstream.BaseURL != "" {
+		baseURL, err := url.Parse(upstream.BaseURL)
+		if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+			return nil, errors.Errorf("httpclient: invalid base_url %q of upstream %s", upstream.BaseURL, name)
+		}
+		t.baseURL = baseURL
+	}
+	statuses := upstream.Retry.Statuses
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	for _, status := range statuses {
+		t.retry.statuses[status] = true
+	}
+	if upstream.MaxIdleConnsPerHost <= 0 {
+		upstream.MaxIdleConnsPerHost = 10
+	}
+	dialer := &net.Dialer{
+		Timeout:   parseDuration(upstream.DialTimeout, 3*time.Second),
+		KeepAlive: 30 * time.Second,
+	}
+	t.base = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          upstream.MaxIdleConnsPerHost * 2,
+		MaxIdleConnsPerHost:   upstream.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       upstream.MaxConnsPerHost,
+		IdleConnTimeout:       parseDuration(upstream.IdleConnTimeout, 90*time.Second),
+		ResponseHeaderTimeout: parseDuration(upstream.ResponseHeaderTimeout, 0),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return t, nil
+}
+
+// parseDuration 解析配置中的时间，为空或者无效时使用默认值
+func parseDuration(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// Client 获取上游对应的客户端
+func (s *FireHttpClient) Client(name string) (*http.Client, error) {
+	client, ok := s.clients[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.Errorf("httpclient: upstream %s not configured", name)
+	}
+	return client, nil
+}
+
+// NewRequest 创建发往上游的请求
+func (s *FireHttpClient) NewRequest(ctx context.Context, name, method, path string, body io.Reader) (*http.Request, error) {
+	t, ok := s.transports[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.Errorf("httpclient: upstream %s not configured", name)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = t.resolve(req.URL)
+	req.Host = req.URL.Host
+	return req, nil
+}
+
+// State 所有开启了熔断器的上游的状态，key为上游名称
+func (s *FireHttpClient) State() map[string]interface{} {
+	ret := map[string]interface{}{}
+	for name, t := range s.transports {
+		if t.breaker != nil {
+			ret[name] = t.breaker.State()
+		}
+	}
+	return ret
+}
+
+// CloseIdleConnections 关闭所有上游的空闲连接
+func (s *FireHttpClient) CloseIdleConnections() {
+	for _, client := range s.clients {
+		client.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,228 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen 上游的熔断器打开时返回的错误
+var ErrCircuitOpen = errors.New("httpclient: circuit breaker is open")
+
+// retryPolicy 重试策略，等待时间按照指数增长并且带有随机抖动
+type retryPolicy struct {
+	max        int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	statuses   map[int]bool
+}
+
+// retryable 请求是否可以重试，幂等的方法或者带有 Idempotency-Key 的请求才会重试，请求体需要能够重新读取
+func (p retryPolicy) retryable(req *http.Request) bool {
+	if p.max <= 0 {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// reason 返回需要重试的原因，为空表示不需要重试
+func (p retryPolicy) reason(ctx context.Context, resp *http.Response, err error) string {
+	if ctx.Err() != nil {
+		return ""
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if p.statuses[resp.StatusCode] {
+		return "status " + strconv.Itoa(resp.StatusCode)
+	}
+	return ""
+}
+
+// wait 第attempt次尝试失败后的等待时间，响应中的 Retry-After 不超过上限时优先使用
+func (p retryPolicy) wait(attempt int, resp *http.Response) time.Duration {
+	d := p.backoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			if retryAfter := time.Duration(seconds) * time.Second; retryAfter > d && retryAfter <= p.maxBackoff {
+				d = retryAfter
+			}
+		}
+	}
+	return d
+}
+
+// transport 上游的RoundTripper，负责拼接base_url、创建span、注入trace、重试、熔断和记录日志
+type transport struct {
+	name    string
+	baseURL *url.URL
+	headers map[string]string
+	retry   retryPolicy
+	breaker *circuitBreaker
+	base    *http.Transport
+	tracer  contract.Trace
+	logger  contract.ILog
+}
+
+// resolve 相对地址拼接在base_url的路径后面，绝对地址保持不变
+func (t *transport) resolve(ref *url.URL) *url.URL {
+	if t.baseURL == nil || ref.IsAbs() || ref.Host != "" {
+		return ref
+	}
+	u := *t.baseURL
+	if ref.Path != "" {
+		u.Path = strings.TrimSuffix(t.baseURL.Path, "/") + "/" + strings.TrimPrefix(ref.Path, "/")
+		u.RawPath = ""
+	}
+	u.RawQuery = ref.RawQuery
+	u.Fragment = ref.Fragment
+	return &u
+}
+
+// RoundTrip 执行一次调用，重试都在同一个span中，每次重试记录一个retry事件
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx := req.Context()
+	target := t.resolve(req.URL)
+	var span *contract.TraceContext
+	if t.tracer != nil {
+		ctx, span = t.tracer.StartSpan(ctx, "HTTP "+req.Method, contract.SpanKindClient)
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.url", target.Redacted())
+		span.SetAttribute("peer.service", t.name)
+	}
+
+	resp, attempts, err := t.roundTrip(ctx, req, target, span)
+
+	fields := map[string]interface{}{
+		"upstream":   t.name,
+		"method":     req.Method,
+		"url":        target.Redacted(),
+		"attempts":   attempts,
+		"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if span != nil {
+		fields[contract.TraceKeyTraceID] = span.TraceID
+		fields[contract.TraceKeySpanID] = span.SpanID
+		if attempts > 1 {
+			span.SetAttribute("http.retry_count", attempts-1)
+		}
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		if span != nil {
+			span.RecordError(err)
+			t.tracer.FinishSpan(span)
+		}
+		if t.logger != nil {
+			t.logger.Error(req.Context(), "http client request error", fields)
+		}
+		return nil, err
+	}
+	fields["status"] = resp.StatusCode
+	if span != nil {
+		span.SetAttribute("http.status_code", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(contract.SpanStatusError, http.StatusText(resp.StatusCode))
+		}
+		t.tracer.FinishSpan(span)
+	}
+	if t.logger != nil {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			t.logger.Warn(req.Context(), "http client request", fields)
+		} else {
+			t.logger.Info(req.Context(), "http client request", fields)
+		}
+	}
+	return resp, nil
+}
+
+// roundTrip 发送请求，失败时按照重试策略重试，返回最后一次的结果和尝试次数
+func (t *transport) roundTrip(ctx context.Context, req *http.Request, target *url.URL, span *contract.TraceContext) (*http.Response, int, error) {
+	retryable := t.retry.retryable(req)
+	for attempt := 1; ; attempt++ {
+		out := req.Clone(ctx)
+		out.URL = target
+		if out.Host == "" {
+			out.Host = target.Host
+		}
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, attempt, err
+			}
+			out.Body = body
+		}
+		for key, value := range t.headers {
+			if out.Header.Get(key) == "" {
+				out.Header.Set(key, value)
+			}
+		}
+		if span != nil {
+			t.tracer.InjectHTTP(out, span)
+		}
+		if t.breaker != nil && !t.breaker.allow() {
+			return nil, attempt, errors.Wrapf(ErrCircuitOpen, "upstream %s", t.name)
+		}
+
+		resp, err := t.base.RoundTrip(out)
+		if t.breaker != nil {
+			t.breaker.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+		}
+		if !retryable || attempt > t.retry.max {
+			return resp, attempt, err
+		}
+		reason := t.retry.reason(ctx, resp, err)
+		if reason == "" {
+			return resp, attempt, err
+		}
+		wait := t.retry.wait(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+		}
+		if span != nil {
+			span.AddEvent("retry", map[string]interface{}{
+				"attempt":  attempt,
+				"reason":   reason,
+				"wait_ms":  wait.Milliseconds(),
+				"upstream": t.name,
+			})
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		}
+	}
+}
+
+// CloseIdleConnections 关闭空闲连接，http.Client.CloseIdleConnections 会调用
+func (t *transport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
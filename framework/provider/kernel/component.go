@@ -0,0 +1,42 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// HttpComponent 将http.Server包装为生命周期组件
+type HttpComponent struct {
+	name     string
+	server   *http.Server
+	listener net.Listener
+}
+
+var _ contract.Component = (*HttpComponent)(nil)
+
+// NewHttpComponent 使用server和已经监听的listener创建一个HTTP组件
+func NewHttpComponent(name string, server *http.Server, listener net.Listener) *HttpComponent {
+	return &HttpComponent{name: name, server: server, listener: listener}
+}
+
+// Name 组件名称
+func (c *HttpComponent) Name() string {
+	return c.name
+}
+
+// Start 开始处理请求，直到服务被关闭
+func (c *HttpComponent) Start(ctx context.Context) error {
+	if err := c.server.Serve(c.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop 优雅关闭服务
+func (c *HttpComponent) Stop(ctx context.Context) error {
+	return c.server.Shutdown(ctx)
+}
@@ -8,6 +8,8 @@ import (
 
 type FireKernelProvider struct {
 	HttpEngine *gin.Engine
+	// AdminEngine 管理端口使用的引擎，没有注入时使用一个空的引擎
+	AdminEngine *gin.Engine
 }
 
 func (fire *FireKernelProvider) Name() string {
@@ -15,7 +17,7 @@ func (fire *FireKernelProvider) Name() string {
 }
 
 func (fire *FireKernelProvider) Params(container framework.IContainer) []interface{} {
-	return []interface{}{fire.HttpEngine}
+	return []interface{}{fire.HttpEngine, fire.AdminEngine}
 }
 
 func (fire *FireKernelProvider) Register(container framework.IContainer) framework.NewInstance {
@@ -32,5 +34,9 @@ func (fire *FireKernelProvider) Boot(container framework.IContainer) error {
 		fire.HttpEngine = gin.Default()
 	}
 	fire.HttpEngine.SetContainer(container)
+	if fire.AdminEngine == nil {
+		fire.AdminEngine = gin.New()
+	}
+	fire.AdminEngine.SetContainer(container)
 	return nil
 }
@@ -7,14 +7,17 @@ import (
 )
 
 type FireKernelService struct {
-	engine *gin.Engine
+	engine      *gin.Engine
+	adminEngine *gin.Engine
 }
 
 // NewFireKernelService 初始化web引擎服务实例
 func NewFireKernelService(params ...interface{}) (interface{}, error) {
 	httpEngine := params[0].(*gin.Engine)
+	adminEngine := params[1].(*gin.Engine)
 	return &FireKernelService{
-		engine: httpEngine,
+		engine:      httpEngine,
+		adminEngine: adminEngine,
 	}, nil
 }
 
@@ -22,3 +25,8 @@ func NewFireKernelService(params ...interface{}) (interface{}, error) {
 func (s *FireKernelService) HttpEngine() http.Handler {
 	return s.engine
 }
+
+// AdminEngine 返回管理端口使用的web引擎
+func (s *FireKernelService) AdminEngine() http.Handler {
+	return s.adminEngine
+}
@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// FuncComponent 使用函数定义的组件
+type FuncComponent struct {
+	name  string
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+var _ contract.Component = (*FuncComponent)(nil)
+
+// NewComponent 使用启动函数和关闭函数创建一个组件，stop可以为nil
+func NewComponent(name string, start, stop func(ctx context.Context) error) *FuncComponent {
+	return &FuncComponent{name: name, start: start, stop: stop}
+}
+
+// Name 组件名称
+func (c *FuncComponent) Name() string {
+	return c.name
+}
+
+// Start 启动组件
+func (c *FuncComponent) Start(ctx context.Context) error {
+	return c.start(ctx)
+}
+
+// Stop 关闭组件
+func (c *FuncComponent) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	return c.stop(ctx)
+}
+
+// LoopComponent 代表一个自定义的循环，Stop时会取消传递给循环函数的ctx
+type LoopComponent struct {
+	name   string
+	loop   func(ctx context.Context) error
+	lock   sync.Mutex
+	cancel context.CancelFunc
+}
+
+var _ contract.Component = (*LoopComponent)(nil)
+
+// NewLoop 创建一个循环组件，loop需要在ctx结束的时候返回
+func NewLoop(name string, loop func(ctx context.Context) error) *LoopComponent {
+	return &LoopComponent{name: name, loop: loop}
+}
+
+// Name 组件名称
+func (c *LoopComponent) Name() string {
+	return c.name
+}
+
+// Start 运行循环，直到Stop被调用或者循环异常返回
+func (c *LoopComponent) Start(ctx context.Context) error {
+	loopCtx, cancel := context.WithCancel(ctx)
+	c.lock.Lock()
+	c.cancel = cancel
+	c.lock.Unlock()
+	defer cancel()
+
+	err := c.loop(loopCtx)
+	if loopCtx.Err() != nil {
+		// 由Stop触发的退出不算异常
+		return nil
+	}
+	return err
+}
+
+// Stop 取消循环的ctx
+func (c *LoopComponent) Stop(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return nil
+}
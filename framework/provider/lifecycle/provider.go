@@ -0,0 +1,35 @@
+package lifecycle
+
+import (
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// FireLifecycleProvider 提供应用生命周期服务
+type FireLifecycleProvider struct {
+}
+
+// Register 注册实例化方法
+func (provider *FireLifecycleProvider) Register(container framework.IContainer) framework.NewInstance {
+	return NewFireLifecycleService
+}
+
+// Boot 启动时不需要做准备工作
+func (provider *FireLifecycleProvider) Boot(container framework.IContainer) error {
+	return nil
+}
+
+// IsDefer 在注册时实例化，保证服务提供者可以在启动阶段注册组件
+func (provider *FireLifecycleProvider) IsDefer() bool {
+	return false
+}
+
+// Params 实例化参数
+func (provider *FireLifecycleProvider) Params(container framework.IContainer) []interface{} {
+	return []interface{}{container}
+}
+
+// Name 字符串凭证
+func (provider *FireLifecycleProvider) Name() string {
+	return contract.LifecycleKey
+}
@@ -0,0 +1,236 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+// FireLifecycleService 管理所有后台组件的启动和关闭
+type FireLifecycleService struct {
+	container  framework.IContainer
+	lock       sync.RWMutex
+	components []contract.Component
+	ready      bool
+	// added Run运行期间有新的组件注册时通知Run启动它
+	added chan struct{}
+}
+
+var _ contract.ILifecycle = (*FireLifecycleService)(nil)
+
+// componentExit 组件Start返回的结果
+type componentExit struct {
+	index int
+	err   error
+}
+
+// NewFireLifecycleService 初始化生命周期服务
+func NewFireLifecycleService(params ...interface{}) (interface{}, error) {
+	container := params[0].(framework.IContainer)
+	return &FireLifecycleService{container: container}, nil
+}
+
+// Register 注册一个组件，Run运行期间注册的组件会立刻启动，例如延迟实例化的服务在第一次使用时注册的后台任务
+func (s *FireLifecycleService) Register(component contract.Component) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.components = append(s.components, component)
+	if s.added != nil {
+		select {
+		case s.added <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Components 获取所有已经注册的组件
+func (s *FireLifecycleService) Components() []contract.Component {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := make([]contract.Component, len(s.components))
+	copy(ret, s.components)
+	return ret
+}
+
+// Ready 所有组件是否已经启动
+func (s *FireLifecycleService) Ready() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.ready
+}
+
+func (s *FireLifecycleService) setReady(ready bool) {
+	s.lock.Lock()
+	s.ready = ready
+	s.lock.Unlock()
+}
+
+// Run 按照注册顺序启动所有组件，在ctx结束或者某个组件异常退出的时候按照相反的顺序关闭所有组件
+// 每个组件使用单独的ctx，组件的Stop返回后取消它的ctx，只依赖ctx退出的组件也能按照顺序关闭
+// 运行期间注册的组件在注册时启动，关闭时最先关闭，不影响就绪状态
+func (s *FireLifecycleService) Run(ctx context.Context) error {
+	s.lock.Lock()
+	components := make([]contract.Component, len(s.components))
+	copy(components, s.components)
+	added := make(chan struct{}, 1)
+	s.added = added
+	s.lock.Unlock()
+	if len(components) == 0 {
+		return errors.New("no component registered")
+	}
+
+	// stopping 关闭之后组件的退出结果不再需要，避免Start返回时阻塞
+	exits := make(chan componentExit)
+	stopping := make(chan struct{})
+	var entered, done []chan struct{}
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	start := func(index int, component contract.Component) {
+		entered = append(entered, make(chan struct{}))
+		done = append(done, make(chan struct{}))
+		componentCtx, cancel := context.WithCancel(context.Background())
+		cancels = append(cancels, cancel)
+		s.log(contract.InfoLevel, "component start", component, nil)
+		go func(entered, done chan struct{}) {
+			defer close(done)
+			exit := func(err error) {
+				select {
+				case exits <- componentExit{index: index, err: err}:
+				case <-stopping:
+				}
+			}
+			defer func() {
+				if p := recover(); p != nil {
+					exit(fmt.Errorf("component %s panic: %v", component.Name(), p))
+				}
+			}()
+			close(entered)
+			exit(component.Start(componentCtx))
+		}(entered[index], done[index])
+	}
+	for i, component := range components {
+		start(i, component)
+	}
+
+	// 所有组件都启动之后才标记为就绪，实现了StartNotifier的组件等待它通知启动完成
+	started := make(chan struct{})
+	waitCtx, waitCancel := context.WithCancel(context.Background())
+	defer waitCancel()
+	initial, entered0, done0 := components, entered, done
+	go func() {
+		for i, component := range initial {
+			ready := (<-chan struct{})(entered0[i])
+			if notifier, ok := component.(contract.StartNotifier); ok {
+				ready = notifier.Started()
+			}
+			select {
+			case <-ready:
+			case <-done0[i]:
+				return
+			case <-waitCtx.Done():
+				return
+			}
+		}
+		close(started)
+	}()
+
+	// 等待退出信号或者组件异常退出
+	var fatal error
+	running := len(components)
+	for fatal == nil && running > 0 {
+		select {
+		case <-ctx.Done():
+			running = 0
+			continue
+		case <-started:
+			started = nil
+			s.setReady(true)
+			s.log(contract.InfoLevel, "all components started", nil, nil)
+		case <-added:
+			for _, component := range s.Components()[len(components):] {
+				start(len(components), component)
+				components = append(components, component)
+				running++
+			}
+		case exit := <-exits:
+			running--
+			if exit.err != nil {
+				fatal = errors.Wrap(exit.err, components[exit.index].Name())
+				s.log(contract.ErrorLevel, "component exit with error", components[exit.index], exit.err)
+			} else {
+				s.log(contract.InfoLevel, "component exit", components[exit.index], nil)
+			}
+		}
+	}
+	waitCancel()
+	s.lock.Lock()
+	s.added = nil
+	s.ready = false
+	s.lock.Unlock()
+	close(stopping)
+
+	// 按照注册的相反顺序关闭组件，每个组件关闭后取消它的ctx并等待其Start返回
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), s.closeWait())
+	defer stopCancel()
+	for i := len(components) - 1; i >= 0; i-- {
+		component := components[i]
+		select {
+		case <-done[i]:
+			continue
+		default:
+		}
+		s.log(contract.InfoLevel, "component stop", component, nil)
+		if err := component.Stop(stopCtx); err != nil {
+			s.log(contract.ErrorLevel, "component stop error", component, err)
+		}
+		cancels[i]()
+		select {
+		case <-done[i]:
+		case <-stopCtx.Done():
+			s.log(contract.ErrorLevel, "component stop timeout", component, stopCtx.Err())
+		}
+	}
+	return fatal
+}
+
+// closeWait 获取关闭所有组件的最长等待时间
+func (s *FireLifecycleService) closeWait() time.Duration {
+	closeWait := 5
+	if s.container.IsBind(contract.ConfigKey) {
+		configService := s.container.MustMake(contract.ConfigKey).(contract.IConfig)
+		if configService.IsExist("app.close_wait") {
+			closeWait = configService.GetInt("app.close_wait")
+		}
+	}
+	return time.Duration(closeWait) * time.Second
+}
+
+// log 如果绑定了日志服务，记录组件的状态变更
+func (s *FireLifecycleService) log(level contract.LogLevel, msg string, component contract.Component, err error) {
+	if !s.container.IsBind(contract.FireLogKey) {
+		return
+	}
+	logger := s.container.MustMake(contract.FireLogKey).(contract.ILog)
+	fields := map[string]interface{}{}
+	if component != nil {
+		fields["component"] = component.Name()
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	if level == contract.ErrorLevel {
+		logger.Error(context.Background(), msg, fields)
+		return
+	}
+	logger.Info(context.Background(), msg, fields)
+}
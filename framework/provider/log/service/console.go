@@ -22,5 +22,6 @@ func NewFireConsoleLog(params ...interface{}) (interface{}, error) {
 	log.SetFormatter(formatter)
 	log.SetOutput(os.Stdout)
 	log.container = container
+	log.driver = "console"
 	return log, nil
 }
@@ -24,5 +24,6 @@ func NewFireCustomLog(params ...interface{}) (interface{}, error) {
 	log.SetFormatter(formatter)
 	log.SetOutput(output)
 	log.container = container
+	log.driver = "custom"
 	return log, nil
 }
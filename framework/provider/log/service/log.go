@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	pkgLog "log"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/YunzeGao/fire/framework"
@@ -17,6 +19,13 @@ type FireLog struct {
 	ctxFielder contract.CtxFielder
 	output     io.Writer
 	container  framework.IContainer
+
+	// driver 日志驱动的名称，用于导出metrics
+	driver string
+	// entries 每个级别输出的日志条数
+	entries [contract.TraceLevel + 1]uint64
+	// writeErrors 写入失败的次数
+	writeErrors uint64
 }
 
 func (log *FireLog) IsLevelEnable(level contract.LogLevel) bool {
@@ -59,11 +68,24 @@ func (log *FireLog) logf(level contract.LogLevel, ctx context.Context, msg strin
 		pkgLog.Panic(string(content))
 		return nil
 	}
-	_, _ = log.output.Write(content)
-	_, _ = log.output.Write([]byte("\r\n"))
+	atomic.AddUint64(&log.entries[level], 1)
+	if _, err := log.output.Write(append(content, '\r', '\n')); err != nil {
+		atomic.AddUint64(&log.writeErrors, 1)
+		return err
+	}
 	return nil
 }
 
+// LogStats 日志驱动的名称，每个级别输出的日志条数和写入失败的次数，用于导出metrics
+func (log *FireLog) LogStats() (string, map[string]uint64, uint64) {
+	entries := map[string]uint64{}
+	for level := contract.PanicLevel; level <= contract.TraceLevel; level++ {
+		name := strings.ToLower(strings.Trim(formatter.Prefix(level), "[]"))
+		entries[name] = atomic.LoadUint64(&log.entries[level])
+	}
+	return log.driver, entries, atomic.LoadUint64(&log.writeErrors)
+}
+
 // SetOutput 设置output
 func (log *FireLog) SetOutput(output io.Writer) {
 	log.output = output
@@ -102,5 +102,6 @@ func NewFireRotateLog(params ...interface{}) (interface{}, error) {
 	}
 	log.SetOutput(w)
 	log.container = container
+	log.driver = "rotate"
 	return log, nil
 }
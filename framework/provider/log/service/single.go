@@ -51,5 +51,6 @@ func NewFireSingleLog(params ...interface{}) (interface{}, error) {
 	}
 	log.SetOutput(fd)
 	log.container = container
+	log.driver = "single"
 	return log, nil
 }
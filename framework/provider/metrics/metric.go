@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// series 一组label值对应的数据
+type series struct {
+	labelValues []string
+	value       float64
+	// buckets 每个bucket的计数，不累加，输出时再累加
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// metric 一个指标和它所有的series
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+func newMetric(name, help, kind string, labels []string, buckets []float64) *metric {
+	return &metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+}
+
+// get 获取label值对应的series，不存在时创建，调用方需要持有锁
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == kindHistogram {
+			s.buckets = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// snapshot 按照label值排序后的series拷贝，用于输出
+func (m *metric) snapshot() []series {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ret := make([]series, 0, len(m.series))
+	for _, s := range m.series {
+		item := *s
+		item.buckets = append([]uint64(nil), s.buckets...)
+		ret = append(ret, item)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return strings.Join(ret[i].labelValues, "\xff") < strings.Join(ret[j].labelValues, "\xff")
+	})
+	return ret
+}
+
+// counter 实现了contract.ICounter
+type counter struct {
+	*metric
+}
+
+func (c counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic(fmt.Sprintf("metrics: counter %s cannot decrease", c.name))
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.get(labelValues).value += value
+}
+
+// gauge 实现了contract.IGauge
+type gauge struct {
+	*metric
+}
+
+func (g gauge) Set(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.get(labelValues).value = value
+}
+
+func (g gauge) Add(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.get(labelValues).value += value
+}
+
+// histogram 实现了contract.IHistogram
+type histogram struct {
+	*metric
+}
+
+func (h histogram) Observe(value float64, labelValues ...string) {
+	// 第一个大于等于value的bucket
+	i := sort.SearchFloat64s(h.buckets, value)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := h.get(labelValues)
+	if i < len(s.buckets) {
+		s.buckets[i]++
+	}
+	s.sum += value
+	s.count++
+}
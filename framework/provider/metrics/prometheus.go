@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// formatFloat 按照Prometheus文本格式输出数字
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeLabels 输出 {name="value",...}，extraName不为空时追加一个label，用于直方图的le
+func writeLabels(w *bufio.Writer, names, values []string, extraName, extraValue string) {
+	if len(names) == 0 && extraName == "" {
+		return
+	}
+	w.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(name)
+		w.WriteString(`="`)
+		w.WriteString(labelEscaper.Replace(values[i]))
+		w.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(extraName)
+		w.WriteString(`="`)
+		w.WriteString(extraValue)
+		w.WriteByte('"')
+	}
+	w.WriteByte('}')
+}
+
+// writePrometheus 以Prometheus文本格式输出一个指标
+func writePrometheus(w *bufio.Writer, m *metric) {
+	all := m.snapshot()
+	if len(all) == 0 {
+		return
+	}
+	w.WriteString("# HELP " + m.name + " " + helpEscaper.Replace(m.help) + "\n")
+	w.WriteString("# TYPE " + m.name + " " + m.kind + "\n")
+	for _, s := range all {
+		if m.kind != kindHistogram {
+			w.WriteString(m.name)
+			writeLabels(w, m.labels, s.labelValues, "", "")
+			w.WriteString(" " + formatFloat(s.value) + "\n")
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += s.buckets[i]
+			w.WriteString(m.name + "_bucket")
+			writeLabels(w, m.labels, s.labelValues, "le", formatFloat(upper))
+			w.WriteString(" " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString(m.name + "_bucket")
+		writeLabels(w, m.labels, s.labelValues, "le", "+Inf")
+		w.WriteString(" " + strconv.FormatUint(s.count, 10) + "\n")
+		w.WriteString(m.name + "_sum")
+		writeLabels(w, m.labels, s.labelValues, "", "")
+		w.WriteString(" " + formatFloat(s.sum) + "\n")
+		w.WriteString(m.name + "_count")
+		writeLabels(w, m.labels, s.labelValues, "", "")
+		w.WriteString(" " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+// newPrometheusWriter 创建带缓冲的writer
+func newPrometheusWriter(w io.Writer) *bufio.Writer {
+	return bufio.NewWriterSize(w, 32*1024)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// FireMetricsProvider 提供指标服务，配置从 metrics.yaml 中读取
+type FireMetricsProvider struct {
+}
+
+// Register 注册实例化方法
+func (provider *FireMetricsProvider) Register(container framework.IContainer) framework.NewInstance {
+	return NewFireMetricsService
+}
+
+// Boot 启动时不需要做任何事情
+func (provider *FireMetricsProvider) Boot(container framework.IContainer) error {
+	return nil
+}
+
+// IsDefer 第一次使用时再实例化
+func (provider *FireMetricsProvider) IsDefer() bool {
+	return true
+}
+
+// Params 实例化参数
+func (provider *FireMetricsProvider) Params(container framework.IContainer) []interface{} {
+	return []interface{}{container}
+}
+
+// Name 字符串凭证
+func (provider *FireMetricsProvider) Name() string {
+	return contract.MetricsKey
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// logStats 日志服务提供的统计信息
+type logStats interface {
+	LogStats() (driver string, entries map[string]uint64, writeErrors uint64)
+}
+
+// registerRuntimeCollector 注册Go运行时、服务容器和日志的指标，运行时指标使用Prometheus约定的go_和process_前缀
+func registerRuntimeCollector(s *FireMetricsService, container framework.IContainer) {
+	start := float64(time.Now().UnixNano()) / 1e9
+	goroutines := gauge{s.register("go_goroutines", "Number of goroutines that currently exist.", kindGauge, nil, nil)}
+	threads := gauge{s.register("go_threads", "Number of OS threads created.", kindGauge, nil, nil)}
+	info := gauge{s.register("go_info", "Information about the Go environment.", kindGauge, []string{"version"}, nil)}
+	alloc := gauge{s.register("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", kindGauge, nil, nil)}
+	sys := gauge{s.register("go_memstats_sys_bytes", "Number of bytes obtained from system.", kindGauge, nil, nil)}
+	heapInuse := gauge{s.register("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", kindGauge, nil, nil)}
+	heapObjects := gauge{s.register("go_memstats_heap_objects", "Number of allocated objects.", kindGauge, nil, nil)}
+	gcCycles := gauge{s.register("go_gc_cycles", "Number of completed GC cycles.", kindGauge, nil, nil)}
+	gcPause := gauge{s.register("go_gc_pause_total_seconds", "Total GC pause time in seconds.", kindGauge, nil, nil)}
+	startTime := gauge{s.register("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", kindGauge, nil, nil)}
+	cpus := gauge{s.register("go_cpus", "Number of logical CPUs usable by the process.", kindGauge, nil, nil)}
+
+	providers := s.Gauge("container_providers", "Number of service providers bound to the container.")
+	providerInfo := s.Gauge("container_provider_info", "Service providers bound to the container.", "key")
+	logEntries := s.Counter("log_entries_total", "Number of log entries written by level.", "driver", "level")
+	logErrors := s.Counter("log_write_errors_total", "Number of failed log writes.", "driver")
+
+	s.RegisterCollector("runtime", func(contract.IMetrics) {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		threadCount, _ := runtime.ThreadCreateProfile(nil)
+		goroutines.Set(float64(runtime.NumGoroutine()))
+		threads.Set(float64(threadCount))
+		info.Set(1, runtime.Version())
+		alloc.Set(float64(stats.Alloc))
+		sys.Set(float64(stats.Sys))
+		heapInuse.Set(float64(stats.HeapInuse))
+		heapObjects.Set(float64(stats.HeapObjects))
+		gcCycles.Set(float64(stats.NumGC))
+		gcPause.Set(float64(stats.PauseTotalNs) / 1e9)
+		startTime.Set(start)
+		cpus.Set(float64(runtime.NumCPU()))
+	})
+
+	s.RegisterCollector("container", func(contract.IMetrics) {
+		names, ok := container.(interface{ NameList() []string })
+		if !ok {
+			return
+		}
+		list := names.NameList()
+		providers.Set(float64(len(list)))
+		for _, key := range list {
+			providerInfo.Set(1, key)
+		}
+	})
+
+	// 日志服务的计数是累计值，counter只能增加，所以记录上一次的值并增加差值
+	last := map[string]uint64{}
+	s.RegisterCollector("log", func(contract.IMetrics) {
+		if !container.IsBind(contract.FireLogKey) {
+			return
+		}
+		instance, err := container.Make(contract.FireLogKey)
+		if err != nil {
+			return
+		}
+		stats, ok := instance.(logStats)
+		if !ok {
+			return
+		}
+		driver, entries, writeErrors := stats.LogStats()
+		for level, count := range entries {
+			key := driver + ":" + level
+			if count > last[key] {
+				logEntries.Add(float64(count-last[key]), driver, level)
+				last[key] = count
+			}
+		}
+		if key := driver + ":write_errors"; writeErrors > last[key] {
+			logErrors.Add(float64(writeErrors-last[key]), driver)
+			last[key] = writeErrors
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBuckets 默认的直方图buckets，单位秒，适用于请求耗时
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+var labelRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// FireMetricsConfig 对应配置文件 metrics.yaml
+type FireMetricsConfig struct {
+	// Namespace 指标名称的前缀，默认fire，例如 fire_http_requests_total
+	Namespace string `yaml:"namespace"`
+	// Buckets 默认的直方图buckets
+	Buckets []float64 `yaml:"buckets"`
+	// Runtime 是否导出Go运行时、服务容器和日志的指标
+	Runtime bool `yaml:"runtime"`
+}
+
+// FireMetricsService 进程内的指标服务，不依赖第三方库
+type FireMetricsService struct {
+	config FireMetricsConfig
+
+	lock    sync.RWMutex
+	metrics map[string]*metric
+
+	collectorLock sync.Mutex
+	collectors    map[string]contract.MetricsCollector
+	// collecting 同一时间只有一次采集，collector不需要考虑并发
+	collecting sync.Mutex
+}
+
+var _ contract.IMetrics = (*FireMetricsService)(nil)
+
+// NewFireMetricsService 初始化指标服务
+func NewFireMetricsService(params ...interface{}) (interface{}, error) {
+	container := params[0].(framework.IContainer)
+	config := FireMetricsConfig{Namespace: "fire", Runtime: true}
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	if configService.IsExist("metrics") {
+		if err := configService.Load("metrics", &config); err != nil {
+			return nil, errors.Wrap(err, "load metrics config error")
+		}
+	}
+	service := NewFireMetricsServiceWithConfig(config)
+	if config.Runtime {
+		registerRuntimeCollector(service, container)
+	}
+	return service, nil
+}
+
+// NewFireMetricsServiceWithConfig 使用配置创建指标服务
+func NewFireMetricsServiceWithConfig(config FireMetricsConfig) *FireMetricsService {
+	if len(config.Buckets) == 0 {
+		config.Buckets = DefaultBuckets
+	}
+	config.Buckets = append([]float64(nil), config.Buckets...)
+	sort.Float64s(config.Buckets)
+	return &FireMetricsService{
+		config:     config,
+		metrics:    map[string]*metric{},
+		collectors: map[string]contract.MetricsCollector{},
+	}
+}
+
+// fullName 加上命名空间前缀
+func (s *FireMetricsService) fullName(name string) string {
+	if s.config.Namespace == "" {
+		return name
+	}
+	return s.config.Namespace + "_" + name
+}
+
+// register 注册指标，已经注册时检查类型和labels是否一致
+func (s *FireMetricsService) register(name, help, kind string, labels []string, buckets []float64) *metric {
+	s.lock.RLock()
+	m, ok := s.metrics[name]
+	s.lock.RUnlock()
+	if !ok {
+		if !nameRegexp.MatchString(name) {
+			panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+		}
+		for _, label := range labels {
+			if !labelRegexp.MatchString(label) || label == "le" {
+				panic(fmt.Sprintf("metrics: invalid label name %q of %s", label, name))
+			}
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if m, ok = s.metrics[name]; !ok {
+			m = newMetric(name, help, kind, append([]string(nil), labels...), buckets)
+			s.metrics[name] = m
+			return m
+		}
+	}
+	if m.kind != kind || len(m.labels) != len(labels) {
+		panic(fmt.Sprintf("metrics: %s is already registered as %s with labels %v", name, m.kind, m.labels))
+	}
+	return m
+}
+
+// Counter 注册或者获取计数器
+func (s *FireMetricsService) Counter(name, help string, labels ...string) contract.ICounter {
+	return counter{s.register(s.fullName(name), help, kindCounter, labels, nil)}
+}
+
+// Gauge 注册或者获取gauge
+func (s *FireMetricsService) Gauge(name, help string, labels ...string) contract.IGauge {
+	return gauge{s.register(s.fullName(name), help, kindGauge, labels, nil)}
+}
+
+// Histogram 注册或者获取直方图
+func (s *FireMetricsService) Histogram(name, help string, buckets []float64, labels ...string) contract.IHistogram {
+	if len(buckets) == 0 {
+		buckets = s.config.Buckets
+	} else {
+		buckets = append([]float64(nil), buckets...)
+		sort.Float64s(buckets)
+	}
+	return histogram{s.register(s.fullName(name), help, kindHistogram, labels, buckets)}
+}
+
+// RegisterCollector 注册采集时调用的函数，name相同时后注册的覆盖先注册的
+func (s *FireMetricsService) RegisterCollector(name string, collector contract.MetricsCollector) {
+	s.collectorLock.Lock()
+	defer s.collectorLock.Unlock()
+	s.collectors[name] = collector
+}
+
+// collect 按照名称顺序调用所有的collector
+func (s *FireMetricsService) collect() {
+	s.collectorLock.Lock()
+	names := make([]string, 0, len(s.collectors))
+	for name := range s.collectors {
+		names = append(names, name)
+	}
+	collectors := make(map[string]contract.MetricsCollector, len(s.collectors))
+	for name, collector := range s.collectors {
+		collectors[name] = collector
+	}
+	s.collectorLock.Unlock()
+	sort.Strings(names)
+	s.collecting.Lock()
+	defer s.collecting.Unlock()
+	for _, name := range names {
+		collectors[name](s)
+	}
+}
+
+// WritePrometheus 以Prometheus文本格式输出所有指标，按照名称排序
+func (s *FireMetricsService) WritePrometheus(w io.Writer) error {
+	s.collect()
+	s.lock.RLock()
+	all := make([]*metric, 0, len(s.metrics))
+	for _, m := range s.metrics {
+		all = append(all, m)
+	}
+	s.lock.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+	writer := newPrometheusWriter(w)
+	for _, m := range all {
+		writePrometheus(writer, m)
+	}
+	return writer.Flush()
+}
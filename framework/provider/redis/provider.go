@@ -0,0 +1,35 @@
+package redis
+
+import (
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// FireRedisProvider 提供redis服务，配置从 redis.yaml 中读取
+type FireRedisProvider struct {
+}
+
+// Register 注册实例化方法
+func (provider *FireRedisProvider) Register(container framework.IContainer) framework.NewInstance {
+	return NewFireRedis
+}
+
+// Boot 启动时不需要做准备工作
+func (provider *FireRedisProvider) Boot(container framework.IContainer) error {
+	return nil
+}
+
+// IsDefer 第一次使用时才建立连接
+func (provider *FireRedisProvider) IsDefer() bool {
+	return true
+}
+
+// Params 实例化参数
+func (provider *FireRedisProvider) Params(container framework.IContainer) []interface{} {
+	return []interface{}{container}
+}
+
+// Name 字符串凭证
+func (provider *FireRedisProvider) Name() string {
+	return contract.RedisKey
+}
@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// RedisError redis返回的错误信息
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// writeCommand 按照RESP协议写入一条命令
+func writeCommand(w *bufio.Writer, args []interface{}) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		var b []byte
+		switch v := arg.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		case int:
+			b = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		case float64:
+			b = strconv.AppendFloat(nil, v, 'f', -1, 64)
+		case bool:
+			if v {
+				b = []byte("1")
+			} else {
+				b = []byte("0")
+			}
+		default:
+			b = []byte(fmt.Sprint(v))
+		}
+		if _, err := fmt.Fprintf(w, "$%d\r\n", len(b)); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// readLine 读取一行，去掉结尾的\r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: invalid response line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readReply 按照RESP协议读取一个返回值
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("redis: empty response line")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		ret := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			v, err := readReply(r)
+			if err != nil {
+				if _, ok := err.(RedisError); !ok {
+					return nil, err
+				}
+				v = err
+			}
+			ret[i] = v
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("redis: unknown response type %q", line[0])
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reply(raw string) (interface{}, error) {
+	return readReply(bufio.NewReader(strings.NewReader(raw)))
+}
+
+func TestReadReply(t *testing.T) {
+	v, err := reply("+OK\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", v)
+
+	v, err = reply(":-42\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), v)
+
+	// bulk string中可以包含\r\n
+	v, err = reply("$7\r\nfoo\r\nba\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo\r\nba", v)
+
+	v, err = reply("$0\r\n\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "", v)
+}
+
+func TestReadReplyError(t *testing.T) {
+	v, err := reply("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	assert.Nil(t, v)
+	assert.Equal(t, RedisError("WRONGTYPE Operation against a key holding the wrong kind of value"), err)
+}
+
+func TestReadReplyNil(t *testing.T) {
+	v, err := reply("$-1\r\n")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	v, err = reply("*-1\r\n")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestReadReplyNestedArray(t *testing.T) {
+	// EXEC的返回值中可以包含nil和单条命令的错误
+	v, err := reply("*4\r\n:1\r\n*2\r\n$1\r\na\r\n$-1\r\n-ERR boom\r\n*0\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		int64(1),
+		[]interface{}{"a", nil},
+		RedisError("ERR boom"),
+		[]interface{}{},
+	}, v)
+}
+
+func TestReadReplyInvalid(t *testing.T) {
+	for _, raw := range []string{"", "+OK\n", "\r\n", "?1\r\n", ":abc\r\n", "$5\r\nab\r\n", "*2\r\n:1\r\n"} {
+		_, err := reply(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	assert.NoError(t, writeCommand(w, []interface{}{"SET", "k", []byte("v\r\n"), 10, int64(-1), 1.5, true}))
+	assert.Equal(t, "*7\r\n$3\r\nSET\r\n$1\r\nk\r\n$3\r\nv\r\n\r\n$2\r\n10\r\n$2\r\n-1\r\n$3\r\n1.5\r\n$1\r\n1\r\n", buf.String())
+
+	// 写入的命令可以按照相同的协议读回
+	v, err := readReply(bufio.NewReader(&buf))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"SET", "k", "v\r\n", "10", "-1", "1.5", "1"}, v)
+}
@@ -0,0 +1,182 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+// FireRedisConfig 对应配置文件 redis.yaml
+type FireRedisConfig struct {
+	// Address redis地址，默认 127.0.0.1:6379
+	Address string `yaml:"address"`
+	// Password 密码
+	Password string `yaml:"password"`
+	// DB 数据库编号
+	DB int `yaml:"db"`
+	// PoolSize 最大空闲连接数，默认10
+	PoolSize int `yaml:"pool_size"`
+	// DialTimeout 连接超时，默认 3s
+	DialTimeout string `yaml:"dial_timeout"`
+	// Timeout 读写超时，ctx没有设置deadline的时候使用，默认 3s
+	Timeout string `yaml:"timeout"`
+}
+
+// conn 一个redis连接
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+}
+
+// FireRedis 基于RESP协议实现的轻量redis客户端，带有简单的连接池
+type FireRedis struct {
+	config      FireRedisConfig
+	dialTimeout time.Duration
+	timeout     time.Duration
+
+	lock   sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+var _ contract.IRedis = (*FireRedis)(nil)
+
+// NewFireRedis 初始化redis服务，不会立即建立连接
+func NewFireRedis(params ...interface{}) (interface{}, error) {
+	container := params[0].(framework.IContainer)
+	config := FireRedisConfig{}
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	if configService.IsExist("redis") {
+		if err := configService.Load("redis", &config); err != nil {
+			return nil, errors.Wrap(err, "load redis config error")
+		}
+	}
+	return NewFireRedisWithConfig(config), nil
+}
+
+// NewFireRedisWithConfig 使用配置创建redis客户端
+func NewFireRedisWithConfig(config FireRedisConfig) *FireRedis {
+	if config.Address == "" {
+		config.Address = "127.0.0.1:6379"
+	}
+	if config.PoolSize <= 0 {
+		config.PoolSize = 10
+	}
+	r := &FireRedis{config: config, dialTimeout: 3 * time.Second, timeout: 3 * time.Second}
+	if d, err := time.ParseDuration(config.DialTimeout); err == nil {
+		r.dialTimeout = d
+	}
+	if d, err := time.ParseDuration(config.Timeout); err == nil {
+		r.timeout = d
+	}
+	return r
+}
+
+// dial 建立新连接，并且完成认证和选择数据库
+func (r *FireRedis) dial(ctx context.Context) (*conn, error) {
+	dialer := net.Dialer{Timeout: r.dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", r.config.Address)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{netConn: netConn, reader: bufio.NewReader(netConn), writer: bufio.NewWriter(netConn)}
+	if r.config.Password != "" {
+		if _, err := r.roundTrip(ctx, c, []interface{}{"AUTH", r.config.Password}); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	if r.config.DB != 0 {
+		if _, err := r.roundTrip(ctx, c, []interface{}{"SELECT", r.config.DB}); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// get 从连接池中获取一个连接，没有空闲连接时新建
+func (r *FireRedis) get(ctx context.Context) (*conn, error) {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil, errors.New("redis: client closed")
+	}
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.lock.Unlock()
+		return c, nil
+	}
+	r.lock.Unlock()
+	return r.dial(ctx)
+}
+
+// put 归还连接，连接池已满时关闭连接
+func (r *FireRedis) put(c *conn) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed || len(r.idle) >= r.config.PoolSize {
+		_ = c.netConn.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// roundTrip 在连接上发送命令并读取返回
+func (r *FireRedis) roundTrip(ctx context.Context, c *conn, args []interface{}) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(r.timeout)
+	}
+	if err := c.netConn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := writeCommand(c.writer, args); err != nil {
+		return nil, err
+	}
+	return readReply(c.reader)
+}
+
+// Do 执行一条redis命令
+func (r *FireRedis) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("redis: empty command")
+	}
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := r.roundTrip(ctx, c, args)
+	if err != nil {
+		// redis返回的错误不影响连接继续使用，其他错误需要关闭连接
+		if _, ok := err.(RedisError); ok {
+			r.put(c)
+			return nil, err
+		}
+		_ = c.netConn.Close()
+		return nil, err
+	}
+	r.put(c)
+	return reply, nil
+}
+
+// Close 关闭所有空闲连接
+func (r *FireRedis) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+	for _, c := range r.idle {
+		_ = c.netConn.Close()
+	}
+	r.idle = nil
+	return nil
+}
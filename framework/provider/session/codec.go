@@ -0,0 +1,100 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var errCookieInvalid = errors.New("session cookie is invalid")
+
+// codec 负责cookie值的签名和加密，第一个key用于编码，所有key都可以用于解码，方便轮换key
+type codec struct {
+	hashKeys  [][]byte
+	blockKeys []cipher.AEAD
+}
+
+// newCodec 从配置的密钥派生签名key和加密key
+func newCodec(secrets []string) (*codec, error) {
+	c := &codec{}
+	for _, secret := range secrets {
+		hashKey := sha256.Sum256([]byte("fire-session-hash:" + secret))
+		blockKey := sha256.Sum256([]byte("fire-session-block:" + secret))
+		block, err := aes.NewCipher(blockKey[:])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.hashKeys = append(c.hashKeys, hashKey[:])
+		c.blockKeys = append(c.blockKeys, aead)
+	}
+	return c, nil
+}
+
+func (c *codec) mac(key []byte, name, value string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name + "|" + value))
+	return h.Sum(nil)
+}
+
+// sign 签名，name参与签名，避免把一个cookie的值用在另一个cookie上
+func (c *codec) sign(name, value string) string {
+	return value + "." + base64.RawURLEncoding.EncodeToString(c.mac(c.hashKeys[0], name, value))
+}
+
+// unsign 校验签名
+func (c *codec) unsign(name, signed string) (string, error) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", errCookieInvalid
+	}
+	value := signed[:i]
+	signature, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil {
+		return "", errCookieInvalid
+	}
+	for _, key := range c.hashKeys {
+		if hmac.Equal(signature, c.mac(key, name, value)) {
+			return value, nil
+		}
+	}
+	return "", errCookieInvalid
+}
+
+// encrypt 使用AES-GCM加密，name作为附加数据
+func (c *codec) encrypt(name string, plain []byte) (string, error) {
+	aead := c.blockKeys[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt 解密
+func (c *codec) decrypt(name, value string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errCookieInvalid
+	}
+	for _, aead := range c.blockKeys {
+		if len(sealed) < aead.NonceSize() {
+			return nil, errCookieInvalid
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if plain, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, errCookieInvalid
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/provider/lifecycle"
+)
+
+// FireSessionProvider 提供session服务，配置从 session.yaml 中读取
+type FireSessionProvider struct {
+	gcOnce sync.Once
+}
+
+// Register 注册实例化方法
+func (provider *FireSessionProvider) Register(container framework.IContainer) framework.NewInstance {
+	return NewFireSessionService
+}
+
+// Boot 第一次使用session服务时调用，使用服务端存储时将清理过期session的任务注册为生命周期组件
+// cookie存储没有需要清理的数据，不注册清理任务
+func (provider *FireSessionProvider) Boot(container framework.IContainer) error {
+	if !container.IsBind(contract.LifecycleKey) || !container.IsBind(contract.ConfigKey) {
+		return nil
+	}
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	switch configService.GetString("session.store") {
+	case StoreMemory, StoreFile, StoreRedis:
+	default:
+		return nil
+	}
+	// 实例化失败后再次获取服务时会重新调用Boot，清理任务只注册一次
+	provider.gcOnce.Do(func() {
+		lifecycleService := container.MustMake(contract.LifecycleKey).(contract.ILifecycle)
+		lifecycleService.Register(lifecycle.NewLoop("session-gc", func(ctx context.Context) error {
+			return sessionGC(ctx, container)
+		}))
+	})
+	return nil
+}
+
+// sessionGC 按照 gc_interval 定时清理过期的session，出错时只记录日志，不影响app运行
+// 清理任务在第一次获取session服务的过程中注册，到时间后再获取服务，使用的是容器中保存的实例
+func sessionGC(ctx context.Context, container framework.IContainer) error {
+	logError := func(msg string, err error) {
+		if container.IsBind(contract.FireLogKey) {
+			logger := container.MustMake(contract.FireLogKey).(contract.ILog)
+			logger.Error(ctx, msg, map[string]interface{}{"error": err.Error()})
+		}
+	}
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	interval := parseDuration(configService.GetString("session.gc_interval"), 10*time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			instance, err := container.Make(contract.SessionKey)
+			if err != nil {
+				logError("session service error", err)
+				continue
+			}
+			if err := instance.(contract.ISessionService).GC(ctx); err != nil {
+				logError("session gc error", err)
+			}
+		}
+	}
+}
+
+// IsDefer session是可选的功能，第一次使用时才实例化，没有挂载session中间件时不需要配置密钥
+func (provider *FireSessionProvider) IsDefer() bool {
+	return true
+}
+
+// Params 实例化参数
+func (provider *FireSessionProvider) Params(container framework.IContainer) []interface{} {
+	return []interface{}{container}
+}
+
+// Name 字符串凭证
+func (provider *FireSessionProvider) Name() string {
+	return contract.SessionKey
+}
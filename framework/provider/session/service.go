@@ -0,0 +1,301 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/YunzeGao/fire/framework"
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreCookie session数据保存在加密或者签名的cookie中
+	StoreCookie = "cookie"
+	// StoreMemory session数据保存在进程内存中
+	StoreMemory = "memory"
+	// StoreFile session数据保存在 StorageFolder/session 中
+	StoreFile = "file"
+	// StoreRedis session数据保存在redis中
+	StoreRedis = "redis"
+
+	// maxCookieSize 浏览器对单个cookie的大小限制
+	maxCookieSize = 4096
+	// touchInterval 没有修改的session每隔这么久才刷新一次最后访问时间
+	touchInterval = time.Minute
+)
+
+// FireSessionCookieConfig session cookie的配置
+type FireSessionCookieConfig struct {
+	Name     string `yaml:"name"`
+	Path     string `yaml:"path"`
+	Domain   string `yaml:"domain"`
+	Secure   bool   `yaml:"secure"`
+	HttpOnly bool   `yaml:"http_only"`
+	// SameSite lax、strict 或者 none
+	SameSite string `yaml:"same_site"`
+}
+
+// FireSessionConfig 对应配置文件 session.yaml
+type FireSessionConfig struct {
+	// Store 存储: cookie、memory、file、redis，默认cookie
+	Store string `yaml:"store"`
+	// Cookie session cookie的配置
+	Cookie FireSessionCookieConfig `yaml:"cookie"`
+	// Keys 签名和加密使用的密钥，第一个用于编码，其他的用于轮换时解码
+	Keys []string `yaml:"keys"`
+	// Encrypt cookie存储时是否加密，false时只签名
+	Encrypt bool `yaml:"encrypt"`
+	// IdleTimeout 空闲超时，默认30m
+	IdleTimeout string `yaml:"idle_timeout"`
+	// AbsoluteTimeout 绝对超时，从创建或者重新生成开始计算，默认24h
+	AbsoluteTimeout string `yaml:"absolute_timeout"`
+	// GCInterval 清理过期session的间隔，默认10m
+	GCInterval string `yaml:"gc_interval"`
+	// Prefix redis存储时key的前缀，默认 fire:session:
+	Prefix string `yaml:"prefix"`
+}
+
+// FireSessionService session服务
+type FireSessionService struct {
+	config   FireSessionConfig
+	codec    *codec
+	store    contract.SessionStore
+	idle     time.Duration
+	absolute time.Duration
+	sameSite http.SameSite
+}
+
+var _ contract.ISessionService = (*FireSessionService)(nil)
+
+// parseDuration 解析配置中的时间，解析失败时使用默认值
+func parseDuration(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// NewFireSessionService 初始化session服务
+func NewFireSessionService(params ...interface{}) (interface{}, error) {
+	container := params[0].(framework.IContainer)
+	config := FireSessionConfig{
+		Cookie:  FireSessionCookieConfig{Name: "fire_session", Path: "/", HttpOnly: true, SameSite: "lax"},
+		Encrypt: true,
+	}
+	configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+	if configService.IsExist("session") {
+		if err := configService.Load("session", &config); err != nil {
+			return nil, errors.Wrap(err, "load session config error")
+		}
+	}
+
+	var store contract.SessionStore
+	switch config.Store {
+	case "", StoreCookie:
+	case StoreMemory:
+		store = NewMemoryStore()
+	case StoreFile:
+		appService := container.MustMake(contract.AppKey).(contract.App)
+		store = NewFileStore(filepath.Join(appService.StorageFolder(), "session"))
+	case StoreRedis:
+		if config.Prefix == "" {
+			config.Prefix = "fire:session:"
+		}
+		store = NewRedisStore(container.MustMake(contract.RedisKey).(contract.IRedis), config.Prefix)
+	default:
+		return nil, errors.Errorf("unknown session store %s", config.Store)
+	}
+	return NewFireSessionServiceWithStore(config, store)
+}
+
+// NewFireSessionServiceWithStore 使用配置和自定义的存储创建session服务，store为nil时使用cookie存储
+func NewFireSessionServiceWithStore(config FireSessionConfig, store contract.SessionStore) (*FireSessionService, error) {
+	keys := []string{}
+	for _, key := range config.Keys {
+		// 没有被替换的env(XXX)说明环境变量没有设置，不能作为密钥使用
+		if key != "" && !strings.HasPrefix(key, "env(") {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("session keys is required")
+	}
+	c, err := newCodec(keys)
+	if err != nil {
+		return nil, err
+	}
+	service := &FireSessionService{
+		config:   config,
+		codec:    c,
+		store:    store,
+		idle:     parseDuration(config.IdleTimeout, 30*time.Minute),
+		absolute: parseDuration(config.AbsoluteTimeout, 24*time.Hour),
+		sameSite: http.SameSiteLaxMode,
+	}
+	switch strings.ToLower(config.Cookie.SameSite) {
+	case "strict":
+		service.sameSite = http.SameSiteStrictMode
+	case "none":
+		service.sameSite = http.SameSiteNoneMode
+	}
+	return service, nil
+}
+
+// expired session是否已经空闲超时或者绝对超时
+func (s *FireSessionService) expired(session *Session, now time.Time) bool {
+	return now.Sub(session.last) > s.idle || now.Sub(session.created) > s.absolute
+}
+
+// Load 从请求的cookie中加载session
+func (s *FireSessionService) Load(ctx context.Context, req *http.Request) (contract.ISession, error) {
+	name := s.config.Cookie.Name
+	cookie, err := req.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return newSession(), nil
+	}
+
+	var id string
+	var content []byte
+	if s.store == nil {
+		if s.config.Encrypt {
+			content, err = s.codec.decrypt(name, cookie.Value)
+		} else {
+			var value string
+			if value, err = s.codec.unsign(name, cookie.Value); err == nil {
+				content, err = base64.RawURLEncoding.DecodeString(value)
+			}
+		}
+		if err != nil {
+			// 签名错误的cookie直接丢弃
+			return newSession(), nil
+		}
+	} else {
+		if id, err = s.codec.unsign(name, cookie.Value); err != nil {
+			return newSession(), nil
+		}
+		if content, err = s.store.Read(ctx, id); err != nil {
+			return newSession(), err
+		}
+		if content == nil {
+			return newSession(), nil
+		}
+	}
+
+	session, err := decodeSession(id, content)
+	if err != nil || session.id == "" {
+		return newSession(), nil
+	}
+	if s.expired(session, time.Now()) {
+		if s.store != nil {
+			_ = s.store.Delete(ctx, session.id)
+		}
+		return newSession(), nil
+	}
+	return session, nil
+}
+
+// Save 保存session并写入cookie，没有修改过的新session不会写入
+func (s *FireSessionService) Save(ctx context.Context, w http.ResponseWriter, session contract.ISession) error {
+	sess, ok := session.(*Session)
+	if !ok {
+		return errors.New("unsupported session")
+	}
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+	now := time.Now()
+
+	if sess.destroyed {
+		if s.store != nil {
+			if sess.oldID != "" {
+				_ = s.store.Delete(ctx, sess.oldID)
+			}
+			if err := s.store.Delete(ctx, sess.id); err != nil {
+				return err
+			}
+		}
+		if !sess.isNew || sess.oldID != "" {
+			http.SetCookie(w, s.cookie("", -1))
+		}
+		return nil
+	}
+	if !sess.modified && (sess.isNew || now.Sub(sess.last) < touchInterval) {
+		return nil
+	}
+	sess.last = now
+
+	var value string
+	if s.store == nil {
+		content, err := sess.encode(true)
+		if err != nil {
+			return err
+		}
+		if s.config.Encrypt {
+			if value, err = s.codec.encrypt(s.config.Cookie.Name, content); err != nil {
+				return err
+			}
+		} else {
+			value = s.codec.sign(s.config.Cookie.Name, base64.RawURLEncoding.EncodeToString(content))
+		}
+		if len(value) > maxCookieSize {
+			return errors.Errorf("session cookie is too large: %d bytes", len(value))
+		}
+	} else {
+		content, err := sess.encode(false)
+		if err != nil {
+			return err
+		}
+		if sess.oldID != "" {
+			if err := s.store.Delete(ctx, sess.oldID); err != nil {
+				return err
+			}
+		}
+		ttl := s.idle
+		if remain := sess.created.Add(s.absolute).Sub(now); remain < ttl {
+			ttl = remain
+		}
+		if err := s.store.Write(ctx, sess.id, content, ttl); err != nil {
+			return err
+		}
+		value = s.codec.sign(s.config.Cookie.Name, sess.id)
+	}
+	sess.oldID = ""
+	sess.isNew = false
+	sess.modified = false
+	maxAge := int(sess.created.Add(s.absolute).Sub(now).Seconds())
+	http.SetCookie(w, s.cookie(value, maxAge))
+	return nil
+}
+
+// cookie 生成session cookie，maxAge为负数时删除cookie
+func (s *FireSessionService) cookie(value string, maxAge int) *http.Cookie {
+	conf := s.config.Cookie
+	return &http.Cookie{
+		Name:     conf.Name,
+		Value:    value,
+		Path:     conf.Path,
+		Domain:   conf.Domain,
+		MaxAge:   maxAge,
+		Secure:   conf.Secure,
+		HttpOnly: conf.HttpOnly,
+		SameSite: s.sameSite,
+	}
+}
+
+// GC 清理过期的session，cookie存储时不需要清理
+func (s *FireSessionService) GC(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	return s.store.GC(ctx)
+}
+
+// GCInterval 清理过期session的间隔
+func (s *FireSessionService) GCInterval() time.Duration {
+	return parseDuration(s.config.GCInterval, 10*time.Minute)
+}
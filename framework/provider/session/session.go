@@ -0,0 +1,207 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/spf13/cast"
+)
+
+// newSessionID 生成随机的session标识
+func newSessionID() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sessionData session序列化后的结构
+type sessionData struct {
+	ID      string                 `json:"i,omitempty"`
+	Values  map[string]interface{} `json:"v,omitempty"`
+	Flash   map[string]interface{} `json:"f,omitempty"`
+	Created int64                  `json:"c"`
+	Last    int64                  `json:"l"`
+}
+
+// Session 实现了contract.ISession
+type Session struct {
+	lock sync.Mutex
+
+	id      string
+	oldID   string
+	values  map[string]interface{}
+	flash   map[string]interface{}
+	created time.Time
+	last    time.Time
+
+	isNew     bool
+	modified  bool
+	destroyed bool
+}
+
+var _ contract.ISession = (*Session)(nil)
+
+// newSession 创建一个新的session
+func newSession() *Session {
+	now := time.Now()
+	return &Session{
+		id:      newSessionID(),
+		values:  map[string]interface{}{},
+		flash:   map[string]interface{}{},
+		created: now,
+		last:    now,
+		isNew:   true,
+	}
+}
+
+// decodeSession 反序列化session，cookie存储时标识保存在数据中
+func decodeSession(id string, content []byte) (*Session, error) {
+	data := sessionData{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id = data.ID
+	}
+	s := &Session{
+		id:      id,
+		values:  data.Values,
+		flash:   data.Flash,
+		created: time.Unix(data.Created, 0),
+		last:    time.Unix(data.Last, 0),
+	}
+	if s.values == nil {
+		s.values = map[string]interface{}{}
+	}
+	if s.flash == nil {
+		s.flash = map[string]interface{}{}
+	}
+	return s, nil
+}
+
+// encode 序列化session，withID为true时将标识写入数据
+func (s *Session) encode(withID bool) ([]byte, error) {
+	data := sessionData{
+		Values:  s.values,
+		Flash:   s.flash,
+		Created: s.created.Unix(),
+		Last:    s.last.Unix(),
+	}
+	if withID {
+		data.ID = s.id
+	}
+	return json.Marshal(data)
+}
+
+// ID session的标识
+func (s *Session) ID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.id
+}
+
+// IsNew 是否是这次请求新创建的session
+func (s *Session) IsNew() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.isNew
+}
+
+// Get 获取值
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	val, ok := s.values[key]
+	return val, ok
+}
+
+// GetString 获取string类型的值
+func (s *Session) GetString(key string) string {
+	val, _ := s.Get(key)
+	return cast.ToString(val)
+}
+
+// GetInt64 获取int64类型的值
+func (s *Session) GetInt64(key string) int64 {
+	val, _ := s.Get(key)
+	return cast.ToInt64(val)
+}
+
+// GetBool 获取bool类型的值
+func (s *Session) GetBool(key string) bool {
+	val, _ := s.Get(key)
+	return cast.ToBool(val)
+}
+
+// Set 设置值
+func (s *Session) Set(key string, val interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[key] = val
+	s.modified = true
+}
+
+// Delete 删除值
+func (s *Session) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// Clear 删除所有值
+func (s *Session) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values = map[string]interface{}{}
+	s.modified = true
+}
+
+// Flash 设置闪存消息
+func (s *Session) Flash(key string, val interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.flash[key] = val
+	s.modified = true
+}
+
+// GetFlash 读取并删除闪存消息
+func (s *Session) GetFlash(key string) (interface{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	val, ok := s.flash[key]
+	if ok {
+		delete(s.flash, key)
+		s.modified = true
+	}
+	return val, ok
+}
+
+// Regenerate 更换session的标识，旧的标识在保存时删除，并且重新计算绝对过期时间
+func (s *Session) Regenerate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.isNew && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = newSessionID()
+	s.created = time.Now()
+	s.modified = true
+}
+
+// Destroy 销毁session
+func (s *Session) Destroy() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values = map[string]interface{}{}
+	s.flash = map[string]interface{}{}
+	s.destroyed = true
+	s.modified = true
+}
@@ -0,0 +1,217 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// memoryItem 内存中的一个session
+type memoryItem struct {
+	data   []byte
+	expire time.Time
+}
+
+// MemoryStore 进程内的session存储，重启后session丢失，只适合单实例部署
+type MemoryStore struct {
+	lock  sync.RWMutex
+	items map[string]memoryItem
+}
+
+var _ contract.SessionStore = (*MemoryStore)(nil)
+
+// NewMemoryStore 创建进程内的session存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]memoryItem{}}
+}
+
+// Read 读取session数据
+func (m *MemoryStore) Read(ctx context.Context, id string) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	item, ok := m.items[id]
+	if !ok || time.Now().After(item.expire) {
+		return nil, nil
+	}
+	return item.data, nil
+}
+
+// Write 写入session数据
+func (m *MemoryStore) Write(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.items[id] = memoryItem{data: data, expire: time.Now().Add(ttl)}
+	return nil
+}
+
+// Delete 删除session数据
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.items, id)
+	return nil
+}
+
+// GC 清理过期的session数据
+func (m *MemoryStore) GC(ctx context.Context) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	for id, item := range m.items {
+		if now.After(item.expire) {
+			delete(m.items, id)
+		}
+	}
+	return nil
+}
+
+// FileStore 文件session存储，每个session一个文件，第一行为过期时间
+type FileStore struct {
+	folder string
+}
+
+var _ contract.SessionStore = (*FileStore)(nil)
+
+// NewFileStore 创建文件session存储，folder在第一次写入时创建
+func NewFileStore(folder string) *FileStore {
+	return &FileStore{folder: folder}
+}
+
+// file session对应的文件，session标识只包含base64url字符，不会出现路径分隔符
+func (f *FileStore) file(id string) string {
+	return filepath.Join(f.folder, "sess_"+id)
+}
+
+// readFile 读取文件，返回过期时间和数据
+func readFile(file string) (time.Time, []byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	i := bytes.IndexByte(content, '\n')
+	if i < 0 {
+		return time.Time{}, nil, nil
+	}
+	expire, err := strconv.ParseInt(string(content[:i]), 10, 64)
+	if err != nil {
+		return time.Time{}, nil, nil
+	}
+	return time.Unix(0, expire), content[i+1:], nil
+}
+
+// Read 读取session数据
+func (f *FileStore) Read(ctx context.Context, id string) ([]byte, error) {
+	expire, data, err := readFile(f.file(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(expire) {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// Write 先写入临时文件再重命名，避免读到写了一半的文件
+func (f *FileStore) Write(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	content := strconv.AppendInt(nil, time.Now().Add(ttl).UnixNano(), 10)
+	content = append(content, '\n')
+	content = append(content, data...)
+	if err := os.MkdirAll(f.folder, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.folder, ".tmp_")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.file(id))
+}
+
+// Delete 删除session数据
+func (f *FileStore) Delete(ctx context.Context, id string) error {
+	if err := os.Remove(f.file(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// GC 删除过期的session文件
+func (f *FileStore) GC(ctx context.Context) error {
+	files, err := filepath.Glob(filepath.Join(f.folder, "sess_*"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		expire, _, err := readFile(file)
+		if err != nil {
+			continue
+		}
+		if now.After(expire) {
+			_ = os.Remove(file)
+		}
+	}
+	return nil
+}
+
+// RedisStore 基于redis的session存储，过期由redis处理
+type RedisStore struct {
+	redis  contract.IRedis
+	prefix string
+}
+
+var _ contract.SessionStore = (*RedisStore)(nil)
+
+// NewRedisStore 创建基于redis的session存储
+func NewRedisStore(redis contract.IRedis, prefix string) *RedisStore {
+	return &RedisStore{redis: redis, prefix: prefix}
+}
+
+// Read 读取session数据
+func (r *RedisStore) Read(ctx context.Context, id string) ([]byte, error) {
+	reply, err := r.redis.Do(ctx, "GET", r.prefix+id)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	if s, ok := reply.(string); ok {
+		return []byte(s), nil
+	}
+	return nil, nil
+}
+
+// Write 写入session数据
+func (r *RedisStore) Write(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	_, err := r.redis.Do(ctx, "SET", r.prefix+id, data, "PX", ttl.Milliseconds())
+	return err
+}
+
+// Delete 删除session数据
+func (r *RedisStore) Delete(ctx context.Context, id string) error {
+	_, err := r.redis.Do(ctx, "DEL", r.prefix+id)
+	return err
+}
+
+// GC redis会自动删除过期的key
+func (r *RedisStore) GC(ctx context.Context) error {
+	return nil
+}
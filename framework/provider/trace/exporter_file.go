@@ -0,0 +1,105 @@
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// spanRecord 写入文件的一行span
+type spanRecord struct {
+	Service       string                 `json:"service"`
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentID      string                 `json:"parent_id,omitempty"`
+	Name          string                 `json:"name"`
+	Kind          string                 `json:"kind"`
+	StartTime     time.Time              `json:"start_time"`
+	EndTime       time.Time              `json:"end_time"`
+	DurationMs    float64                `json:"duration_ms"`
+	Status        string                 `json:"status,omitempty"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Events        []spanEventRecord      `json:"events,omitempty"`
+}
+
+type spanEventRecord struct {
+	Name       string                 `json:"name"`
+	Time       time.Time              `json:"time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// FileExporter 将span以JSON Lines的格式追加到文件中，每行一个span
+type FileExporter struct {
+	path        string
+	serviceName string
+
+	lock sync.Mutex
+	file *os.File
+}
+
+var _ contract.SpanExporter = (*FileExporter)(nil)
+
+// NewFileExporter 创建文件导出器，文件在第一次导出时打开
+func NewFileExporter(path, serviceName string) *FileExporter {
+	return &FileExporter{path: path, serviceName: serviceName}
+}
+
+// Export 追加写入一批span
+func (e *FileExporter) Export(ctx context.Context, spans []*contract.TraceContext) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.file == nil {
+		if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(e.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		e.file = file
+	}
+	writer := bufio.NewWriter(e.file)
+	encoder := json.NewEncoder(writer)
+	for _, span := range spans {
+		record := spanRecord{
+			Service:       e.serviceName,
+			TraceID:       span.TraceID,
+			SpanID:        span.SpanID,
+			ParentID:      span.ParentID,
+			Name:          span.Name,
+			Kind:          span.Kind,
+			StartTime:     span.StartTime,
+			EndTime:       span.EndTime,
+			DurationMs:    float64(span.EndTime.Sub(span.StartTime).Microseconds()) / 1000,
+			Status:        span.Status,
+			StatusMessage: span.StatusMessage,
+			Attributes:    span.Attributes,
+		}
+		for _, event := range span.Events {
+			record.Events = append(record.Events, spanEventRecord(event))
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Shutdown 关闭文件
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
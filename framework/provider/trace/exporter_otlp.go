@@ -0,0 +1,167 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// otlpSpanKind OpenTelemetry的SpanKind枚举值
+var otlpSpanKind = map[string]int{
+	contract.SpanKindInternal: 1,
+	contract.SpanKindServer:   2,
+	contract.SpanKindClient:   3,
+	contract.SpanKindProducer: 4,
+	contract.SpanKindConsumer: 5,
+}
+
+// otlpStatusCode OpenTelemetry的StatusCode枚举值
+var otlpStatusCode = map[string]int{
+	contract.SpanStatusUnset: 0,
+	contract.SpanStatusOK:    1,
+	contract.SpanStatusError: 2,
+}
+
+// OTLPExporter 使用OTLP/HTTP的JSON编码将span发送到collector，例如 http://127.0.0.1:4318/v1/traces
+type OTLPExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+var _ contract.SpanExporter = (*OTLPExporter)(nil)
+
+// NewOTLPExporter 创建OTLP/HTTP导出器，headers会添加到每个请求中，例如认证信息
+func NewOTLPExporter(endpoint string, headers map[string]string, serviceName string) *OTLPExporter {
+	return &OTLPExporter{endpoint: endpoint, headers: headers, serviceName: serviceName, client: &http.Client{}}
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpAttributes 将属性转换为OTLP的KeyValue列表，int64按照protobuf的JSON映射编码为字符串
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	ret := make([]otlpKeyValue, 0, len(attributes))
+	for key, value := range attributes {
+		var anyValue map[string]interface{}
+		switch v := value.(type) {
+		case string:
+			anyValue = map[string]interface{}{"stringValue": v}
+		case bool:
+			anyValue = map[string]interface{}{"boolValue": v}
+		case int:
+			anyValue = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int32:
+			anyValue = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int64:
+			anyValue = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float32:
+			anyValue = map[string]interface{}{"doubleValue": float64(v)}
+		case float64:
+			anyValue = map[string]interface{}{"doubleValue": v}
+		default:
+			anyValue = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		ret = append(ret, otlpKeyValue{Key: key, Value: anyValue})
+	}
+	return ret
+}
+
+// Export 发送一批span，trace id或者span id不是十六进制格式的span会被跳过
+func (e *OTLPExporter) Export(ctx context.Context, spans []*contract.TraceContext) error {
+	items := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		if !isHexID(span.TraceID, 32) || !isHexID(span.SpanID, 16) {
+			continue
+		}
+		item := map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              otlpSpanKind[span.Kind],
+			"startTimeUnixNano": strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+			"status": map[string]interface{}{
+				"code":    otlpStatusCode[span.Status],
+				"message": span.StatusMessage,
+			},
+		}
+		if isHexID(span.ParentID, 16) {
+			item["parentSpanId"] = span.ParentID
+		}
+		if span.TraceState != "" {
+			item["traceState"] = span.TraceState
+		}
+		events := make([]map[string]interface{}, 0, len(span.Events))
+		for _, event := range span.Events {
+			events = append(events, map[string]interface{}{
+				"name":         event.Name,
+				"timeUnixNano": strconv.FormatInt(event.Time.UnixNano(), 10),
+				"attributes":   otlpAttributes(event.Attributes),
+			})
+		}
+		item["events"] = events
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": e.serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/YunzeGao/fire"},
+						"spans": items,
+					},
+				},
+			},
+		},
+	}
+	return postJSON(ctx, e.client, e.endpoint, e.headers, payload)
+}
+
+// Shutdown 关闭空闲连接
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// postJSON 发送json请求，响应状态码不是2xx时返回错误
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("export spans to %s: unexpected status %d", endpoint, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collector 记录导出器发送的请求
+type collector struct {
+	server *httptest.Server
+	header chan http.Header
+	body   chan []byte
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{header: make(chan http.Header, 1), body: make(chan []byte, 1)}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		c.header <- req.Header.Clone()
+		c.body <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func testSpan() *contract.TraceContext {
+	start := time.Unix(1700000000, 0)
+	span := &contract.TraceContext{
+		TraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:    "00f067aa0ba902b7",
+		ParentID:  "a3ce929d0e0e4736",
+		Name:      "GET /demo/:id",
+		Kind:      contract.SpanKindServer,
+		StartTime: start,
+	}
+	span.SetAttribute("http.method", "GET")
+	span.SetAttribute("http.status_code", 500)
+	span.RecordError(errors.New("boom"))
+	span.Finish()
+	span.EndTime = start.Add(1500 * time.Microsecond)
+	return span.Snapshot()
+}
+
+func TestOTLPExporter(t *testing.T) {
+	c := newCollector(t)
+	exporter := NewOTLPExporter(c.server.URL, map[string]string{"Authorization": "Bearer token"}, "fire-test")
+	invalid := &contract.TraceContext{TraceID: "legacy", SpanID: "legacy"}
+	assert.NoError(t, exporter.Export(context.Background(), []*contract.TraceContext{testSpan(), invalid}))
+
+	header := <-c.header
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+
+	var payload struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpKeyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID           string         `json:"traceId"`
+					SpanID            string         `json:"spanId"`
+					ParentSpanID      string         `json:"parentSpanId"`
+					Name              string         `json:"name"`
+					Kind              int            `json:"kind"`
+					StartTimeUnixNano string         `json:"startTimeUnixNano"`
+					EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+					Attributes        []otlpKeyValue `json:"attributes"`
+					Status            struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+					Events []struct {
+						Name       string         `json:"name"`
+						Attributes []otlpKeyValue `json:"attributes"`
+					} `json:"events"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	assert.NoError(t, json.Unmarshal(<-c.body, &payload))
+	assert.Len(t, payload.ResourceSpans, 1)
+	resource := payload.ResourceSpans[0]
+	assert.Equal(t, []otlpKeyValue{{Key: "service.name", Value: map[string]interface{}{"stringValue": "fire-test"}}},
+		resource.Resource.Attributes)
+	assert.Len(t, resource.ScopeSpans, 1)
+	assert.Len(t, resource.ScopeSpans[0].Spans, 1)
+
+	span := resource.ScopeSpans[0].Spans[0]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", span.SpanID)
+	assert.Equal(t, "a3ce929d0e0e4736", span.ParentSpanID)
+	assert.Equal(t, "GET /demo/:id", span.Name)
+	assert.Equal(t, 2, span.Kind)
+	assert.Equal(t, "1700000000000000000", span.StartTimeUnixNano)
+	assert.Equal(t, "1700000000001500000", span.EndTimeUnixNano)
+	assert.Equal(t, 2, span.Status.Code)
+	assert.Equal(t, "boom", span.Status.Message)
+	attributes := map[string]map[string]interface{}{}
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	assert.Equal(t, map[string]interface{}{"stringValue": "GET"}, attributes["http.method"])
+	assert.Equal(t, map[string]interface{}{"intValue": "500"}, attributes["http.status_code"])
+	assert.Len(t, span.Events, 1)
+	assert.Equal(t, "exception", span.Events[0].Name)
+	assert.Equal(t, []otlpKeyValue{{Key: "exception.message", Value: map[string]interface{}{"stringValue": "boom"}}},
+		span.Events[0].Attributes)
+}
+
+func TestZipkinExporter(t *testing.T) {
+	c := newCollector(t)
+	exporter := NewZipkinExporter(c.server.URL, nil, "fire-test")
+	assert.NoError(t, exporter.Export(context.Background(), []*contract.TraceContext{testSpan()}))
+
+	assert.Equal(t, "application/json", (<-c.header).Get("Content-Type"))
+	var spans []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(<-c.body, &spans))
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["id"])
+	assert.Equal(t, "a3ce929d0e0e4736", span["parentId"])
+	assert.Equal(t, "GET /demo/:id", span["name"])
+	assert.Equal(t, "SERVER", span["kind"])
+	assert.Equal(t, float64(1700000000000000), span["timestamp"])
+	assert.Equal(t, float64(1500), span["duration"])
+	assert.Equal(t, map[string]interface{}{"serviceName": "fire-test"}, span["localEndpoint"])
+	assert.Equal(t, map[string]interface{}{
+		"http.method":      "GET",
+		"http.status_code": "500",
+		"error":            "boom",
+	}, span["tags"])
+	annotations := span["annotations"].([]interface{})
+	assert.Len(t, annotations, 1)
+	assert.Equal(t, "exception", annotations[0].(map[string]interface{})["value"])
+}
+
+func TestExporterUnexpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	exporter := NewZipkinExporter(server.URL, nil, "fire-test")
+	assert.Error(t, exporter.Export(context.Background(), []*contract.TraceContext{testSpan()}))
+}
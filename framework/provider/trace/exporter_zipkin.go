@@ -0,0 +1,91 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// ZipkinExporter 使用Zipkin v2的JSON格式将span发送到collector，例如 http://127.0.0.1:9411/api/v2/spans
+type ZipkinExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+var _ contract.SpanExporter = (*ZipkinExporter)(nil)
+
+// NewZipkinExporter 创建Zipkin导出器
+func NewZipkinExporter(endpoint string, headers map[string]string, serviceName string) *ZipkinExporter {
+	return &ZipkinExporter{endpoint: endpoint, headers: headers, serviceName: serviceName, client: &http.Client{}}
+}
+
+type zipkinAnnotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+type zipkinSpan struct {
+	TraceID       string             `json:"traceId"`
+	ID            string             `json:"id"`
+	ParentID      string             `json:"parentId,omitempty"`
+	Name          string             `json:"name"`
+	Kind          string             `json:"kind,omitempty"`
+	Timestamp     int64              `json:"timestamp"`
+	Duration      int64              `json:"duration"`
+	LocalEndpoint map[string]string  `json:"localEndpoint"`
+	Tags          map[string]string  `json:"tags,omitempty"`
+	Annotations   []zipkinAnnotation `json:"annotations,omitempty"`
+}
+
+// Export 发送一批span，时间单位为微秒，出错的span带上error标签，internal类型的span不设置kind
+func (e *ZipkinExporter) Export(ctx context.Context, spans []*contract.TraceContext) error {
+	items := make([]zipkinSpan, 0, len(spans))
+	for _, span := range spans {
+		if !isHexID(span.TraceID, 32) || !isHexID(span.SpanID, 16) {
+			continue
+		}
+		item := zipkinSpan{
+			TraceID:       span.TraceID,
+			ID:            span.SpanID,
+			Name:          span.Name,
+			Timestamp:     span.StartTime.UnixNano() / 1000,
+			Duration:      span.EndTime.Sub(span.StartTime).Microseconds(),
+			LocalEndpoint: map[string]string{"serviceName": e.serviceName},
+			Tags:          map[string]string{},
+		}
+		if isHexID(span.ParentID, 16) {
+			item.ParentID = span.ParentID
+		}
+		if span.Kind != "" && span.Kind != contract.SpanKindInternal {
+			item.Kind = strings.ToUpper(span.Kind)
+		}
+		for key, value := range span.Attributes {
+			item.Tags[key] = fmt.Sprint(value)
+		}
+		if span.Status == contract.SpanStatusError {
+			item.Tags["error"] = span.StatusMessage
+		}
+		for _, event := range span.Events {
+			item.Annotations = append(item.Annotations, zipkinAnnotation{
+				Timestamp: event.Time.UnixNano() / 1000,
+				Value:     event.Name,
+			})
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return postJSON(ctx, e.client, e.endpoint, e.headers, items)
+}
+
+// Shutdown 关闭空闲连接
+func (e *ZipkinExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,163 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// batchProcessor 在后台批量导出span，队列满时丢弃新的span，不阻塞业务请求
+type batchProcessor struct {
+	maxBatch int
+	interval time.Duration
+	timeout  time.Duration
+	onError  func(msg string, err error)
+
+	lock      sync.RWMutex
+	exporters []contract.SpanExporter
+
+	queue    chan *contract.TraceContext
+	dropped  uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newBatchProcessor(config FireTraceExporterConfig, onError func(msg string, err error)) *batchProcessor {
+	if config.MaxQueueSize <= 0 {
+		config.MaxQueueSize = 2048
+	}
+	p := &batchProcessor{
+		maxBatch: config.MaxBatchSize,
+		interval: parseDuration(config.Interval, 5*time.Second),
+		timeout:  parseDuration(config.Timeout, 10*time.Second),
+		onError:  onError,
+		queue:    make(chan *contract.TraceContext, config.MaxQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if p.maxBatch <= 0 {
+		p.maxBatch = 512
+	}
+	go p.run()
+	return p
+}
+
+// parseDuration 解析配置中的时间，为空或者无效时使用默认值
+func parseDuration(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+func (p *batchProcessor) register(exporter contract.SpanExporter) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.exporters = append(p.exporters, exporter)
+}
+
+// hasExporter 没有导出器时不需要把span放入队列
+func (p *batchProcessor) hasExporter() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.exporters) > 0
+}
+
+// enqueue 将结束的span放入队列，队列满或者已经关闭时丢弃
+func (p *batchProcessor) enqueue(span *contract.TraceContext) {
+	select {
+	case <-p.stop:
+		atomic.AddUint64(&p.dropped, 1)
+		return
+	default:
+	}
+	select {
+	case p.queue <- span:
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+	}
+}
+
+// droppedSpans 因为队列满或者已经关闭而丢弃的span数量
+func (p *batchProcessor) droppedSpans() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+func (p *batchProcessor) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	batch := make([]*contract.TraceContext, 0, p.maxBatch)
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) >= p.maxBatch {
+				p.export(batch)
+				batch = make([]*contract.TraceContext, 0, p.maxBatch)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.export(batch)
+				batch = make([]*contract.TraceContext, 0, p.maxBatch)
+			}
+		case <-p.stop:
+			// 导出队列中剩余的span
+			for {
+				select {
+				case span := <-p.queue:
+					batch = append(batch, span)
+					if len(batch) >= p.maxBatch {
+						p.export(batch)
+						batch = make([]*contract.TraceContext, 0, p.maxBatch)
+					}
+				default:
+					if len(batch) > 0 {
+						p.export(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// export 将一批span交给所有的导出器，每个导出器单独计算超时
+func (p *batchProcessor) export(batch []*contract.TraceContext) {
+	p.lock.RLock()
+	exporters := append([]contract.SpanExporter(nil), p.exporters...)
+	p.lock.RUnlock()
+	for _, exporter := range exporters {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		if err := exporter.Export(ctx, batch); err != nil && p.onError != nil {
+			p.onError("trace export error", err)
+		}
+		cancel()
+	}
+}
+
+// shutdown 导出队列中剩余的span，然后关闭所有导出器
+func (p *batchProcessor) shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	p.lock.RLock()
+	exporters := append([]contract.SpanExporter(nil), p.exporters...)
+	p.lock.RUnlock()
+	var ret error
+	for _, exporter := range exporters {
+		if err := exporter.Shutdown(ctx); err != nil {
+			ret = err
+		}
+	}
+	return ret
+}
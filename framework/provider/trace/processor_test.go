@@ -0,0 +1,92 @@
+package trace
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryExporter 将导出的span保存在内存中
+type memoryExporter struct {
+	lock     sync.Mutex
+	batches  [][]*contract.TraceContext
+	shutdown bool
+}
+
+func (e *memoryExporter) Export(ctx context.Context, spans []*contract.TraceContext) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.batches = append(e.batches, spans)
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+func (e *memoryExporter) spans() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	var ret []string
+	for _, batch := range e.batches {
+		for _, span := range batch {
+			ret = append(ret, span.SpanID)
+		}
+	}
+	return ret
+}
+
+func TestBatchProcessorFlushOnShutdown(t *testing.T) {
+	// 导出间隔很长，span只会在关闭时导出
+	p := newBatchProcessor(FireTraceExporterConfig{MaxBatchSize: 2, Interval: "1h"}, nil)
+	exporter := &memoryExporter{}
+	p.register(exporter)
+	var want []string
+	for i := 0; i < 5; i++ {
+		id := strconv.Itoa(i)
+		want = append(want, id)
+		p.enqueue(&contract.TraceContext{SpanID: id})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, p.shutdown(ctx))
+	assert.Equal(t, want, exporter.spans())
+	assert.True(t, exporter.shutdown)
+	for _, batch := range exporter.batches {
+		assert.LessOrEqual(t, len(batch), 2)
+	}
+
+	// 关闭之后的span被丢弃
+	p.enqueue(&contract.TraceContext{SpanID: "late"})
+	assert.Equal(t, uint64(1), p.droppedSpans())
+	assert.Equal(t, want, exporter.spans())
+}
+
+func TestFinishSpanExportsSnapshot(t *testing.T) {
+	p := newBatchProcessor(FireTraceExporterConfig{Interval: "1h"}, nil)
+	exporter := &memoryExporter{}
+	p.register(exporter)
+	service := &FireTraceService{processor: p}
+
+	span := &contract.TraceContext{SpanID: "a", Sampled: true, StartTime: time.Now()}
+	span.SetAttribute("before", true)
+	service.FinishSpan(span)
+	// 结束之后的修改不会影响已经导出的span
+	span.SetAttribute("after", true)
+	service.FinishSpan(span)
+
+	assert.NoError(t, p.shutdown(context.Background()))
+	assert.Len(t, exporter.batches, 1)
+	assert.Len(t, exporter.batches[0], 1)
+	assert.Equal(t, map[string]interface{}{"before": true}, exporter.batches[0][0].Attributes)
+}
@@ -0,0 +1,257 @@
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/YunzeGao/fire/framework/contract"
+)
+
+// 支持的传播格式，对应配置文件 trace.propagators
+const (
+	// PropagatorW3C W3C Trace Context，请求头 traceparent 和 tracestate
+	PropagatorW3C = "w3c"
+	// PropagatorB3 B3单个请求头，b3: {trace_id}-{span_id}-{sampled}-{parent_span_id}
+	PropagatorB3 = "b3"
+	// PropagatorB3Multi B3多个请求头，X-B3-TraceId、X-B3-SpanId 等
+	PropagatorB3Multi = "b3multi"
+	// PropagatorLegacy 之前使用的 trace_id、span_id、cspan_id、parent_id 请求头
+	PropagatorLegacy = "legacy"
+)
+
+const (
+	HeaderTraceparent    = "traceparent"
+	HeaderTracestate     = "tracestate"
+	HeaderB3             = "b3"
+	HeaderB3TraceID      = "X-B3-TraceId"
+	HeaderB3SpanID       = "X-B3-SpanId"
+	HeaderB3ParentSpanID = "X-B3-ParentSpanId"
+	HeaderB3Sampled      = "X-B3-Sampled"
+	HeaderB3Flags        = "X-B3-Flags"
+)
+
+// Propagator 在http请求头中提取和注入trace
+type Propagator interface {
+	// Extract 提取上游传递的trace，TraceID为上游的trace id，ParentID为上游调用的span id，没有或者格式不正确时返回nil
+	Extract(header http.Header) *contract.TraceContext
+	// Inject 将trace写入请求头，有CspanID时以CspanID作为下游调用的span id
+	Inject(header http.Header, tc *contract.TraceContext)
+}
+
+// propagators 根据名称获取传播格式
+var propagators = map[string]Propagator{
+	PropagatorW3C:     w3cPropagator{},
+	PropagatorB3:      b3Propagator{single: true},
+	PropagatorB3Multi: b3Propagator{},
+	PropagatorLegacy:  legacyPropagator{},
+}
+
+// outgoingSpan 下游调用的span id和它的父span id
+func outgoingSpan(tc *contract.TraceContext) (spanID, parentID string) {
+	if tc.CspanID != "" {
+		return tc.CspanID, tc.SpanID
+	}
+	return tc.SpanID, tc.ParentID
+}
+
+// isHexID 是否为指定长度的小写十六进制，并且不全为0
+func isHexID(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	zero := true
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '0':
+		case s[i] >= '1' && s[i] <= '9', s[i] >= 'a' && s[i] <= 'f':
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !zero
+}
+
+// hexIDGenerator 生成随机的十六进制id，trace id为16字节，span id为8字节
+type hexIDGenerator struct {
+	bytes int
+}
+
+func (g hexIDGenerator) NewID() string {
+	b := make([]byte, g.bytes)
+	for {
+		if _, err := rand.Read(b); err == nil && !isZero(b) {
+			return hex.EncodeToString(b)
+		}
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// w3cPropagator https://www.w3.org/TR/trace-context/
+type w3cPropagator struct{}
+
+func (w3cPropagator) Extract(header http.Header) *contract.TraceContext {
+	parts := strings.Split(strings.TrimSpace(header.Get(HeaderTraceparent)), "-")
+	if len(parts) < 4 {
+		return nil
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	// 00版本只有4个字段，更高的版本允许在后面追加字段，ff是无效的版本
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return nil
+	}
+	if _, err := hex.DecodeString(version); err != nil {
+		return nil
+	}
+	if !isHexID(traceID, 32) || !isHexID(parentID, 16) || len(flags) != 2 {
+		return nil
+	}
+	flagBytes, err := hex.DecodeString(flags)
+	if err != nil {
+		return nil
+	}
+	return &contract.TraceContext{
+		TraceID:    traceID,
+		ParentID:   parentID,
+		Sampled:    flagBytes[0]&1 == 1,
+		TraceState: strings.Join(header.Values(HeaderTracestate), ","),
+	}
+}
+
+func (w3cPropagator) Inject(header http.Header, tc *contract.TraceContext) {
+	spanID, _ := outgoingSpan(tc)
+	if !isHexID(tc.TraceID, 32) || !isHexID(spanID, 16) {
+		return
+	}
+	flags := "00"
+	if tc.Sampled {
+		flags = "01"
+	}
+	header.Set(HeaderTraceparent, "00-"+tc.TraceID+"-"+spanID+"-"+flags)
+	if tc.TraceState != "" {
+		header.Set(HeaderTracestate, tc.TraceState)
+	} else {
+		header.Del(HeaderTracestate)
+	}
+}
+
+// b3Propagator https://github.com/openzipkin/b3-propagation，64位的trace id转换为128位
+type b3Propagator struct {
+	single bool
+}
+
+// b3TraceID 将B3的trace id转换为32位十六进制
+func b3TraceID(s string) string {
+	s = strings.ToLower(s)
+	if len(s) == 16 {
+		s = "0000000000000000" + s
+	}
+	return s
+}
+
+// b3Sampled 返回是否采样，没有采样标记时由当前服务的采样器决定，deferred为true
+func b3Sampled(sampled, flags string) (ok bool, deferred bool) {
+	if flags == "1" {
+		return true, false
+	}
+	if sampled == "" {
+		return true, true
+	}
+	return sampled != "0" && sampled != "false", false
+}
+
+func (p b3Propagator) Extract(header http.Header) *contract.TraceContext {
+	// 上游的parent span id不需要，上游的span id就是当前span的父span
+	var traceID, spanID, sampled, flags string
+	if p.single {
+		parts := strings.Split(strings.TrimSpace(header.Get(HeaderB3)), "-")
+		if len(parts) < 2 {
+			return nil
+		}
+		traceID, spanID = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampled = parts[2]
+			if sampled == "d" {
+				flags = "1"
+			}
+		}
+	} else {
+		traceID = header.Get(HeaderB3TraceID)
+		spanID = header.Get(HeaderB3SpanID)
+		sampled = header.Get(HeaderB3Sampled)
+		flags = header.Get(HeaderB3Flags)
+	}
+	traceID, spanID = b3TraceID(traceID), strings.ToLower(spanID)
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return nil
+	}
+	ok, deferred := b3Sampled(sampled, flags)
+	return &contract.TraceContext{
+		TraceID:        traceID,
+		ParentID:       spanID,
+		Sampled:        ok,
+		SampleDeferred: deferred,
+	}
+}
+
+func (p b3Propagator) Inject(header http.Header, tc *contract.TraceContext) {
+	spanID, parentID := outgoingSpan(tc)
+	if !isHexID(tc.TraceID, 32) || !isHexID(spanID, 16) {
+		return
+	}
+	sampled := "0"
+	if tc.Sampled {
+		sampled = "1"
+	}
+	if p.single {
+		value := tc.TraceID + "-" + spanID + "-" + sampled
+		if isHexID(parentID, 16) {
+			value += "-" + parentID
+		}
+		header.Set(HeaderB3, value)
+		return
+	}
+	header.Set(HeaderB3TraceID, tc.TraceID)
+	header.Set(HeaderB3SpanID, spanID)
+	header.Set(HeaderB3Sampled, sampled)
+	if isHexID(parentID, 16) {
+		header.Set(HeaderB3ParentSpanID, parentID)
+	} else {
+		header.Del(HeaderB3ParentSpanID)
+	}
+}
+
+// legacyPropagator 兼容之前的请求头，调用方通过cspan_id指定下游的span id
+type legacyPropagator struct{}
+
+func (legacyPropagator) Extract(header http.Header) *contract.TraceContext {
+	traceID := header.Get(contract.TraceKeyTraceID)
+	if traceID == "" {
+		return nil
+	}
+	return &contract.TraceContext{
+		TraceID:  traceID,
+		ParentID: header.Get(contract.TraceKeySpanID),
+		SpanID:   header.Get(contract.TraceKeyCspanID),
+		Sampled:  true,
+		// 之前的格式没有采样标记
+		SampleDeferred: true,
+	}
+}
+
+func (legacyPropagator) Inject(header http.Header, tc *contract.TraceContext) {
+	header.Set(contract.TraceKeyTraceID, tc.TraceID)
+	header.Set(contract.TraceKeySpanID, tc.SpanID)
+	header.Set(contract.TraceKeyCspanID, tc.CspanID)
+	header.Set(contract.TraceKeyParentID, tc.ParentID)
+}
@@ -1,12 +1,19 @@
 package trace
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/YunzeGao/fire/framework"
 	"github.com/YunzeGao/fire/framework/contract"
+	"github.com/YunzeGao/fire/framework/provider/lifecycle"
 )
 
 type FireTraceProvider struct {
 	container framework.IContainer
+
+	shutdownOnce sync.Once
 }
 
 // Register registe a new function for make a service instance
@@ -14,9 +21,29 @@ func (provider *FireTraceProvider) Register(container framework.IContainer) fram
 	return NewFireTraceService
 }
 
-// Boot will called when the service instantiate
+// Boot will called when the service instantiate，app关闭时导出剩余的span，需要在生命周期服务之后绑定
 func (provider *FireTraceProvider) Boot(container framework.IContainer) error {
 	provider.container = container
+	if !container.IsBind(contract.LifecycleKey) {
+		return nil
+	}
+	provider.shutdownOnce.Do(func() {
+		lifecycleService := container.MustMake(contract.LifecycleKey).(contract.ILifecycle)
+		lifecycleService.Register(lifecycle.NewLoop("trace-exporter", func(ctx context.Context) error {
+			<-ctx.Done()
+			instance, err := container.Make(contract.TraceKey)
+			if err != nil {
+				return nil
+			}
+			service, ok := instance.(*FireTraceService)
+			if !ok {
+				return nil
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return service.Shutdown(shutdownCtx)
+		}))
+	})
 	return nil
 }
 
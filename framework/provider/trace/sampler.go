@@ -0,0 +1,144 @@
+package trace
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/YunzeGao/fire/framework/contract"
+
+	"github.com/pkg/errors"
+)
+
+// 采样策略，对应配置文件 trace.sampler.type
+const (
+	SamplerAlwaysOn    = "always_on"
+	SamplerAlwaysOff   = "always_off"
+	SamplerRatio       = "ratio"
+	SamplerRateLimited = "rate_limited"
+)
+
+// Sampler 在trace开始时决定是否采样，parent为上游传递过来的trace，没有上游时为nil
+// 采样的决定通过传播格式传递给下游，同一个trace中的span使用相同的决定
+type Sampler interface {
+	ShouldSample(parent *contract.TraceContext, traceID string) bool
+}
+
+// FireTraceSamplerConfig 对应配置文件 trace.sampler
+type FireTraceSamplerConfig struct {
+	// Type 采样策略: always_on、always_off、ratio、rate_limited，默认always_on
+	Type string `yaml:"type"`
+	// Ratio ratio策略的采样比例，取值0到1
+	Ratio float64 `yaml:"ratio"`
+	// Rate rate_limited策略每秒最多采样的trace数量
+	Rate float64 `yaml:"rate"`
+	// ParentBased 上游传递了采样决定时沿用上游的决定，默认true
+	ParentBased bool `yaml:"parent_based"`
+	// Errors 出错的span即使没有采样也导出，默认true
+	Errors bool `yaml:"errors"`
+}
+
+// newSampler 根据配置创建采样器
+func newSampler(config FireTraceSamplerConfig) (Sampler, error) {
+	var sampler Sampler
+	switch config.Type {
+	case "", SamplerAlwaysOn:
+		sampler = alwaysSampler(true)
+	case SamplerAlwaysOff:
+		sampler = alwaysSampler(false)
+	case SamplerRatio:
+		if config.Ratio < 0 || config.Ratio > 1 {
+			return nil, errors.Errorf("invalid trace sampler ratio %v", config.Ratio)
+		}
+		sampler = newRatioSampler(config.Ratio)
+	case SamplerRateLimited:
+		if config.Rate <= 0 {
+			return nil, errors.Errorf("invalid trace sampler rate %v", config.Rate)
+		}
+		sampler = newRateLimitedSampler(config.Rate)
+	default:
+		return nil, errors.Errorf("unknown trace sampler %s", config.Type)
+	}
+	if config.ParentBased {
+		sampler = parentBasedSampler{root: sampler}
+	}
+	return sampler, nil
+}
+
+// alwaysSampler 全部采样或者全部不采样
+type alwaysSampler bool
+
+func (s alwaysSampler) ShouldSample(parent *contract.TraceContext, traceID string) bool {
+	return bool(s)
+}
+
+// ratioSampler 按照比例采样，使用trace id的低64位判断，使用相同比例的服务对同一个trace的决定一致
+type ratioSampler struct {
+	ratio float64
+	bound uint64
+}
+
+func newRatioSampler(ratio float64) ratioSampler {
+	s := ratioSampler{ratio: ratio}
+	if ratio >= 1 {
+		s.bound = math.MaxUint64
+	} else {
+		s.bound = uint64(ratio * math.Pow(2, 64))
+	}
+	return s
+}
+
+func (s ratioSampler) ShouldSample(parent *contract.TraceContext, traceID string) bool {
+	if s.ratio >= 1 {
+		return true
+	}
+	if isHexID(traceID, 32) {
+		if low, err := strconv.ParseUint(traceID[16:], 16, 64); err == nil {
+			return low < s.bound
+		}
+	}
+	// 兼容之前格式的trace id，随机决定
+	return rand.Float64() < s.ratio
+}
+
+// rateLimitedSampler 使用令牌桶限制每秒采样的trace数量，允许的突发数量等于每秒的数量
+type rateLimitedSampler struct {
+	rate  float64
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimitedSampler(rate float64) *rateLimitedSampler {
+	burst := math.Max(rate, 1)
+	return &rateLimitedSampler{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (s *rateLimitedSampler) ShouldSample(parent *contract.TraceContext, traceID string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	s.tokens = math.Min(s.burst, s.tokens+now.Sub(s.last).Seconds()*s.rate)
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// parentBasedSampler 上游传递了采样决定时沿用上游的决定，否则使用root采样器
+type parentBasedSampler struct {
+	root Sampler
+}
+
+func (s parentBasedSampler) ShouldSample(parent *contract.TraceContext, traceID string) bool {
+	if parent != nil && !parent.SampleDeferred {
+		return parent.Sampled
+	}
+	return s.root.ShouldSample(parent, traceID)
+}
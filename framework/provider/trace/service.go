@@ -3,27 +3,155 @@ package trace
 import (
 	"context"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/YunzeGao/fire/framework"
 	"github.com/YunzeGao/fire/framework/contract"
 	"github.com/YunzeGao/fire/framework/gin"
+
+	"github.com/pkg/errors"
 )
 
 type TraceKey string
 
 var ContextKey = TraceKey("trace-key")
 
+// 导出span的方式，对应配置文件 trace.exporter.drivers
+const (
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+	ExporterZipkin = "zipkin"
+)
+
+// FireTraceExporterConfig 对应配置文件 trace.exporter
+type FireTraceExporterConfig struct {
+	// Drivers 导出方式，可以同时使用多个: file、otlp、zipkin，为空时不导出
+	Drivers []string `yaml:"drivers"`
+	// MaxQueueSize 等待导出的span数量上限，超过时丢弃，默认2048
+	MaxQueueSize int `yaml:"max_queue_size"`
+	// MaxBatchSize 每次导出的span数量上限，默认512
+	MaxBatchSize int `yaml:"max_batch_size"`
+	// Interval 导出的间隔，默认5s
+	Interval string `yaml:"interval"`
+	// Timeout 每次导出的超时时间，默认10s
+	Timeout string `yaml:"timeout"`
+	File    struct {
+		// Path 文件路径，为空时使用日志目录下的 trace.jsonl
+		Path string `yaml:"path"`
+	} `yaml:"file"`
+	OTLP struct {
+		// Endpoint OTLP/HTTP的地址，默认 http://127.0.0.1:4318/v1/traces
+		Endpoint string `yaml:"endpoint"`
+		// Headers 请求头，例如认证信息
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"otlp"`
+	Zipkin struct {
+		// Endpoint Zipkin的地址，默认 http://127.0.0.1:9411/api/v2/spans
+		Endpoint string `yaml:"endpoint"`
+		// Headers 请求头
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"zipkin"`
+}
+
+// FireTraceConfig 对应配置文件 trace.yaml
+type FireTraceConfig struct {
+	// ServiceName 导出span时使用的服务名称，默认fire
+	ServiceName string `yaml:"service_name"`
+	// Propagators 传播格式: w3c、b3、b3multi、legacy，提取时按顺序使用第一个有效的，注入时全部写入
+	Propagators []string `yaml:"propagators"`
+	// ResponseHeader Trace中间件返回trace id的响应头，为空时不返回
+	ResponseHeader string `yaml:"response_header"`
+	// Sampler 采样策略，在trace开始时决定是否采样
+	Sampler FireTraceSamplerConfig `yaml:"sampler"`
+	// Exporter span的导出
+	Exporter FireTraceExporterConfig `yaml:"exporter"`
+}
+
 type FireTraceService struct {
 	idService        contract.IDService
 	traceIDGenerator contract.IDService
 	spanIDGenerator  contract.IDService
+	propagators      []Propagator
+	sampler          Sampler
+	sampleErrors     bool
+	processor        *batchProcessor
 }
 
 func NewFireTraceService(params ...interface{}) (interface{}, error) {
 	container := params[0].(framework.IContainer)
 	idService := container.MustMake(contract.IDKey).(contract.IDService)
-	return &FireTraceService{idService: idService}, nil
+	config := FireTraceConfig{
+		ServiceName: "fire",
+		Sampler:     FireTraceSamplerConfig{ParentBased: true, Errors: true},
+	}
+	if container.IsBind(contract.ConfigKey) {
+		configService := container.MustMake(contract.ConfigKey).(contract.IConfig)
+		if configService.IsExist("trace") {
+			if err := configService.Load("trace", &config); err != nil {
+				return nil, errors.Wrap(err, "load trace config error")
+			}
+		}
+	}
+	if len(config.Propagators) == 0 {
+		config.Propagators = []string{PropagatorW3C, PropagatorB3, PropagatorB3Multi, PropagatorLegacy}
+	}
+	sampler, err := newSampler(config.Sampler)
+	if err != nil {
+		return nil, err
+	}
+	service := &FireTraceService{
+		idService:        idService,
+		traceIDGenerator: hexIDGenerator{bytes: 16},
+		spanIDGenerator:  hexIDGenerator{bytes: 8},
+		sampler:          sampler,
+		sampleErrors:     config.Sampler.Errors,
+	}
+	for _, name := range config.Propagators {
+		propagator, ok := propagators[strings.ToLower(name)]
+		if !ok {
+			return nil, errors.Errorf("unknown trace propagator %s", name)
+		}
+		service.propagators = append(service.propagators, propagator)
+	}
+
+	service.processor = newBatchProcessor(config.Exporter, func(msg string, err error) {
+		if container.IsBind(contract.FireLogKey) {
+			logger := container.MustMake(contract.FireLogKey).(contract.ILog)
+			logger.Error(context.Background(), msg, map[string]interface{}{"error": err.Error()})
+		}
+	})
+	for _, driver := range config.Exporter.Drivers {
+		var exporter contract.SpanExporter
+		switch strings.ToLower(driver) {
+		case ExporterFile:
+			path := config.Exporter.File.Path
+			if path == "" {
+				path = "trace.jsonl"
+				if container.IsBind(contract.AppKey) {
+					path = filepath.Join(container.MustMake(contract.AppKey).(contract.App).LogFolder(), path)
+				}
+			}
+			exporter = NewFileExporter(path, config.ServiceName)
+		case ExporterOTLP:
+			endpoint := config.Exporter.OTLP.Endpoint
+			if endpoint == "" {
+				endpoint = "http://127.0.0.1:4318/v1/traces"
+			}
+			exporter = NewOTLPExporter(endpoint, config.Exporter.OTLP.Headers, config.ServiceName)
+		case ExporterZipkin:
+			endpoint := config.Exporter.Zipkin.Endpoint
+			if endpoint == "" {
+				endpoint = "http://127.0.0.1:9411/api/v2/spans"
+			}
+			exporter = NewZipkinExporter(endpoint, config.Exporter.Zipkin.Headers, config.ServiceName)
+		default:
+			return nil, errors.Errorf("unknown trace exporter %s", driver)
+		}
+		service.processor.register(exporter)
+	}
+	return service, nil
 }
 
 // WithTrace register new trace to context
@@ -48,10 +176,16 @@ func (t *FireTraceService) GetTrace(c context.Context) *contract.TraceContext {
 	if tc, ok := c.Value(ContextKey).(*contract.TraceContext); ok {
 		return tc
 	}
+	// 由gin.Context派生的context，例如设置了超时，使用请求的trace
+	if ginC, ok := c.Value(gin.ContextKey).(*gin.Context); ok {
+		if val, ok2 := ginC.Get(string(ContextKey)); ok2 {
+			return val.(*contract.TraceContext)
+		}
+	}
 	return nil
 }
 
-// NewTrace generate a new trace
+// NewTrace generate a new trace，是否采样由采样器决定
 func (t *FireTraceService) NewTrace() *contract.TraceContext {
 	var traceID, spanID string
 	if t.traceIDGenerator != nil {
@@ -70,12 +204,16 @@ func (t *FireTraceService) NewTrace() *contract.TraceContext {
 		ParentID:   "",
 		SpanID:     spanID,
 		CspanID:    "",
+		Sampled:    t.sampler.ShouldSample(nil, traceID),
 		Annotation: map[string]string{},
+		Kind:       contract.SpanKindInternal,
+		StartTime:  time.Now(),
+		Status:     contract.SpanStatusUnset,
 	}
 	return tc
 }
 
-// ChildSpan instance a sub trace with new span id
+// ChildSpan instance a child span, the SpanID of tc becomes its ParentID
 func (t *FireTraceService) ChildSpan(tc *contract.TraceContext) *contract.TraceContext {
 	var childSpanID string
 	if t.spanIDGenerator != nil {
@@ -83,40 +221,111 @@ func (t *FireTraceService) ChildSpan(tc *contract.TraceContext) *contract.TraceC
 	} else {
 		childSpanID = t.idService.NewID()
 	}
+	now := time.Now()
 	childSpan := &contract.TraceContext{
 		TraceID:  tc.TraceID,
-		ParentID: "",
-		SpanID:   tc.SpanID,
-		CspanID:  childSpanID,
+		ParentID: tc.SpanID,
+		SpanID:   childSpanID,
+		CspanID:  "",
+
+		Sampled:    tc.Sampled,
+		TraceState: tc.TraceState,
 		Annotation: map[string]string{
-			contract.TraceKeyTime: time.Now().String(),
+			contract.TraceKeyTime: now.String(),
 		},
+		Kind:      contract.SpanKindInternal,
+		StartTime: now,
+		Status:    contract.SpanStatusUnset,
 	}
 	return childSpan
 }
 
-// ExtractHTTP GetTrace By Http
+// StartSpan 以ctx中的span为父span开始一个新的span
+// 新的span保存在返回的ctx中，即使ctx是gin.Context也不会覆盖请求的span
+func (t *FireTraceService) StartSpan(ctx context.Context, name string, kind string) (context.Context, *contract.TraceContext) {
+	var span *contract.TraceContext
+	if parent := t.GetTrace(ctx); parent != nil {
+		span = t.ChildSpan(parent)
+	} else {
+		span = t.NewTrace()
+	}
+	span.Name = name
+	if kind != "" {
+		span.Kind = kind
+	}
+	return context.WithValue(ctx, ContextKey, span), span
+}
+
+// FinishSpan 结束span，采样或者出错并且配置了导出器时放入导出队列
+func (t *FireTraceService) FinishSpan(tc *contract.TraceContext) {
+	if tc == nil || !tc.Finish() {
+		return
+	}
+	if !t.processor.hasExporter() {
+		return
+	}
+	// 导出器在后台读取span，使用结束时的快照，避免和仍然持有span的goroutine竞争
+	snapshot := tc.Snapshot()
+	if !snapshot.Sampled && !(t.sampleErrors && snapshot.Status == contract.SpanStatusError) {
+		return
+	}
+	t.processor.enqueue(snapshot)
+}
+
+// Detach 分离出只带有trace的context，可以在请求结束后继续使用
+func (t *FireTraceService) Detach(c context.Context) context.Context {
+	ctx := context.Background()
+	if tc := t.GetTrace(c); tc != nil {
+		ctx = context.WithValue(ctx, ContextKey, tc)
+	}
+	return ctx
+}
+
+// RegisterExporter 增加一个导出器
+func (t *FireTraceService) RegisterExporter(exporter contract.SpanExporter) {
+	t.processor.register(exporter)
+}
+
+// DroppedSpans 因为导出队列满而丢弃的span数量
+func (t *FireTraceService) DroppedSpans() uint64 {
+	return t.processor.droppedSpans()
+}
+
+// Shutdown 导出队列中剩余的span并且关闭导出器，app关闭时由生命周期服务调用
+func (t *FireTraceService) Shutdown(ctx context.Context) error {
+	return t.processor.shutdown(ctx)
+}
+
+// ExtractHTTP GetTrace By Http，按照配置的顺序使用第一个有效的传播格式，都没有时生成新的trace
+// 上游的采样决定交给采样器，parent_based时沿用上游的决定
 func (t *FireTraceService) ExtractHTTP(req *http.Request) *contract.TraceContext {
-	tc := &contract.TraceContext{}
-	tc.TraceID = req.Header.Get(contract.TraceKeyTraceID)
-	tc.ParentID = req.Header.Get(contract.TraceKeySpanID)
-	tc.SpanID = req.Header.Get(contract.TraceKeyCspanID)
-	tc.CspanID = ""
-	if tc.TraceID == "" {
-		tc.TraceID = t.idService.NewID()
+	var tc *contract.TraceContext
+	for _, propagator := range t.propagators {
+		if tc = propagator.Extract(req.Header); tc != nil {
+			break
+		}
+	}
+	if tc == nil {
+		return t.NewTrace()
 	}
 	if tc.SpanID == "" {
-		tc.SpanID = t.idService.NewID()
+		tc.SpanID = t.spanIDGenerator.NewID()
 	}
+	tc.Sampled = t.sampler.ShouldSample(tc, tc.TraceID)
+	tc.SampleDeferred = false
+	tc.CspanID = ""
+	tc.Annotation = map[string]string{}
+	tc.Kind = contract.SpanKindInternal
+	tc.StartTime = time.Now()
+	tc.Status = contract.SpanStatusUnset
 	return tc
 }
 
-// InjectHTTP Set Trace to Http
+// InjectHTTP Set Trace to Http，写入所有配置的传播格式，trace id不是W3C格式时不写入w3c和b3
 func (t *FireTraceService) InjectHTTP(req *http.Request, tc *contract.TraceContext) *http.Request {
-	req.Header.Add(contract.TraceKeyTraceID, tc.TraceID)
-	req.Header.Add(contract.TraceKeySpanID, tc.SpanID)
-	req.Header.Add(contract.TraceKeyCspanID, tc.CspanID)
-	req.Header.Add(contract.TraceKeyParentID, tc.ParentID)
+	for _, propagator := range t.propagators {
+		propagator.Inject(req.Header, tc)
+	}
 	return req
 }
 
@@ -0,0 +1,54 @@
+package util
+
+import "strings"
+
+// DiffLines 按行比较两段文本，返回统一格式的差异行: 相同的行以" "开头，删除的行以"-"开头，新增的行以"+"开头
+// 两段文本完全一致时返回nil
+func DiffLines(a, b string) []string {
+	if a == b {
+		return nil
+	}
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+
+	// lcs[i][j] 表示 as[i:] 和 bs[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ret []string
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			ret = append(ret, " "+as[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, "-"+as[i])
+			i++
+		default:
+			ret = append(ret, "+"+bs[j])
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		ret = append(ret, "-"+as[i])
+	}
+	for ; j < len(bs); j++ {
+		ret = append(ret, "+"+bs[j])
+	}
+	return ret
+}
@@ -0,0 +1,16 @@
+package util
+
+import (
+	"context"
+	"net"
+)
+
+// Listen 监听tcp地址，reusePort为true时会设置SO_REUSEPORT，允许多个进程同时监听同一个端口
+// 不支持SO_REUSEPORT的平台上reusePort为true时返回错误
+func Listen(address string, reusePort bool) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(context.Background(), "tcp", address)
+}
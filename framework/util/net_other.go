@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package util
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+)
+
+// reusePortControl 当前平台不支持SO_REUSEPORT
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on " + runtime.GOOS)
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"os"
+
 	"github.com/YunzeGao/fire/app/console"
 	"github.com/YunzeGao/fire/app/http"
 	"github.com/YunzeGao/fire/framework"
 	"github.com/YunzeGao/fire/framework/provider/app"
+	"github.com/YunzeGao/fire/framework/provider/auth"
 	"github.com/YunzeGao/fire/framework/provider/config"
 	"github.com/YunzeGao/fire/framework/provider/env"
+	"github.com/YunzeGao/fire/framework/provider/httpclient"
 	"github.com/YunzeGao/fire/framework/provider/id"
 	"github.com/YunzeGao/fire/framework/provider/kernel"
+	"github.com/YunzeGao/fire/framework/provider/lifecycle"
 	"github.com/YunzeGao/fire/framework/provider/log"
+	"github.com/YunzeGao/fire/framework/provider/metrics"
+	"github.com/YunzeGao/fire/framework/provider/redis"
+	"github.com/YunzeGao/fire/framework/provider/session"
 	"github.com/YunzeGao/fire/framework/provider/trace"
 )
 
@@ -20,12 +28,22 @@ func main() {
 	_ = container.Bind(&env.FireEnvProvider{})
 	_ = container.Bind(&config.FireConfigProvider{})
 	_ = container.Bind(&id.FireIDProvider{})
-	_ = container.Bind(&trace.FireTraceProvider{})
 	_ = container.Bind(&log.FireLogProvider{})
-	// 将HTTP引擎初始化,并且作为服务提供者绑定到服务容器中
+	_ = container.Bind(&lifecycle.FireLifecycleProvider{})
+	// trace在关闭时需要导出剩余的span，在生命周期服务之后绑定
+	_ = container.Bind(&trace.FireTraceProvider{})
+	_ = container.Bind(&metrics.FireMetricsProvider{})
+	_ = container.Bind(&redis.FireRedisProvider{})
+	_ = container.Bind(&auth.FireAuthProvider{})
+	_ = container.Bind(&session.FireSessionProvider{})
+	_ = container.Bind(&httpclient.FireHttpClientProvider{})
+	// 将HTTP引擎和管理端口的引擎初始化,并且作为服务提供者绑定到服务容器中
 	if engine, err := http.NewHttpEngine(); err == nil {
-		_ = container.Bind(&kernel.FireKernelProvider{HttpEngine: engine})
+		adminEngine, _ := http.NewAdminEngine()
+		_ = container.Bind(&kernel.FireKernelProvider{HttpEngine: engine, AdminEngine: adminEngine})
+	}
+	// 运行root命令，命令执行失败时返回非0退出码
+	if err := console.RunCommand(container); err != nil {
+		os.Exit(1)
 	}
-	// 运行root命令
-	_ = console.RunCommand(container)
 }